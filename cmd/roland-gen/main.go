@@ -0,0 +1,111 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command roland-gen generates typed Go structs, label and property key
+// constants, and repositories from the schema of a database or from a schema
+// definition file (see package gen).
+//
+// Usage:
+//
+//	roland-gen [flags]
+//
+// e.g., to introspect a database:
+//
+//	roland-gen -a neo4j://localhost:7687 -u basic:neo4j:secret -pkg model -o model/model_gen.go
+//
+// or, to read a schema definition:
+//
+//	roland-gen -schema schema.json -pkg model -o model/model_gen.go
+//
+// The credentials default to the environment variable NEO4J_AUTH.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/abc-inc/roland/gen"
+	"github.com/abc-inc/roland/graph"
+	"github.com/abc-inc/roland/meta"
+)
+
+var version = "dev"
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "roland-gen:", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the flags, obtains the schema and writes the generated code to
+// the output file or w.
+func run(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("roland-gen", flag.ContinueOnError)
+	addr := fs.String("a", "neo4j://localhost:7687", "address of the database")
+	cred := fs.String("u", os.Getenv("NEO4J_AUTH"), "credentials e.g., basic:user:password")
+	db := fs.String("d", "", "name of the database (default database if empty)")
+	file := fs.String("schema", "", "schema definition file in JSON format instead of introspection")
+	pkg := fs.String("pkg", "model", "name of the generated package")
+	out := fs.String("o", "", "output file (standard output if empty)")
+	ptrs := fs.Bool("pointers", false, "generate pointer fields for optional properties")
+	repos := fs.Bool("repositories", true, "generate Repository constructors")
+	ver := fs.Bool("version", false, "print the version and exit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *ver {
+		_, err := fmt.Fprintln(w, "roland-gen", version)
+		return err
+	}
+
+	m, err := loadSchema(*file, *addr, *cred, *db)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	if err = gen.Generate(&b, m, gen.Options{Package: *pkg, Pointers: *ptrs, Repositories: *repos}); err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = w.Write(b.Bytes())
+		return err
+	}
+	return os.WriteFile(*out, b.Bytes(), 0o644)
+}
+
+// loadSchema reads the schema definition file, if it is given, and
+// introspects the database otherwise.
+func loadSchema(file, addr, cred, db string) (meta.Metadata, error) {
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return meta.Metadata{}, err
+		}
+		defer func() { _ = f.Close() }()
+		return gen.ReadSchema(f)
+	}
+
+	auth, user := graph.Auth(cred)
+	c, err := graph.NewConn(addr, user, auth, db)
+	if err != nil {
+		return meta.Metadata{}, err
+	}
+	defer func() { _ = c.Close() }()
+	return gen.Introspect(c)
+}
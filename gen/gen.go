@@ -0,0 +1,395 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gen generates typed Go code from the schema of a database, so that
+// labels, relationship types and property keys need not be spelled out as
+// strings. For each label, it generates a struct with a field per property,
+// a label constant, property key constants and a Repository constructor, and
+// for each relationship type, a type constant and a struct for its properties:
+//
+//	// Person is a node labeled Person.
+//	type Person struct {
+//		ID   int64  `neo4j:",id"`
+//		Name string `neo4j:"name"`
+//	}
+//
+//	const (
+//		LabelPerson = "Person"
+//		PersonName  = "name"
+//	)
+//
+//	func NewPersonRepository(c *graph.Conn) *graph.Repository[Person]
+//
+// The schema is either obtained from the database by Introspect, or read from
+// a definition file by ReadSchema. The roland-gen command combines both with
+// Generate.
+package gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/abc-inc/roland/meta"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Options configures the generated code.
+type Options struct {
+	// Package is the name of the generated package. It defaults to "model".
+	Package string
+	// Pointers generates pointer fields for properties without an existence
+	// constraint, so that missing properties can be told apart from zero
+	// values.
+	Pointers bool
+	// Repositories generates a Repository constructor for each label.
+	Repositories bool
+}
+
+// ReadSchema reads a schema definition in JSON format, whose nodes and
+// relationships are described like by meta.FetchMetadata e.g.,
+//
+//	{
+//	  "nodes": [{"labels": ["Person"], "properties": {
+//	    "name": {"type": "STRING", "unique": true, "existence": true},
+//	    "born": {"type": "DATE"}}}],
+//	  "rels": [{"type": "ACTED_IN", "properties": {
+//	    "roles": {"type": "LIST OF STRING"}}}]
+//	}
+//
+// Property types are the names used by apoc.meta.schema or by
+// db.schema.nodeTypeProperties e.g., "INTEGER" or "Long".
+func ReadSchema(r io.Reader) (m meta.Metadata, err error) {
+	if err = json.NewDecoder(r).Decode(&m); err != nil {
+		return m, fmt.Errorf("cannot read schema: %w", err)
+	}
+	return m, nil
+}
+
+// Generate writes Go source code for the nodes and relationships of the
+// Metadata. Nodes with multiple labels contribute their properties to each
+// label, which is mandatory, if all of them have it. The code is formatted
+// with gofmt.
+func Generate(w io.Writer, m meta.Metadata, o Options) error {
+	if o.Package == "" {
+		o.Package = "model"
+	}
+	g := &generator{o: o, names: make(map[string]bool), imports: make(map[string]bool)}
+	nodes, rels := g.nodes(m.Nodes), g.rels(m.Rels)
+	for _, n := range nodes {
+		g.node(n)
+	}
+	for _, r := range rels {
+		g.rel(r)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by roland-gen. DO NOT EDIT.\n\npackage %s\n\n", o.Package)
+	if len(g.imports) > 0 {
+		// The standard library comes first, separated from other packages.
+		imps := maps.Keys(g.imports)
+		slices.SortFunc(imps, func(a, b string) bool {
+			if sa, sb := !strings.Contains(a, "."), !strings.Contains(b, "."); sa != sb {
+				return sa
+			}
+			return a < b
+		})
+		b.WriteString("import (\n")
+		for i, imp := range imps {
+			if i > 0 && !strings.Contains(imps[i-1], ".") && strings.Contains(imp, ".") {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "\t%q\n", imp)
+		}
+		b.WriteString(")\n\n")
+	}
+	b.Write(g.buf.Bytes())
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return fmt.Errorf("cannot format generated code: %w", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// typeDef is a label or relationship type and its properties.
+type typeDef struct {
+	name  string
+	ident string
+	props map[string]meta.NodeProperty
+}
+
+// generator accumulates the declarations and imports of the generated code.
+type generator struct {
+	o       Options
+	buf     bytes.Buffer
+	names   map[string]bool
+	imports map[string]bool
+}
+
+// nodes merges the properties of the nodes per label and assigns the type
+// names in order of the labels.
+func (g *generator) nodes(ns []meta.Node) []typeDef {
+	byLabel := make(map[string]map[string]meta.NodeProperty)
+	cnt, seen := make(map[string]int), make(map[[2]string]int)
+	for _, n := range ns {
+		for _, l := range n.Labels {
+			if byLabel[l] == nil {
+				byLabel[l] = make(map[string]meta.NodeProperty)
+			}
+			cnt[l]++
+			for k, p := range n.Properties {
+				byLabel[l][k] = mergeProp(byLabel[l], k, p)
+				seen[[2]string{l, k}]++
+			}
+		}
+	}
+	ls := maps.Keys(byLabel)
+	sort.Strings(ls)
+	defs := make([]typeDef, len(ls))
+	for i, l := range ls {
+		// A property is only mandatory, if all kinds of nodes with the label have it.
+		for k, p := range byLabel[l] {
+			p.Existence = p.Existence && seen[[2]string{l, k}] == cnt[l]
+			byLabel[l][k] = p
+		}
+		defs[i] = typeDef{name: l, ident: g.unique(ident(l)), props: byLabel[l]}
+	}
+	return defs
+}
+
+// rels merges the properties of the relationships per type and assigns the
+// type names after the ones of the labels. A type colliding with a label gets
+// the suffix "Rel".
+func (g *generator) rels(rs []meta.Relationship) []typeDef {
+	byType := make(map[string]map[string]meta.NodeProperty)
+	for _, r := range rs {
+		if byType[r.Type] == nil {
+			byType[r.Type] = make(map[string]meta.NodeProperty)
+		}
+		for k, p := range r.Properties {
+			np := meta.NodeProperty{Indexed: p.Indexed, Existence: p.Existence, Type: p.Type}
+			if p.Array && !isList(p.Type) {
+				np.Type = "LIST OF " + p.Type
+			}
+			byType[r.Type][k] = mergeProp(byType[r.Type], k, np)
+		}
+	}
+	ts := maps.Keys(byType)
+	sort.Strings(ts)
+	defs := make([]typeDef, len(ts))
+	for i, t := range ts {
+		id := ident(t)
+		if g.names[id] {
+			id += "Rel"
+		}
+		defs[i] = typeDef{name: t, ident: g.unique(id), props: byType[t]}
+	}
+	return defs
+}
+
+// mergeProp combines a property with the one of the same key, if any. If their
+// types differ, the type is unknown.
+func mergeProp(ps map[string]meta.NodeProperty, key string, p meta.NodeProperty) meta.NodeProperty {
+	q, ok := ps[key]
+	if !ok {
+		return p
+	}
+	if normType(q.Type) != normType(p.Type) {
+		q.Type = ""
+	}
+	q.Indexed, q.Unique = q.Indexed || p.Indexed, q.Unique || p.Unique
+	q.Existence = q.Existence && p.Existence
+	return q
+}
+
+// node writes the struct, the constants and the Repository of a label.
+func (g *generator) node(d typeDef) {
+	fmt.Fprintf(&g.buf, "// %s is a node labeled %s.\ntype %s struct {\n\tID int64 `neo4j:\",id\"`\n",
+		d.ident, d.name, d.ident)
+	keys := g.fields(d)
+	lc := g.unique("Label" + d.ident)
+	fmt.Fprintf(&g.buf, "}\n\n// Label and property keys of %s.\nconst (\n\t%s = %q\n", d.ident, lc, d.name)
+	g.consts(d, keys)
+	g.buf.WriteString(")\n\n")
+
+	if g.o.Repositories {
+		g.imports["github.com/abc-inc/roland/graph"] = true
+		fmt.Fprintf(&g.buf, "// %[1]s creates a Repository for the nodes labeled %[2]s.\n"+
+			"func %[1]s(c *graph.Conn) *graph.Repository[%[3]s] {\n"+
+			"\treturn graph.NewRepositoryWith(graph.NewTemplate[%[3]s](c).WithLabels(%[4]s))\n}\n\n",
+			g.unique("New"+d.ident+"Repository"), d.name, d.ident, lc)
+	}
+}
+
+// rel writes the struct and the constants of a relationship type.
+func (g *generator) rel(d typeDef) {
+	fmt.Fprintf(&g.buf, "// %s holds the properties of a relationship of type %s.\ntype %s struct {\n",
+		d.ident, d.name, d.ident)
+	keys := g.fields(d)
+	fmt.Fprintf(&g.buf, "}\n\n// Type and property keys of %s.\nconst (\n\t%s = %q\n", d.ident, g.unique("Rel"+ident(d.name)), d.name)
+	g.consts(d, keys)
+	g.buf.WriteString(")\n\n")
+}
+
+// fields writes a field for each property of the type and returns the
+// property keys in order. The struct tags are quoted, so that keys may contain
+// any character. Keys, which the tag syntax cannot express, because they
+// contain a comma or an equals sign, are held by a remainder field instead.
+func (g *generator) fields(d typeDef) []string {
+	keys := maps.Keys(d.props)
+	sort.Strings(keys)
+	seen := map[string]bool{"ID": true}
+	var rest []string
+	for _, k := range keys {
+		if k == "" || k == "-" || strings.ContainsAny(k, ",=") {
+			rest = append(rest, strconv.Quote(k))
+			continue
+		}
+		p := d.props[k]
+		typ, opt := g.goType(p.Type)
+		if g.o.Pointers && !p.Existence && !strings.HasPrefix(typ, "[]") && !strings.HasPrefix(typ, "map") &&
+			typ != "any" {
+			typ = "*" + typ
+		}
+		tag := "neo4j:" + strconv.Quote(k+opt)
+		if strings.Contains(tag, "`") {
+			tag = strconv.Quote(tag)
+		} else {
+			tag = "`" + tag + "`"
+		}
+		fmt.Fprintf(&g.buf, "\t%s %s %s\n", uniqueIn(seen, ident(k)), typ, tag)
+	}
+	if len(rest) > 0 {
+		fmt.Fprintf(&g.buf, "\t// %s holds the properties %s.\n\t%[1]s map[string]any `neo4j:\",remainder\"`\n",
+			uniqueIn(seen, "Properties"), strings.Join(rest, ", "))
+	}
+	return keys
+}
+
+// consts writes a constant for each property key of the type.
+func (g *generator) consts(d typeDef, keys []string) {
+	for _, k := range keys {
+		fmt.Fprintf(&g.buf, "\t%s = %q\n", g.unique(d.ident+ident(k)), k)
+	}
+}
+
+// unique returns the name, or the name with a numeric suffix, if it is already
+// declared at package level.
+func (g *generator) unique(name string) string {
+	return uniqueIn(g.names, name)
+}
+
+// uniqueIn returns the name, or the name with a numeric suffix, if it is
+// already in the set, and adds the result to the set.
+func uniqueIn(names map[string]bool, name string) string {
+	n := name
+	for i := 2; names[n]; i++ {
+		n = fmt.Sprintf("%s%d", name, i)
+	}
+	names[n] = true
+	return n
+}
+
+// goType returns the Go type of a property type, and the options of the field
+// e.g., ",date" for time.Time fields, which are stored as Date.
+func (g *generator) goType(cypher string) (string, string) {
+	t := normType(cypher)
+	switch {
+	case strings.HasPrefix(t, "LISTOF"):
+		typ, _ := g.goType(strings.TrimPrefix(t, "LISTOF"))
+		return "[]" + typ, ""
+	case strings.HasSuffix(t, "ARRAY"):
+		typ, _ := g.goType(strings.TrimSuffix(t, "ARRAY"))
+		return "[]" + typ, ""
+	}
+
+	switch t {
+	case "STRING":
+		return "string", ""
+	case "INTEGER", "LONG", "INT":
+		return "int64", ""
+	case "FLOAT", "DOUBLE":
+		return "float64", ""
+	case "BOOLEAN":
+		return "bool", ""
+	case "DATETIME", "ZONEDDATETIME":
+		g.imports["time"] = true
+		return "time.Time", ""
+	case "DATE":
+		g.imports["time"] = true
+		return "time.Time", ",date"
+	case "LOCALDATETIME":
+		g.imports["time"] = true
+		return "time.Time", ",localdatetime"
+	case "LOCALTIME":
+		g.imports["time"] = true
+		return "time.Time", ",localtime"
+	case "TIME", "ZONEDTIME":
+		g.imports["time"] = true
+		return "time.Time", ",time"
+	case "DURATION":
+		g.imports["time"] = true
+		return "time.Duration", ",duration"
+	case "POINT":
+		g.imports["github.com/abc-inc/roland/graph"] = true
+		return "graph.Point", ""
+	case "MAP":
+		return "map[string]any", ""
+	}
+	return "any", ""
+}
+
+// normType normalizes the names of property types, so that the names of
+// apoc.meta.schema and db.schema.nodeTypeProperties can be compared e.g.,
+// "DATE_TIME" and "DateTime", or "LIST OF STRING" and "StringArray".
+func normType(t string) string {
+	return strings.ToUpper(strings.NewReplacer("_", "", " ", "").Replace(t))
+}
+
+// isList returns whether the property type is a list type.
+func isList(t string) bool {
+	n := normType(t)
+	return strings.HasPrefix(n, "LIST") || strings.HasSuffix(n, "ARRAY")
+}
+
+// ident converts a label, relationship type or property key to an exported Go
+// identifier e.g., "ACTED_IN" to "ActedIn" and "createdAt" to "CreatedAt".
+func ident(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, p := range parts {
+		rs := []rune(p)
+		if strings.ToUpper(p) == p {
+			rs = []rune(strings.ToLower(p))
+		}
+		rs[0] = unicode.ToUpper(rs[0])
+		b.WriteString(string(rs))
+	}
+	id := b.String()
+	if id == "" || unicode.IsDigit([]rune(id)[0]) {
+		id = "X" + id
+	}
+	return id
+}
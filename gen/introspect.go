@@ -0,0 +1,151 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gen
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/abc-inc/roland/graph"
+	"github.com/abc-inc/roland/graph/schema"
+	"github.com/abc-inc/roland/meta"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// typeProp is a row of db.schema.nodeTypeProperties or relTypeProperties.
+type typeProp struct {
+	names     []string
+	prop      string
+	types     []string
+	mandatory bool
+}
+
+// Introspect retrieves the labels, relationship types and their properties
+// from db.schema.nodeTypeProperties and db.schema.relTypeProperties, which
+// sample the data of the database, and marks the properties having a
+// uniqueness, node key or existence constraint, or an index, accordingly.
+// Unlike meta.FetchMetadata, it does not require APOC.
+//
+// Properties with different types in different nodes have an empty type. A
+// property is mandatory, if the procedure reports it to be present in all
+// nodes of a label combination, or if there is an existence constraint.
+func Introspect(c *graph.Conn) (m meta.Metadata, err error) {
+	const cypN = "CALL db.schema.nodeTypeProperties() " +
+		"YIELD nodeLabels, propertyName, propertyTypes, mandatory " +
+		"RETURN nodeLabels, propertyName, propertyTypes, mandatory"
+	const cypR = "CALL db.schema.relTypeProperties() " +
+		"YIELD relType, propertyName, propertyTypes, mandatory " +
+		"RETURN [relType], propertyName, propertyTypes, mandatory"
+
+	nps, _, err := graph.NewTemplate[typeProp](c).Query(graph.Request{Query: cypN}, mapTypeProp)
+	if err != nil {
+		return m, err
+	}
+	rps, _, err := graph.NewTemplate[typeProp](c).Query(graph.Request{Query: cypR}, mapTypeProp)
+	if err != nil {
+		return m, err
+	}
+	ex, err := schema.List(c)
+	if err != nil {
+		return m, err
+	}
+
+	nodes := make(map[string]*meta.Node)
+	for _, tp := range nps {
+		key := strings.Join(tp.names, ":")
+		n := nodes[key]
+		if n == nil {
+			n = &meta.Node{Type: "node", Labels: tp.names, Properties: make(map[string]meta.NodeProperty)}
+			nodes[key] = n
+		}
+		if tp.prop != "" {
+			n.Properties[tp.prop] = nodeProp(tp, ex, tp.names)
+		}
+	}
+	ks := maps.Keys(nodes)
+	sort.Strings(ks)
+	for _, k := range ks {
+		m.Nodes = append(m.Nodes, *nodes[k])
+	}
+
+	rels := make(map[string]*meta.Relationship)
+	for _, tp := range rps {
+		// relType is reported in the form :`TYPE`.
+		t := strings.ReplaceAll(strings.Trim(strings.TrimPrefix(tp.names[0], ":"), "`"), "``", "`")
+		r := rels[t]
+		if r == nil {
+			r = &meta.Relationship{Type: t, Properties: make(map[string]meta.RelProperty)}
+			rels[t] = r
+		}
+		if tp.prop != "" {
+			p := nodeProp(tp, ex, []string{t})
+			r.Properties[tp.prop] = meta.RelProperty{Indexed: p.Indexed, Existence: p.Existence, Type: p.Type}
+		}
+	}
+	ks = maps.Keys(rels)
+	sort.Strings(ks)
+	for _, k := range ks {
+		m.Rels = append(m.Rels, *rels[k])
+	}
+	return m, nil
+}
+
+// mapTypeProp maps a Record of the schema procedures to a typeProp.
+func mapTypeProp(rec *neo4j.Record) typeProp {
+	tp := typeProp{names: strs(rec.Values[0]), types: strs(rec.Values[2])}
+	tp.prop, _ = rec.Values[1].(string)
+	tp.mandatory, _ = rec.Values[3].(bool)
+	return tp
+}
+
+// nodeProp describes a property of the label or relationship type names,
+// including the indexes and constraints, which contain it.
+func nodeProp(tp typeProp, ex []schema.Existing, names []string) meta.NodeProperty {
+	p := meta.NodeProperty{Existence: tp.mandatory}
+	if len(tp.types) == 1 {
+		p.Type = tp.types[0]
+	}
+	for _, e := range ex {
+		if !slices.Contains(e.Props, tp.prop) || slices.IndexFunc(e.Labels, func(l string) bool {
+			return slices.Contains(names, l)
+		}) < 0 {
+			continue
+		}
+		switch e.Type {
+		case "UNIQUENESS", "RELATIONSHIP_UNIQUENESS":
+			p.Unique = p.Unique || len(e.Props) == 1
+		case "NODE_KEY", "RELATIONSHIP_KEY":
+			p.Unique, p.Existence = p.Unique || len(e.Props) == 1, true
+		case "NODE_PROPERTY_EXISTENCE", "RELATIONSHIP_PROPERTY_EXISTENCE":
+			p.Existence = true
+		default:
+			p.Indexed = true
+		}
+	}
+	return p
+}
+
+// strs converts a list of strings returned by the driver.
+func strs(v any) []string {
+	l, _ := v.([]any)
+	ss := make([]string, 0, len(l))
+	for _, e := range l {
+		s, _ := e.(string)
+		ss = append(ss, s)
+	}
+	return ss
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// GroupCount counts the nodes with the label of the Template grouped by the
+// value of the given property. The optional whereClause (without the WHERE
+// keyword) restricts the nodes e.g., "n.active = $active", and may refer to
+// the given params. Soft-deleted nodes are excluded, unless the Template
+// includes them.
+//
+// Nodes without the property are counted under the nil key. Values, which
+// cannot be used as map keys, such as lists, are converted to strings.
+func (t Template[T]) GroupCount(property, whereClause string, params map[string]any) (
+	map[any]int64, error) {
+
+	var conds []string
+	if whereClause != "" {
+		conds = append(conds, "("+whereClause+")")
+	}
+	cyp := "MATCH (n:" + labelExpr(t.labels) + ")" + t.live(conds...) +
+		" RETURN n." + Quote(property) + " AS k, count(*) AS c"
+	params = t.scoped(params)
+
+	var m map[any]int64
+	_, err := t.execute(Request{Query: cyp, Params: params}, func(res neo4j.Result) error {
+		m = make(map[any]int64)
+		for res.Next() {
+			k, c := res.Record().Values[0], res.Record().Values[1].(int64)
+			if k != nil && !reflect.TypeOf(k).Comparable() {
+				k = fmt.Sprint(k)
+			}
+			m[k] += c
+		}
+		return nil
+	})
+	return m, err
+}
+
+// CountQuery executes the Request, which returns a number in the first column,
+// and returns it as int64 e.g., "MATCH (:Person)-[r:KNOWS]->() RETURN
+// count(r)". Unlike QuerySingle, no Mapper is needed, and a query returning
+// no Record or null yields 0 instead of ErrEmpty. Further Records are
+// ignored. Unlike Count, which counts the nodes with the label of the
+// Template, it counts whatever the Request returns.
+func (t Template[T]) CountQuery(r Request) (int64, error) {
+	key, val, err := t.scalar(r)
+	if err != nil {
+		return 0, err
+	}
+	switch v := val.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return v, nil
+	}
+	return 0, &MappingError{Key: key, Err: &ConversionError{Value: val, Type: reflect.TypeOf(int64(0))}}
+}
+
+// ExistsQuery executes the Request and returns whether it returned a Record,
+// whose first value is neither false nor null e.g., "RETURN EXISTS { MATCH
+// (:Person {name: $name}) }" or "MATCH (p:Person {name: $name}) RETURN p
+// LIMIT 1". A query returning no Record yields false instead of ErrEmpty.
+// Like CountQuery, it is suffixed with Query to set it apart from the methods
+// operating on the nodes with the label of the Template, such as Count.
+func (t Template[T]) ExistsQuery(r Request) (bool, error) {
+	_, val, err := t.scalar(r)
+	if err != nil {
+		return false, err
+	} else if b, ok := val.(bool); ok {
+		return b, nil
+	}
+	return val != nil, nil
+}
+
+// Aggregate executes the Request, which returns a number in the first column,
+// and returns it as float64 e.g., "MATCH (m:Movie) RETURN avg(m.rating)".
+// A query returning no Record or null e.g., the average of no values, yields
+// 0 instead of ErrEmpty. Further Records are ignored.
+func (t Template[T]) Aggregate(r Request) (float64, error) {
+	key, val, err := t.scalar(r)
+	if err != nil {
+		return 0, err
+	}
+	switch v := val.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	}
+	return 0, &MappingError{Key: key, Err: &ConversionError{Value: val, Type: reflect.TypeOf(float64(0))}}
+}
+
+// scalar returns the key and the value of the first column of the first
+// Record returned for the Request, or nil, if there is none.
+func (t Template[T]) scalar(r Request) (key string, val any, err error) {
+	_, err = t.execute(r, func(res neo4j.Result) error {
+		if res.Next() && len(res.Record().Values) > 0 {
+			key, val = res.Record().Keys[0], res.Record().Values[0]
+		}
+		return nil
+	})
+	return key, val, err
+}
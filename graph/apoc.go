@@ -0,0 +1,80 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// ErrNoAPOC indicates that a procedure of the APOC library was called, but
+// APOC is not installed on the server.
+var ErrNoAPOC = errors.New("APOC is not available")
+
+// CreateNode creates a node with the given labels and properties using
+// apoc.create.node. Unlike string concatenation, the labels are passed as
+// parameters and cannot inject Cypher, which makes it safe to use labels
+// obtained from user input or configuration. If APOC is not installed,
+// ErrNoAPOC is returned.
+func (c *Conn) CreateNode(labels []string, props map[string]any) (neo4j.Node, error) {
+	if props == nil {
+		props = map[string]any{}
+	}
+	return c.callAPOC("apoc.create.node", labels, props)
+}
+
+// MergeNode is like CreateNode, but uses apoc.merge.node to match a node with
+// the given labels and identifying properties, or to create it otherwise.
+// Then, the given properties are set on the node, regardless of whether it
+// was created or matched. Like in CreateIfNotExists, the identifying values
+// are normalized.
+func (c *Conn) MergeNode(labels []string, identProps, props map[string]any) (neo4j.Node, error) {
+	if len(identProps) == 0 {
+		return neo4j.Node{}, errors.New("at least one identifying property is required")
+	}
+	if props == nil {
+		props = map[string]any{}
+	}
+	ident := make(map[string]any, len(identProps))
+	for k, v := range identProps {
+		var err error
+		if ident[k], err = normalizeKey(v); err != nil {
+			return neo4j.Node{}, fmt.Errorf("key %q: %w", k, err)
+		}
+	}
+	return c.callAPOC("apoc.merge.node", labels, ident, props, props)
+}
+
+// callAPOC calls the APOC procedure, which yields a single node.
+func (c *Conn) callAPOC(name string, labels []string, args ...any) (neo4j.Node, error) {
+	if len(labels) == 0 {
+		return neo4j.Node{}, errors.New("at least one label is required")
+	}
+	r := CallProcedure(name, append([]any{labels}, args...), "node")
+	r.Write = true
+
+	ns, _, err := NewTemplate[neo4j.Node](c).Query(r, NewSingleValueMapper[neo4j.Node](0))
+	var qerr *QueryError
+	if errors.As(err, &qerr) && qerr.Code() == "Neo.ClientError.Procedure.ProcedureNotFound" {
+		return neo4j.Node{}, fmt.Errorf("%w: %s", ErrNoAPOC, name)
+	} else if err != nil {
+		return neo4j.Node{}, err
+	} else if len(ns) == 0 {
+		return neo4j.Node{}, ErrEmpty
+	}
+	return ns[0], nil
+}
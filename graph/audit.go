@@ -0,0 +1,140 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// BeforeSaver is implemented by entities, which are prepared before they are
+// written by a Repository e.g., to validate or normalize them. If it returns
+// an error, the entity is not written.
+type BeforeSaver interface {
+	BeforeSave(ctx context.Context) error
+}
+
+// AfterLoader is implemented by entities, which are completed after they are
+// read by a Repository e.g., to compute derived fields.
+type AfterLoader interface {
+	AfterLoad(ctx context.Context) error
+}
+
+// BeforeDeleter is implemented by entities, which are checked before they are
+// deleted by a Repository. The entity is loaded before calling BeforeDelete.
+// If it returns an error, the node is not deleted.
+type BeforeDeleter interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+// principalKey is the context key of the principal.
+type principalKey struct{}
+
+// WithPrincipal returns a context, which holds the name of the user on whose
+// behalf entities are written. It is stored in fields tagged
+// `neo4j:",audit=createdBy"` or `neo4j:",audit=updatedBy"`.
+func WithPrincipal(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, principalKey{}, name)
+}
+
+// Principal returns the principal stored in the context, or an empty string.
+func Principal(ctx context.Context) string {
+	p, _ := ctx.Value(principalKey{}).(string)
+	return p
+}
+
+// Audit options of fields, which are populated by a Repository. Fields of type
+// time.Time or *time.Time tagged `neo4j:",audit=created"` and
+// `neo4j:",audit=updated"` receive the time, when the node is created and
+// written, respectively. The property key may be omitted along with the comma
+// e.g., `neo4j:"audit=created"`. String fields tagged `neo4j:",audit=createdBy"` and
+// `neo4j:",audit=updatedBy"` receive the Principal of the context instead.
+const (
+	AuditCreated   = "created"
+	AuditUpdated   = "updated"
+	AuditCreatedBy = "createdBy"
+	AuditUpdatedBy = "updatedBy"
+)
+
+// isCreated returns whether the field records the creation of a node.
+func (f field) isCreated() bool {
+	return f.audit == AuditCreated || f.audit == AuditCreatedBy
+}
+
+// beforeSave calls the BeforeSave hook of the entity v, which must be
+// addressable, and populates its audit fields. The fields recording the
+// creation are only populated, if the node is new.
+func beforeSave(ctx context.Context, v reflect.Value, fs []field, isNew bool) error {
+	if h, ok := v.Addr().Interface().(BeforeSaver); ok {
+		if err := h.BeforeSave(ctx); err != nil {
+			return err
+		}
+	}
+
+	now, p := time.Now(), Principal(ctx)
+	for _, f := range fs {
+		if f.audit == "" || f.isCreated() && !isNew {
+			continue
+		}
+		fv := v.FieldByIndex(f.index)
+		switch {
+		case f.audit == AuditCreatedBy || f.audit == AuditUpdatedBy:
+			if fv.Kind() == reflect.String {
+				fv.SetString(p)
+			}
+		case fv.Type() == reflect.TypeOf(now):
+			fv.Set(reflect.ValueOf(now))
+		case fv.Type() == reflect.TypeOf(&now):
+			t := now
+			fv.Set(reflect.ValueOf(&t))
+		}
+	}
+	return nil
+}
+
+// omitCreated removes the properties of audit fields recording the creation
+// from ps, unless they are set, so that they are not overwritten when writing
+// an existing node. It returns whether any property was removed.
+func omitCreated(v reflect.Value, fs []field, ps map[string]any) (map[string]any, bool) {
+	omitted := false
+	for _, f := range fs {
+		if f.isCreated() && v.FieldByIndex(f.index).IsZero() {
+			delete(ps, f.name)
+			omitted = true
+		}
+	}
+	return ps, omitted
+}
+
+// updateOp returns the operator for setting the properties of an existing
+// node. If properties recording the creation were omitted, they are merged
+// even with WriteAll, because replacing the properties would remove them.
+// Since WriteAll passes nulls, the properties of all other fields are still
+// replaced, but properties, which are not mapped to a field, are kept.
+func updateOp(p NullPolicy, omitted bool) string {
+	if omitted {
+		return "+="
+	}
+	return p.setOp()
+}
+
+// afterLoad calls the AfterLoad hook of the entity, if it implements it.
+func afterLoad(ctx context.Context, e any) error {
+	if h, ok := e.(AfterLoader); ok {
+		return h.AfterLoad(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// DefaultBatchSize is the number of rows written per statement, unless the
+// Conn specifies a different BatchSize.
+const DefaultBatchSize = 1000
+
+// BatchMode controls how batch operations handle rows, which cannot be written.
+type BatchMode int
+
+const (
+	// FailFast aborts the operation on the first failing chunk. This is the
+	// default. All chunks are written in a single Transaction, which is rolled
+	// back as a whole, hence, either all rows are written or none.
+	FailFast BatchMode = iota
+	// CollectErrors writes a failing chunk row by row, and reports the rows,
+	// which still fail, in a BatchError after all other rows were written.
+	CollectErrors
+)
+
+// RowError is the error of a single row of a batch operation.
+type RowError struct {
+	Index int
+	Err   error
+}
+
+// Error returns the index and the error of the row.
+func (e RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e RowError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError holds the errors of all rows, which could not be written.
+type BatchError []RowError
+
+// Error returns the number of failed rows and the first error.
+func (e BatchError) Error() string {
+	return fmt.Sprintf("%d rows failed, first: %v", len(e), e[0])
+}
+
+// Unwrap returns the errors of the rows.
+func (e BatchError) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, re := range e {
+		errs[i] = re
+	}
+	return errs
+}
+
+// Is reports whether the error of any row matches the target, so that
+// errors.Is considers all rows even with Go 1.19, which does not follow
+// Unwrap() []error.
+func (e BatchError) Is(target error) bool {
+	return anyIs(e.Unwrap(), target)
+}
+
+// As finds the first row error, which matches the target, like errors.As.
+func (e BatchError) As(target any) bool {
+	return anyAs(e.Unwrap(), target)
+}
+
+// runBatch splits the row indices into chunks of the given size and calls fn
+// for each chunk. In CollectErrors mode, a failing chunk is retried row by
+// row, and the errors are returned as BatchError after all chunks have been
+// processed.
+func runBatch(idxs []int, size int, mode BatchMode, fn func(chunk []int) error) error {
+	var errs BatchError
+	for start := 0; start < len(idxs); start += size {
+		chunk := idxs[start:min(start+size, len(idxs))]
+		err := fn(chunk)
+		if err == nil {
+			continue
+		} else if mode != CollectErrors {
+			return err
+		}
+
+		for _, i := range chunk {
+			if err = fn([]int{i}); err != nil {
+				errs = append(errs, RowError{Index: i, Err: err})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// batchSize returns the configured BatchSize or DefaultBatchSize.
+func (c *Conn) batchSize() int {
+	if c.BatchSize > 0 {
+		return c.BatchSize
+	}
+	return DefaultBatchSize
+}
+
+// min returns the smaller of a and b.
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// InTransactions executes the subquery in batches of the given number of rows
+// using CALL { ... } IN TRANSACTIONS, which requires Neo4j 4.4 or later.
+// The query of the Request produces the rows e.g., "UNWIND $rows AS row" or
+// "MATCH (n:Obsolete)", and the subquery imports them e.g., "WITH n DETACH
+// DELETE n". The statement is executed as a single auto-commit transaction,
+// which commits each batch separately. Hence, it must not be called while the
+// Conn has an active Transaction. The Counters of all batches are returned.
+// The number of rows per batch must be positive.
+func (c *Conn) InTransactions(r Request, subquery string, rows int) (cnt Counters, err error) {
+	if rows <= 0 {
+		return cnt, errors.New("rows must be positive")
+	} else if c.Tx != nil {
+		return cnt, errors.New("CALL IN TRANSACTIONS cannot be used in an explicit transaction")
+	}
+	major, minor, err := c.ServerVersion()
+	if err != nil {
+		return cnt, err
+	} else if major < 4 || major == 4 && minor < 4 {
+		return cnt, fmt.Errorf("CALL IN TRANSACTIONS requires Neo4j 4.4 or later, got %d.%d", major, minor)
+	}
+
+	cyp := fmt.Sprintf("%s CALL { %s } IN TRANSACTIONS OF %d ROWS", r.Query, subquery, rows)
+	if err = c.checkReadOnly(cyp); err != nil {
+		return cnt, err
+	}
+	sess := c.Session()
+	defer func() { _ = sess.Close() }()
+
+	lr := Request{Query: cyp, Name: r.QueryName(), Metadata: r.Metadata}
+	c.logQuery(lr)
+	rr := lr
+	rr.Query, rr.Params = c.cypher(cyp), c.params(r.Params)
+	var sum neo4j.ResultSummary
+	finish := c.instrument(context.Background(), lr)
+	defer func() { finish(0, sum, err) }()
+	res, err := c.run(context.Background(), rr, func(cyp string, params map[string]any) (neo4j.Result, error) {
+		return sess.Run(cyp, params, c.txConfig(r)...)
+	})
+	if err != nil {
+		return cnt, wrapErr(cyp, err)
+	}
+	if sum, err = res.Consume(); err != nil {
+		return cnt, wrapErr(cyp, err)
+	}
+	cnt.Add(sum)
+	c.logSlow(lr, sum)
+	c.setBookmark(sess)
+	return cnt, nil
+}
+
+// ServerVersion returns the major and minor version of the Neo4j server.
+func (c *Conn) ServerVersion() (major, minor int, err error) {
+	const cyp = "CALL dbms.components() YIELD versions RETURN versions[0]"
+	sess := c.Session()
+	defer func() { _ = sess.Close() }()
+
+	res, err := sess.Run(cyp, nil)
+	if err != nil {
+		return 0, 0, wrapErr(cyp, err)
+	}
+	rec, err := res.Single()
+	if err != nil {
+		return 0, 0, wrapErr(cyp, err)
+	}
+
+	v, _ := rec.Values[0].(string)
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("invalid server version %q", v)
+	}
+	if major, err = strconv.Atoi(parts[0]); err == nil {
+		minor, err = strconv.Atoi(parts[1])
+	}
+	return major, minor, err
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"reflect"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// BindMapper creates a new Mapper that populates the fields of a struct from
+// the keys of each Record and the properties of the Nodes, Relationships and
+// maps therein. Hence, both "RETURN p" and "RETURN p.name AS name" can be
+// mapped to the same struct, as well as a combination of both e.g.,
+// "RETURN p, count(f) AS friends".
+//
+// A field is assigned the value of the key, which equals its property key.
+// If there is no such key, the properties of all entity columns, which are not
+// themselves assigned to a field, are searched in order. Nested structs and
+// pointers to structs are populated from Nodes, Relationships and maps like in
+// NewStructMapper.
+func BindMapper[T any]() Mapper[T] {
+	return BindMapperWith[T](Decoder{})
+}
+
+// BindMapperWith is like BindMapper, but uses the given Decoder.
+func BindMapperWith[T any](d Decoder) Mapper[T] {
+	fs := fields(reflect.TypeOf(new(T)))
+	return func(rec *neo4j.Record) (t T) {
+		get, keys := bind(rec, fs)
+		if err := d.decodeFunc(get, keys, reflect.ValueOf(&t).Elem(), fs); err != nil {
+			panic(err)
+		}
+		return t
+	}
+}
+
+// QueryInto is like Query, but maps each Record with a BindMapper, which uses
+// the Decoder of the Template.
+func (t Template[T]) QueryInto(r Request) ([]T, neo4j.ResultSummary, error) {
+	return t.Query(r, BindMapperWith[T](t.dec))
+}
+
+// bind returns a lookup function, which resolves a key from the Record or
+// from the properties of its unbound entity columns, and all resolvable keys.
+func bind(rec *neo4j.Record, fs []field) (func(key string) (any, bool), []string) {
+	var ents []map[string]any
+	var keys []string
+	seen := make(map[string]bool)
+	for i, k := range rec.Keys {
+		if !hasField(fs, k) && isEntity(rec.Values[i]) {
+			ents = append(ents, entityProps(rec.Values[i]))
+			continue
+		}
+		keys, seen[k] = append(keys, k), true
+	}
+	for _, props := range ents {
+		for k := range props {
+			if !seen[k] {
+				keys, seen[k] = append(keys, k), true
+			}
+		}
+	}
+
+	return func(key string) (any, bool) {
+		if v, ok := rec.Get(key); ok {
+			return v, true
+		}
+		for _, props := range ents {
+			if v, ok := props[key]; ok {
+				return v, true
+			}
+		}
+		return nil, false
+	}, keys
+}
@@ -0,0 +1,174 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"sync"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"golang.org/x/exp/slices"
+)
+
+// bookmarks holds the bookmarks of the last Transactions committed by a Conn.
+// Passing them to new Sessions ensures that they observe all previous writes,
+// even if they are routed to a different member of a cluster.
+type bookmarks struct {
+	mu   sync.Mutex
+	last []string
+}
+
+// get returns the bookmarks to pass to a new Session.
+func (b *bookmarks) get() []string {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.last)
+}
+
+// set records the bookmark of a Transaction committed in a Session, which
+// started with the bookmarks prev (see mergeBookmarks).
+func (b *bookmarks) set(prev []string, bm string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.last = mergeBookmarks(b.last, prev, bm)
+}
+
+// mergeBookmarks replaces the bookmarks prev, which a Session started with,
+// by the bookmark bm of the Transaction committed in it. The bookmarks added
+// by other Sessions in the meantime are kept, so that concurrent Sessions do
+// not discard each other's bookmarks.
+func mergeBookmarks(cur, prev []string, bm string) []string {
+	bms := make([]string, 0, len(cur)+1)
+	for _, c := range cur {
+		if !slices.Contains(prev, c) && c != bm {
+			bms = append(bms, c)
+		}
+	}
+	return append(bms, bm)
+}
+
+// bookmarkSession is a Session, which remembers the bookmarks it started with.
+type bookmarkSession struct {
+	neo4j.Session
+	initial []string
+}
+
+// committed returns the bookmark of the last Transaction committed in the
+// Session, the bookmarks it started with, and whether a Transaction was
+// committed at all. Otherwise, the driver reports the last initial bookmark.
+func committed(sess neo4j.Session) (bm string, prev []string, ok bool) {
+	if bs, isBS := sess.(*bookmarkSession); isBS {
+		prev = bs.initial
+	}
+	bm = sess.LastBookmark()
+	return bm, prev, bm != "" && !slices.Contains(prev, bm)
+}
+
+// BookmarkStore holds the bookmarks of the last Transaction committed in each
+// database. Sharing a BookmarkStore among Conns, or among the instances of an
+// application using an external store, such as Redis, ensures that reads
+// observe previous writes of all of them i.e., read-after-write consistency
+// across requests served by different instances.
+//
+// When a Transaction is committed, the Conn loads the bookmarks, replaces the
+// ones, which its Session started with, by the new bookmark, and stores the
+// result. Bookmarks of other Sessions are kept, since they may not have been
+// observed by the Session. A BookmarkStore backed by Redis only needs to get
+// and set a key per database:
+//
+//	func (s RedisStore) Load(db string) ([]string, error) {
+//		bms, err := s.Client.Get(ctx, "bookmarks:"+db).Result()
+//		if errors.Is(err, redis.Nil) {
+//			return nil, nil
+//		}
+//		return strings.Fields(bms), err
+//	}
+//
+//	func (s RedisStore) Store(db string, bms []string) error {
+//		return s.Client.Set(ctx, "bookmarks:"+db, strings.Join(bms, " "), 0).Err()
+//	}
+type BookmarkStore interface {
+	// Load returns the bookmarks to pass to new Sessions of the database.
+	Load(db string) ([]string, error)
+	// Store replaces the bookmarks of the database.
+	Store(db string, bms []string) error
+}
+
+// MemoryBookmarkStore is a BookmarkStore, which holds the bookmarks in memory.
+// It allows Conns of the same process e.g., derived by WithRoutingContext, to
+// share bookmarks. Its zero value is ready to use.
+type MemoryBookmarkStore struct {
+	mu  sync.Mutex
+	bms map[string][]string
+}
+
+// Load returns the bookmarks of the database.
+func (s *MemoryBookmarkStore) Load(db string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bms[db], nil
+}
+
+// Store replaces the bookmarks of the database.
+func (s *MemoryBookmarkStore) Store(db string, bms []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bms == nil {
+		s.bms = make(map[string][]string)
+	}
+	s.bms[db] = bms
+	return nil
+}
+
+// lastBookmarks returns the bookmarks to pass to a new Session. If the
+// BookmarkStore of the Conn fails, a warning is logged and no bookmarks are
+// passed, which may cause stale reads, but does not fail the query.
+func (c *Conn) lastBookmarks() []string {
+	if c.Bookmarks == nil {
+		return c.bms.get()
+	}
+	bms, err := c.Bookmarks.Load(c.DBName)
+	if err != nil && c.Logger != nil {
+		c.Logger.Warnf("cannot load bookmarks of database %q: %v", c.DBName, err)
+	}
+	return bms
+}
+
+// setBookmark records the bookmark of the last Transaction committed in the
+// Session, which must be closed afterwards. If no Transaction was committed
+// e.g., because it was rolled back, the bookmarks are left unchanged, so that
+// newer bookmarks of other Conns sharing the BookmarkStore are not
+// overwritten. If the BookmarkStore of the Conn fails, a warning is logged.
+func (c *Conn) setBookmark(sess neo4j.Session) {
+	bm, prev, ok := committed(sess)
+	if !ok {
+		return
+	} else if c.Bookmarks == nil {
+		c.bms.set(prev, bm)
+		return
+	}
+	cur, err := c.Bookmarks.Load(c.DBName)
+	if err == nil {
+		err = c.Bookmarks.Store(c.DBName, mergeBookmarks(cur, prev, bm))
+	}
+	if err != nil && c.Logger != nil {
+		c.Logger.Warnf("cannot store bookmark of database %q: %v", c.DBName, err)
+	}
+}
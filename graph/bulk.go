@@ -0,0 +1,83 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// SaveAll writes the entities as nodes with the label of the Template in
+// chunks of BatchSize rows using UNWIND. The Counters of all chunks are
+// aggregated. With FailFast, all chunks are written in one Transaction, or in
+// the active Transaction of the Conn, so that nothing is written, if a chunk
+// fails. With CollectErrors, each chunk is written in its own Transaction.
+//
+// Without keys, a node is created for every entity. Otherwise, nodes are
+// merged on the given key properties and their properties are set according
+// to the NullPolicy of the Template, which makes SaveAll an upsert. Failing
+// chunks are handled according to the BatchMode of the Conn, like in
+// RelateBatch.
+func (t Template[T]) SaveAll(entities []T, keys ...string) (cnt Counters, err error) {
+	fs := fields(reflect.TypeOf(entities).Elem())
+	rows := make([]map[string]any, len(entities))
+	idxs := make([]int, len(entities))
+	for i := range entities {
+		rows[i], idxs[i] = props(reflect.ValueOf(entities[i]), fs, t.nulls), i
+		for _, k := range keys {
+			if rows[i][k] == nil {
+				return cnt, fmt.Errorf("row %d: key %q is not set", i, k)
+			}
+		}
+	}
+
+	cyp := "UNWIND $rows AS row CREATE (n:" + labelExpr(t.labels) + ") SET n = row"
+	if len(keys) > 0 {
+		conds := make([]string, len(keys))
+		for i, k := range keys {
+			conds[i] = Quote(k) + ": row." + Quote(k)
+		}
+		cyp = fmt.Sprintf("UNWIND $rows AS row MERGE (n:%s {%s}) SET n %s row",
+			labelExpr(t.labels), strings.Join(conds, ", "), t.nulls.setOp())
+	}
+
+	mode := t.conn.BatchMode
+	if t.conn.Tx != nil {
+		mode = FailFast
+	}
+	write := func() error {
+		cnt = Counters{}
+		return runBatch(idxs, t.conn.batchSize(), mode, func(chunk []int) error {
+			params := make([]any, len(chunk))
+			for j, i := range chunk {
+				params[j] = rows[i]
+			}
+			sum, err := t.execute(Request{Query: cyp, Params: map[string]any{"rows": params}, Write: true}, discard)
+			if err == nil {
+				cnt.Add(sum)
+			}
+			return err
+		})
+	}
+	if mode != FailFast {
+		return cnt, write()
+	} else if err = t.conn.inTx(Request{Query: cyp, Write: true}, neo4j.AccessModeWrite, write); err != nil {
+		return Counters{}, err
+	}
+	return cnt, nil
+}
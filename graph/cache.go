@@ -0,0 +1,203 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResultCache stores serialized query results. Implementations must be safe
+// for concurrent use. LRUCache is an in-process implementation. A shared
+// cache e.g., Redis, can be plugged in by mapping the methods to SET with
+// expiry, GET and SCAN with DEL:
+//
+//	func (c redisCache) Get(key string) ([]byte, bool) {
+//		b, err := c.rdb.Get(ctx, "roland:"+key).Bytes()
+//		return b, err == nil
+//	}
+//
+//	func (c redisCache) Set(key string, value []byte, ttl time.Duration) {
+//		c.rdb.Set(ctx, "roland:"+key, value, ttl)
+//	}
+//
+//	func (c redisCache) Invalidate(prefix string) {
+//		it := c.rdb.Scan(ctx, 0, "roland:"+prefix+"*", 100).Iterator()
+//		for it.Next(ctx) {
+//			c.rdb.Del(ctx, it.Val())
+//		}
+//	}
+type ResultCache interface {
+	// Get returns the value stored for the key, unless it has expired.
+	Get(key string) ([]byte, bool)
+	// Set stores the value for the key, which expires after the ttl.
+	Set(key string, value []byte, ttl time.Duration)
+	// Invalidate removes all values, whose key starts with the prefix.
+	Invalidate(prefix string)
+}
+
+// CachedQuery is like Query, but the mapped results are served from the
+// ResultCache of the Conn, if a previous call with the same Cypher and
+// parameters was executed within the ttl. Otherwise, the query is executed
+// and the results are stored in the cache, encoded as JSON. Hence, T must
+// survive a round trip through encoding/json.
+//
+// Keys start with the label of the Template followed by a colon, so that all
+// results of a Template can be invalidated with Conn.InvalidateCache after
+// writing. If the Conn has no ResultCache, CachedQuery behaves like Query.
+// The cache is bypassed within an explicit Transaction and in dry-run mode,
+// because the results may contain uncommitted changes or be empty.
+func (t Template[T]) CachedQuery(r Request, m Mapper[T], ttl time.Duration) ([]T, error) {
+	c := t.conn.Cache
+	if c == nil || t.conn.Tx != nil || t.conn.DryRun {
+		list, _, err := t.Query(r, m)
+		return list, err
+	}
+
+	key, err := t.cacheKey(r)
+	if err != nil {
+		return nil, err
+	}
+	var list []T
+	if val, ok := c.Get(key); ok && json.Unmarshal(val, &list) == nil {
+		return list, nil
+	}
+
+	if list, _, err = t.Query(r, m); err != nil {
+		return nil, err
+	}
+	if val, err := json.Marshal(list); err == nil {
+		c.Set(key, val, ttl)
+	}
+	return list, nil
+}
+
+// cacheKey returns the key of the Request consisting of the label of the
+// Template and the hash of the Cypher and the parameters. Encrypted fields
+// are hashed in their encrypted form, so that only deterministically
+// encrypted ones yield the same key for equal values.
+func (t Template[T]) cacheKey(r Request) (string, error) {
+	ps, err := EncryptParams(t.params(r.Params))
+	if err != nil {
+		return "", err
+	}
+	params, err := json.Marshal(ps)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(r.Query))
+	h.Write([]byte{0})
+	h.Write(params)
+	return t.label + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// InvalidateCache removes all cached results, whose key starts with the
+// prefix e.g., the label of a Template followed by a colon. An empty prefix
+// removes all results. It does nothing if the Conn has no ResultCache.
+func (c *Conn) InvalidateCache(prefix string) {
+	if c.Cache != nil {
+		c.Cache.Invalidate(prefix)
+	}
+}
+
+// LRUCache is an in-process ResultCache, which evicts the least recently used
+// values, when it exceeds the maximum number of entries or bytes. Expired
+// values are removed, when they are accessed or evicted.
+type LRUCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int
+	size       int
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+// lruEntry is a value stored in a LRUCache.
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRUCache creates a new LRUCache, which holds up to maxEntries values and
+// maxBytes bytes of values. A limit, which is not positive, is not enforced.
+func NewLRUCache(maxEntries, maxBytes int) *LRUCache {
+	return &LRUCache{maxEntries: maxEntries, maxBytes: maxBytes, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Get returns the value stored for the key, unless it has expired.
+func (c *LRUCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	} else if e := el.Value.(*lruEntry); time.Now().After(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruEntry).value, true
+}
+
+// Set stores the value for the key, which expires after the ttl, and evicts
+// the least recently used values, if the limits are exceeded. Values larger
+// than maxBytes are not stored.
+func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	if c.maxBytes > 0 && len(value) > c.maxBytes {
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expires: time.Now().Add(ttl)})
+	c.size += len(value)
+	for c.maxEntries > 0 && c.ll.Len() > c.maxEntries || c.maxBytes > 0 && c.size > c.maxBytes {
+		c.remove(c.ll.Back())
+	}
+}
+
+// Invalidate removes all values, whose key starts with the prefix.
+func (c *LRUCache) Invalidate(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, el := range c.items {
+		if strings.HasPrefix(k, prefix) {
+			c.remove(el)
+		}
+	}
+}
+
+// Len returns the number of stored values, including expired ones.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// remove removes the element from the list and the map.
+func (c *LRUCache) remove(el *list.Element) {
+	e := c.ll.Remove(el).(*lruEntry)
+	delete(c.items, e.key)
+	c.size -= len(e.value)
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// TxIDKey is the key of the transaction metadata, which identifies
+// Transactions that can be terminated server-side, and which holds the
+// correlation ID of a Summary.
+const TxIDKey = "roland.txId"
+
+// newTxID generates a random ID to be stored in the transaction metadata.
+func newTxID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// watch terminates the Transaction with the given ID server-side, if the
+// context is done before the returned function is called.
+//
+// Cancelling a context alone only stops the client from pulling Records.
+// Termination makes the server abort the running statement and release its
+// resources. This is best-effort: in a cluster, the termination is only
+// effective if it reaches the member executing the Transaction, and it fails
+// if the user is not allowed to terminate transactions.
+func (c *Conn) watch(ctx context.Context, id string) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.terminate(id)
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// terminate terminates the Transaction with the given ID server-side.
+// It uses TERMINATE TRANSACTIONS (Neo4j 4.4 and later) and falls back to
+// dbms.killTransaction, if the former is not supported.
+func (c *Conn) terminate(id string) error {
+	const cypShow = "SHOW TRANSACTIONS YIELD transactionId, metaData " +
+		"WHERE metaData[$key] = $id RETURN collect(transactionId) AS ids"
+	const cypTerm = "TERMINATE TRANSACTIONS $ids"
+	const cypKill = "CALL dbms.listTransactions() YIELD transactionId, metaData " +
+		"WHERE metaData[$key] = $id " +
+		"CALL dbms.killTransaction(transactionId) YIELD message RETURN message"
+
+	sess := c.Session()
+	defer func() { _ = sess.Close() }()
+
+	params := map[string]any{"key": TxIDKey, "id": id}
+	res, err := sess.Run(cypShow, params)
+	if err == nil {
+		var rec *neo4j.Record
+		if rec, err = res.Single(); err == nil {
+			ids := rec.Values[0].([]any)
+			if len(ids) == 0 {
+				return nil
+			}
+			if res, err = sess.Run(cypTerm, map[string]any{"ids": ids}); err == nil {
+				_, err = res.Consume()
+				return err
+			}
+		}
+	}
+
+	if res, err = sess.Run(cypKill, params); err != nil {
+		return err
+	}
+	_, err = res.Consume()
+	return err
+}
@@ -16,8 +16,13 @@ package graph
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/abc-inc/roland/plan"
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"golang.org/x/exp/maps"
 )
 
 const SystemDB = "system"
@@ -26,13 +31,127 @@ const SystemDB = "system"
 var defConn *Conn
 
 // Conn represents a database connection, which can open multiple Sessions.
+//
+// Sessions created by a Conn start from the bookmark of the last Transaction
+// committed by the Conn. Hence, reads observe previous writes of the same Conn
+// (and all Templates using it), even in a cluster. This does not apply to
+// other Conns, unless they share the same driver and bookmarks explicitly
+// e.g., using a BookmarkStore.
 type Conn struct {
 	Driver neo4j.Driver
 	user   string
 	auth   neo4j.AuthToken
+	opts   []func(config *neo4j.Config)
+	bms    *bookmarks
+	sess   neo4j.Session
 	DBName string
 	Tx     neo4j.Transaction
+	// Params holds parameters, which are added to every query executed by a
+	// Template, unless the query provides a parameter with the same name.
 	Params map[string]any
+	// Strict enables additional consistency checks, which are helpful during
+	// development, but add a small overhead to every query.
+	Strict bool
+	// BatchSize is the maximum number of rows written by a single statement.
+	// If it is not positive, DefaultBatchSize is used.
+	BatchSize int
+	// BatchMode controls whether batch operations stop at the first failure
+	// or report the rows, which could not be written, at the end.
+	BatchMode BatchMode
+	// FetchSize defines how many records are pulled from the server in each
+	// batch. See neo4j.SessionConfig for details.
+	FetchSize int
+	// DryRun prevents queries from being executed by Templates. Instead, they
+	// are planned using EXPLAIN, which surfaces syntax and semantic errors, and
+	// empty results are returned.
+	DryRun bool
+	// Logger receives log messages. If it is nil, nothing is logged.
+	Logger Logger
+	// SlowQueryThreshold is the duration, after which a query is considered
+	// slow and logged at warn level. If it is not positive, nothing is logged.
+	SlowQueryThreshold time.Duration
+	// ReadOnly rejects queries, which contain write clauses such as CREATE,
+	// MERGE, SET, DELETE or REMOVE, or call procedures known to write, with
+	// ErrReadOnly before they are executed. Sessions are created in read mode.
+	// The detection is best-effort, so access control must still be enforced
+	// by the server e.g., using a user with read-only privileges.
+	ReadOnly bool
+	// CheckCartesian plans every query executed by a Template with EXPLAIN and
+	// logs a warning, if the plan contains a cartesian product, which is often
+	// introduced unintentionally by disconnected MATCH patterns. Since it
+	// doubles the number of queries, it is meant for development only.
+	CheckCartesian bool
+	// PlanWarning is called by Template.Explain and Template.Profile for each
+	// operation of the plan, whose operator is listed in PlanWarnings, e.g., to
+	// fail tests of queries, which lack an index. If it is nil, plans are not
+	// checked.
+	PlanWarning func(r Request, op *plan.Op)
+	// Retry controls, which failed Transactions are retried by Templates.
+	// By default, nothing is retried.
+	Retry RetryPolicy
+	// Cache stores the results of Template.CachedQuery. If it is nil, results
+	// are not cached.
+	Cache ResultCache
+	// Instrumentation observes the queries executed by Templates e.g., to
+	// trace them. If it is nil, queries are not observed.
+	Instrumentation Instrumentation
+	// Interceptors wrap the execution of the queries of Templates, the first
+	// one being the outermost. See Interceptor.
+	Interceptors []Interceptor
+	// LabelNaming derives the labels of entity types from their names e.g.,
+	// SnakeCase, or a function adding a prefix. It does not apply to types
+	// implementing Labeler or declaring their labels in a tag. If it is nil,
+	// TitleCase is used. It should be set before Templates are created.
+	LabelNaming NamingStrategy
+	// FailOn turns Notifications of the given categories into errors e.g.,
+	// CategoryUnrecognized to catch misspelled labels in tests. Templates
+	// return a NotificationError instead of committing the Transaction
+	// created for the query.
+	FailOn []NotificationCategory
+	// Tenancy separates the data of tenants in Repositories. If it is not nil,
+	// Repositories refuse to write without a tenant. See Tenancy.
+	Tenancy *Tenancy
+	// Metadata is attached to all Transactions created by the Conn e.g., the
+	// name of the application under MetaApp, so that administrators can tell
+	// which application is responsible for a Transaction. The Metadata of a
+	// Request or a context (see WithTxMetadata) takes precedence.
+	Metadata map[string]any
+	// Bookmarks holds the bookmarks passed to new Sessions, which is shared
+	// with other Conns or application instances to extend causal consistency
+	// to them. If it is nil, the Conn keeps the bookmarks of its last
+	// Transactions in memory.
+	Bookmarks   BookmarkStore
+	timeout     time.Duration
+	mode        *neo4j.AccessMode
+	impersonate string
+	readers     *readers
+	metrics     *metrics
+	// rollbackOnly marks the current Transaction to be rolled back by
+	// WithinTx, because nested work failed.
+	rollbackOnly bool
+}
+
+// WithDefaultTimeout sets the timeout of all Transactions created by the Conn,
+// unless a Request specifies its own Timeout. The server terminates
+// Transactions running longer than that. If d is not positive, the timeout
+// configured on the server applies. It returns the Conn for convenience.
+func (c *Conn) WithDefaultTimeout(d time.Duration) *Conn {
+	c.timeout = d
+	return c
+}
+
+// txConfig returns the configuration of Transactions created for the Request.
+// The Metadata of the Request takes precedence over the one of the Conn.
+func (c *Conn) txConfig(r Request) (cfg []func(*neo4j.TransactionConfig)) {
+	if meta := mergeParams(r.Metadata, c.Metadata); len(meta) > 0 {
+		cfg = append(cfg, neo4j.WithTxMetadata(meta))
+	}
+	if r.Timeout > 0 {
+		cfg = append(cfg, neo4j.WithTxTimeout(r.Timeout))
+	} else if c.timeout > 0 {
+		cfg = append(cfg, neo4j.WithTxTimeout(c.timeout))
+	}
+	return cfg
 }
 
 // IsConnected returns whether the database connection is established.
@@ -60,11 +179,14 @@ func NewConn(addr string, user string, auth neo4j.AuthToken, dbName string,
 
 	defConn = nil
 	conn := &Conn{
-		Driver: d,
-		user:   user,
-		auth:   auth,
-		DBName: dbName,
-		Params: make(map[string]any),
+		Driver:  d,
+		user:    user,
+		auth:    auth,
+		opts:    opts,
+		bms:     &bookmarks{},
+		metrics: &metrics{},
+		DBName:  dbName,
+		Params:  make(map[string]any),
 	}
 
 	err = conn.UseDB(dbName)
@@ -74,39 +196,205 @@ func NewConn(addr string, user string, auth neo4j.AuthToken, dbName string,
 	return conn, err
 }
 
-// Close the driver and all underlying connections.
-func (c *Conn) Close() (err error) {
+// WithRoutingContext creates a new Conn with its own driver, which sends the
+// given routing context to the cluster e.g., to apply server policies that
+// prefer servers in a nearby region. Keys already present in the URI are
+// overridden. The routing context requires a neo4j:// URI; direct bolt://
+// connections are rejected.
+func (c *Conn) WithRoutingContext(rc map[string]string) (*Conn, error) {
+	u := c.Driver.Target()
+	if !strings.HasPrefix(u.Scheme, "neo4j") {
+		return nil, fmt.Errorf("routing context is not supported by %s:// URIs", u.Scheme)
+	}
+
+	q := u.Query()
+	for k, v := range rc {
+		q.Set(k, v)
+	}
+	u.RawQuery = q.Encode()
+
+	d, err := neo4j.NewDriver(u.String(), c.auth, c.opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := c.derive()
+	conn.Driver = d
+	return conn, nil
+}
+
+// WithDatabase returns a Conn, which shares the driver of c, but opens its
+// Sessions against the given database. Since bookmarks are specific to a
+// database, it keeps its own ones.
+//
+// Conns derived by WithDatabase, WithAccessMode, WithImpersonation and
+// WithFetchSize are cheap and may be used concurrently with c. Because they
+// share the driver, closing any of them closes all of them; hence, only the
+// original Conn should be closed.
+func (c *Conn) WithDatabase(dbName string) *Conn {
+	conn := c.derive()
+	conn.DBName = dbName
+	conn.bms = &bookmarks{}
+	return conn
+}
+
+// WithAccessMode returns a Conn, which shares the driver of c, but opens all
+// Sessions with the given access mode, regardless of the mode requested by a
+// Template e.g., to route all queries to read replicas in a cluster. Write
+// queries fail in read mode then. ReadOnly takes precedence.
+func (c *Conn) WithAccessMode(mode neo4j.AccessMode) *Conn {
+	conn := c.derive()
+	conn.mode = &mode
+	return conn
+}
+
+// WithImpersonation returns a Conn, which shares the driver of c, but
+// executes all queries as the given user, whose privileges apply then. The
+// authenticated user requires the IMPERSONATE privilege. An empty user
+// disables impersonation. It requires Neo4j 4.4 or later.
+func (c *Conn) WithImpersonation(user string) *Conn {
+	conn := c.derive()
+	conn.impersonate = user
+	return conn
+}
+
+// WithFetchSize returns a Conn, which shares the driver of c, but pulls the
+// given number of records in each batch. See FetchSize for details.
+func (c *Conn) WithFetchSize(n int) *Conn {
+	conn := c.derive()
+	conn.FetchSize = n
+	return conn
+}
+
+// WithSlowQueryThreshold returns a Conn, which shares the driver of c, but
+// logs queries taking longer than d at warn level. See SlowQueryThreshold for
+// details.
+func (c *Conn) WithSlowQueryThreshold(d time.Duration) *Conn {
+	conn := c.derive()
+	conn.SlowQueryThreshold = d
+	return conn
+}
+
+// Clone returns a Conn, which shares the driver and the bookmarks of c, but
+// not its current Transaction. Since a Conn holds at most one Transaction, it
+// allows concurrent goroutines e.g., HTTP requests, to use Transactions of
+// their own. Like derived Conns, it must not be closed.
+func (c *Conn) Clone() *Conn {
+	return c.derive()
+}
+
+// derive returns a copy of the Conn without the current Transaction, which
+// shares the driver and the bookmarks of c.
+func (c *Conn) derive() *Conn {
+	conn := *c
+	conn.sess, conn.Tx, conn.rollbackOnly = nil, nil, false
+	conn.Params = maps.Clone(c.Params)
+	return &conn
+}
+
+// Close the driver, the drivers of the readers, if any, and all underlying
+// connections. If one of them cannot be closed, the others are closed anyway,
+// and all errors are returned.
+func (c *Conn) Close() error {
+	var errs []error
+	if c.readers != nil {
+		if err := c.readers.close(); err != nil {
+			errs = append(errs, err)
+		}
+		c.readers = nil
+	}
 	if c.Driver != nil {
-		if err = c.Driver.Close(); err == nil {
-			c.Driver, c.Tx = nil, nil
+		if err := c.Driver.Close(); err != nil {
+			errs = append(errs, err)
+		} else {
+			c.Driver, c.sess, c.Tx = nil, nil, nil
 			c.Params = make(map[string]any)
 			c.DBName = ""
 		}
 	}
-	return err
+	return joinErrs(errs)
 }
 
-// Session creates a new Session.
+// Session creates a new Session in write mode.
 func (c *Conn) Session() neo4j.Session {
-	cfg := neo4j.SessionConfig{DatabaseName: c.DBName}
-	return c.Driver.NewSession(cfg)
+	return c.SessionMode(neo4j.AccessModeWrite)
+}
+
+// SessionMode creates a new Session with the given access mode, which is used
+// to route queries to read or write servers in a cluster. In read-only mode,
+// the access mode is always read. If the Conn was derived by WithAccessMode,
+// its access mode is used instead. If the Conn has readers, read Sessions are
+// opened on one of them (see WithReaders).
+func (c *Conn) SessionMode(mode neo4j.AccessMode) neo4j.Session {
+	if c.ReadOnly {
+		mode = neo4j.AccessModeRead
+	} else if c.mode != nil {
+		mode = *c.mode
+	}
+	cfg := neo4j.SessionConfig{
+		AccessMode:       mode,
+		Bookmarks:        c.lastBookmarks(),
+		DatabaseName:     c.DBName,
+		FetchSize:        c.FetchSize,
+		ImpersonatedUser: c.impersonate,
+	}
+	var sess neo4j.Session
+	if mode == neo4j.AccessModeRead && c.readers != nil {
+		sess = c.readers.session(cfg)
+	} else {
+		sess = c.Driver.NewSession(cfg)
+	}
+	return &bookmarkSession{Session: c.metrics.session(sess), initial: cfg.Bookmarks}
+}
+
+// closeSession records the bookmark and closes the Session of the current
+// Transaction.
+func (c *Conn) closeSession() {
+	if c.sess != nil {
+		c.setBookmark(c.sess)
+		_ = c.sess.Close()
+		c.sess = nil
+	}
 }
 
 // GetTransaction returns the current Transaction or creates a new one.
+// The caller, which created it, is responsible for committing or rolling it
+// back. WithinTx does this for nested work as well.
 func (c *Conn) GetTransaction() (tx neo4j.Transaction, created bool, err error) {
+	return c.GetTransactionMode(neo4j.AccessModeWrite)
+}
+
+// GetTransactionMode is like GetTransaction, but a new Transaction is created
+// with the given access mode and configuration (e.g., metadata). If there is a
+// current Transaction, it is returned regardless of its mode and configuration.
+func (c *Conn) GetTransactionMode(mode neo4j.AccessMode,
+	configurers ...func(*neo4j.TransactionConfig)) (tx neo4j.Transaction, created bool, err error) {
+
 	if c.Tx == nil {
-		c.Tx, err = c.Session().BeginTransaction()
+		c.sess = c.SessionMode(mode)
+		if c.Tx, err = c.sess.BeginTransaction(configurers...); err != nil {
+			c.closeSession()
+		}
 		created = true
 	}
 	return c.Tx, created, err
 }
 
 // Commit commits the current Transaction.
-// If there is no active Transaction, false is returned.
+// If there is no active Transaction, false is returned. If the Transaction was
+// marked as rollback-only by nested work (see WithinTxPropagation), it is
+// rolled back instead, and ErrRollbackOnly is returned.
 func (c *Conn) Commit() (done bool, err error) {
+	if c.rollbackOnly {
+		if _, err = c.Rollback(); err != nil {
+			return false, err
+		}
+		return false, ErrRollbackOnly
+	}
 	if c.Tx != nil {
 		err = c.Tx.Commit()
 		c.Tx, done = nil, err != nil
+		c.closeSession()
 	}
 	return
 }
@@ -114,9 +402,11 @@ func (c *Conn) Commit() (done bool, err error) {
 // Rollback rolls back the current Transaction.
 // If there is no active Transaction, false is returned.
 func (c *Conn) Rollback() (done bool, err error) {
+	c.rollbackOnly = false
 	if c.Tx != nil {
 		err = c.Tx.Rollback()
 		c.Tx, done = nil, err != nil
+		c.closeSession()
 	}
 	return
 }
@@ -143,6 +433,44 @@ func (c *Conn) UseDB(dbName string) (err error) {
 	return err
 }
 
+// cypher returns the query to send to the server. In dry-run mode, the query
+// is prefixed with EXPLAIN, replacing PROFILE if present.
+func (c *Conn) cypher(query string) string {
+	if !c.DryRun {
+		return query
+	}
+	q := strings.TrimSpace(query)
+	switch strings.ToUpper(strings.SplitN(q, " ", 2)[0]) {
+	case "EXPLAIN":
+		return q
+	case "PROFILE":
+		return "EXPLAIN" + q[len("PROFILE"):]
+	}
+	return "EXPLAIN " + q
+}
+
+// params merges the given parameters with the Conn's default Params and
+// converts struct-valued parameters to maps.
+func (c *Conn) params(params map[string]any) map[string]any {
+	return normalizeParams(mergeParams(params, c.Params))
+}
+
+// mergeParams returns a new map with all entries of params and defs, unless
+// params already contains the key. If defs is empty, params is returned.
+func mergeParams(params, defs map[string]any) map[string]any {
+	if len(defs) == 0 {
+		return params
+	}
+	m := make(map[string]any, len(params)+len(defs))
+	for k, v := range defs {
+		m[k] = v
+	}
+	for k, v := range params {
+		m[k] = v
+	}
+	return m
+}
+
 // Username returns the username used to connect to the database.
 // If an error occurs, an empty string is returned.
 func (c *Conn) Username() string {
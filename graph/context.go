@@ -0,0 +1,135 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// QueryContext is like Query, but stops when the context is done. Then, the
+// Transaction is terminated server-side, like a cancelled Stream. This does
+// not apply to the current Transaction of the Conn, which was created without
+// the metadata identifying it. The deadline of the context, if any, becomes
+// the timeout of a new Transaction, unless the Request has a shorter one.
+//
+// If the deadline of the context expires, a TimeoutError matching
+// ErrClientTimeout is returned. If the server terminates the Transaction due
+// to its own timeout (see Request.Timeout and Conn.WithDefaultTimeout), a
+// TimeoutError matching ErrServerTimeout is returned instead.
+func (t Template[T]) QueryContext(ctx context.Context, r Request, m Mapper[T]) (
+	list []T, summary neo4j.ResultSummary, err error) {
+
+	summary, err = t.executeContext(ctx, r, func(res neo4j.Result) error {
+		list = list[:0]
+		for res.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			list = append(list, m(res.Record()))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return list, summary, nil
+}
+
+// QuerySingleContext is like QuerySingle, but stops when the context is done,
+// like QueryContext.
+func (t Template[T]) QuerySingleContext(ctx context.Context,
+	cyp string, params map[string]any, m Mapper[T]) (val T, err error) {
+
+	_, err = t.executeContext(ctx, Request{Query: cyp, Params: params}, t.single(m, &val))
+	return val, err
+}
+
+// executeContext is like execute, but stops when the context is done.
+func (t Template[T]) executeContext(ctx context.Context, r Request, fn func(res neo4j.Result) error) (
+	summary neo4j.ResultSummary, err error) {
+
+	if err = ctx.Err(); err != nil {
+		return nil, ctxErr(r.Query, err)
+	}
+
+	id := newTxID()
+	r = r.WithContext(ctx)
+	r.Metadata = mergeParams(map[string]any{TxIDKey: id}, r.Metadata)
+	stop := t.conn.watch(ctx, id)
+	t.ctx = ctx
+	summary, err = t.execute(r, fn)
+	stop()
+
+	var qerr *QueryError
+	if cerr := ctx.Err(); cerr != nil && err != nil {
+		return nil, ctxErr(r.Query, cerr)
+	} else if errors.As(err, &qerr) && qerr.IsServerTimeout() {
+		return nil, &TimeoutError{Server: true, Err: err}
+	}
+	return summary, err
+}
+
+// GetTransactionContext is like GetTransactionMode, but a new Transaction
+// carries the TxMetadata of the context, and it times out, when the deadline
+// of the context expires (see Request.WithContext). If the context is already
+// done, no Transaction is created.
+func (c *Conn) GetTransactionContext(ctx context.Context, mode neo4j.AccessMode) (
+	tx neo4j.Transaction, created bool, err error) {
+
+	if err = ctx.Err(); err != nil {
+		return nil, false, ctxErr("", err)
+	}
+	return c.GetTransactionMode(mode, c.txConfig(Request{}.WithContext(ctx))...)
+}
+
+// CommitContext is like Commit, but rolls back the current Transaction
+// instead, if the context is done.
+func (c *Conn) CommitContext(ctx context.Context) (done bool, err error) {
+	if err = ctx.Err(); err != nil {
+		_, _ = c.Rollback()
+		return false, ctxErr("", err)
+	}
+	return c.Commit()
+}
+
+// ctxTimeout returns the time until the deadline of the context, or the
+// given timeout, if it is shorter or there is no deadline.
+func ctxTimeout(ctx context.Context, d time.Duration) time.Duration {
+	dl, ok := ctx.Deadline()
+	if !ok {
+		return d
+	}
+	rem := time.Until(dl)
+	if rem < time.Millisecond {
+		rem = time.Millisecond
+	}
+	if d > 0 && d < rem {
+		return d
+	}
+	return rem
+}
+
+// ctxErr wraps the error of a context, which is done, in a QueryError.
+// An expired deadline is reported as client-side TimeoutError.
+func ctxErr(query string, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = &TimeoutError{Err: err}
+	}
+	return wrapErr(query, err)
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "github.com/neo4j/neo4j-go-driver/v4/neo4j"
+
+// Summary is a ResultSummary, which carries the correlation ID of the
+// Transaction, in which the query was executed. Template methods return a
+// *Summary, if they created the Transaction.
+//
+// The driver does not expose the query ID assigned by the server. Instead,
+// the correlation ID is stored in the transaction metadata under TxIDKey. The
+// server includes the metadata in its query log and in the output of SHOW
+// TRANSACTIONS and dbms.listQueries, which allows to correlate log entries of
+// the application with those of the server.
+type Summary struct {
+	neo4j.ResultSummary
+	CorrelationID string
+}
+
+// CorrelationID returns the correlation ID of the Transaction, in which the
+// query with the given ResultSummary was executed, or an empty string if it is
+// unknown e.g., because the query was executed in the current Transaction of
+// the Conn.
+func CorrelationID(sum neo4j.ResultSummary) string {
+	if s, ok := sum.(*Summary); ok {
+		return s.CorrelationID
+	}
+	return ""
+}
+
+// correlate adds a new correlation ID to the metadata, unless it already
+// contains one, and returns the ID.
+func correlate(meta map[string]any) (map[string]any, string) {
+	if id, ok := meta[TxIDKey].(string); ok {
+		return meta, id
+	}
+	id := newTxID()
+	return mergeParams(map[string]any{TxIDKey: id}, meta), id
+}
+
+// correlated attaches the correlation ID to the ResultSummary.
+func correlated(sum neo4j.ResultSummary, id string) neo4j.ResultSummary {
+	if sum == nil || id == "" {
+		return sum
+	}
+	return &Summary{ResultSummary: sum, CorrelationID: id}
+}
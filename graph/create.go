@@ -0,0 +1,175 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// ErrKeyTypeMismatch indicates that a node exists, whose key properties equal
+// the given ones except for their types e.g., "42" instead of 42. MERGE would
+// create a duplicate, because values of different types are never equal.
+var ErrKeyTypeMismatch = errors.New("key type mismatch")
+
+// CreateIfNotExists creates a node for the entity, unless a node with the same
+// values of the given key properties already exists. Unlike an upsert, an
+// existing node is not modified. It returns whether the node was created and
+// the entity mapped from the resulting node, which is the existing one if
+// another writer won the race.
+//
+// Key values are normalized before matching i.e., all integers are converted
+// to int64 and all floats to float64, and lists, maps and structs other than
+// temporal values are rejected. If a node exists, whose keys only differ in
+// their types, such as a string key stored for an integer one, the node is not
+// created and ErrKeyTypeMismatch is returned.
+//
+// T may be a pointer to a struct, in which case the entity must not be nil,
+// and the result points to a new struct.
+func (t Template[T]) CreateIfNotExists(entity T, keys ...string) (created bool, result T, err error) {
+	if len(keys) == 0 {
+		return false, result, errors.New("at least one key is required")
+	} else if v := reflect.ValueOf(entity); v.Kind() == reflect.Pointer && v.IsNil() {
+		return false, result, errors.New("entity must not be nil")
+	}
+
+	fs := fields(reflect.TypeOf(entity))
+	ps := props(reflect.ValueOf(entity), fs, t.nulls)
+	params := map[string]any{"props": ps}
+	conds := make([]string, len(keys))
+	for i, k := range keys {
+		v, ok := ps[k]
+		if !ok || v == nil {
+			return false, result, fmt.Errorf("key %q is not set", k)
+		}
+		if v, err = normalizeKey(v); err != nil {
+			return false, result, fmt.Errorf("key %q: %w", k, err)
+		}
+		p := "k" + strconv.Itoa(i)
+		ps[k], params[p] = v, v
+		conds[i] = Quote(k) + ": $" + p
+	}
+	if err = t.checkKeyTypes(keys, params); err != nil {
+		return false, result, err
+	}
+
+	cyp := fmt.Sprintf("MERGE (n:%s {%s}) ON CREATE SET n += $props RETURN n",
+		labelExpr(t.labels), strings.Join(conds, ", "))
+
+	sum, err := t.execute(Request{Query: cyp, Params: params, Write: true}, func(res neo4j.Result) error {
+		if !res.Next() {
+			return ErrEmpty
+		}
+		n := res.Record().Values[0].(neo4j.Node)
+		rv := reflect.ValueOf(&result).Elem()
+		for rv.Kind() == reflect.Pointer {
+			rv.Set(reflect.New(rv.Type().Elem()))
+			rv = rv.Elem()
+		}
+		return t.dec.decodeEntity(n, rv, fs)
+	})
+	if err != nil {
+		return false, result, err
+	}
+	return sum.Counters().NodesCreated() > 0, result, nil
+}
+
+// checkKeyTypes returns ErrKeyTypeMismatch if there is a node, whose keys
+// equal the given ones, if numbers and their string representations are
+// considered equal, but which is not matched by the exact keys.
+func (t Template[T]) checkKeyTypes(keys []string, params map[string]any) error {
+	alts := make(map[string]any, len(keys))
+	conds := make([]string, len(keys))
+	exact := make([]string, len(keys))
+	found := false
+	for i, k := range keys {
+		p := "k" + strconv.Itoa(i)
+		a := keyAlternatives(params[p])
+		found = found || len(a) > 0
+		alts["a"+strconv.Itoa(i)] = append([]any{params[p]}, a...)
+		conds[i] = "n." + Quote(k) + " IN $a" + strconv.Itoa(i)
+		exact[i] = "n." + Quote(k) + " = $" + p
+	}
+	if !found {
+		return nil
+	}
+
+	cyp := fmt.Sprintf("MATCH (n:%s) WHERE %s AND NOT (%s) RETURN count(n)",
+		labelExpr(t.labels), strings.Join(conds, " AND "), strings.Join(exact, " AND "))
+	cnt, err := NewTemplate[int64](t.conn).QuerySingle(cyp, mergeParams(alts, params), NewSingleValueMapper[int64](0))
+	if err != nil || t.conn.DryRun {
+		return err
+	} else if cnt > 0 {
+		return fmt.Errorf("%w: %d %s node(s) with keys %v of different types", ErrKeyTypeMismatch, cnt, t.label, keys)
+	}
+	return nil
+}
+
+// normalizeKey converts integers to int64 and floats to float64, so that key
+// values compare consistently regardless of their Go type. Values, which are
+// not suitable as keys, are rejected.
+func normalizeKey(v any) (any, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, &ConversionError{Value: v, Type: reflect.TypeOf(int64(0)), Overflow: true}
+		}
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.Struct:
+		if rv.Type().ConvertibleTo(reflect.TypeOf(time.Time{})) {
+			return rv.Interface(), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported key type %T", v)
+}
+
+// keyAlternatives returns the representations of a key value, which a node
+// might store if it was written with another type i.e., the string of a
+// number and vice versa.
+func keyAlternatives(v any) []any {
+	switch v := v.(type) {
+	case int64:
+		return []any{strconv.FormatInt(v, 10)}
+	case float64:
+		return []any{strconv.FormatFloat(v, 'f', -1, 64)}
+	case string:
+		s := strings.TrimSpace(v)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return []any{i}
+		} else if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return []any{f}
+		}
+	}
+	return nil
+}
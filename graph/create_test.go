@@ -0,0 +1,94 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizeKey(t *testing.T) {
+	i, now := 42, time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		in       any
+		want     any
+		wantErr  bool
+		overflow bool
+	}{
+		{name: "int", in: 42, want: int64(42)},
+		{name: "int8", in: int8(-8), want: int64(-8)},
+		{name: "int32", in: int32(32), want: int64(32)},
+		{name: "int64", in: int64(math.MinInt64), want: int64(math.MinInt64)},
+		{name: "uint", in: uint(7), want: int64(7)},
+		{name: "uint64 max int64", in: uint64(math.MaxInt64), want: int64(math.MaxInt64)},
+		{name: "uint64 overflow", in: uint64(math.MaxInt64 + 1), wantErr: true, overflow: true},
+		{name: "float32", in: float32(1.5), want: 1.5},
+		{name: "float64", in: 2.25, want: 2.25},
+		{name: "string", in: "abc", want: "abc"},
+		{name: "bool", in: true, want: true},
+		{name: "time", in: now, want: now},
+		{name: "pointer", in: &i, want: int64(42)},
+		{name: "nil", in: nil, wantErr: true},
+		{name: "nil pointer", in: (*int)(nil), wantErr: true},
+		{name: "slice", in: []int{1}, wantErr: true},
+		{name: "map", in: map[string]any{}, wantErr: true},
+		{name: "struct", in: struct{}{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeKey(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeKey(%#v) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			var cerr *ConversionError
+			if overflow := errors.As(err, &cerr) && cerr.Overflow; overflow != tt.overflow {
+				t.Errorf("normalizeKey(%#v) overflow = %v, want %v", tt.in, overflow, tt.overflow)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeKey(%#v) = %#v, want %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyAlternatives(t *testing.T) {
+	tests := []struct {
+		name string
+		in   any
+		want []any
+	}{
+		{name: "int64", in: int64(42), want: []any{"42"}},
+		{name: "negative int64", in: int64(-1), want: []any{"-1"}},
+		{name: "float64", in: 1.5, want: []any{"1.5"}},
+		{name: "integral float64", in: 2.0, want: []any{"2"}},
+		{name: "integer string", in: "42", want: []any{int64(42)}},
+		{name: "padded integer string", in: " 42 ", want: []any{int64(42)}},
+		{name: "float string", in: "1.5", want: []any{1.5}},
+		{name: "non-numeric string", in: "abc", want: nil},
+		{name: "empty string", in: "", want: nil},
+		{name: "bool", in: true, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keyAlternatives(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keyAlternatives(%#v) = %#v, want %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
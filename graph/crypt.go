@@ -0,0 +1,295 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// KeyProvider provides the keys for encrypting properties of fields tagged
+// `neo4j:",encrypted"`. Keys are AES keys of 16, 24 or 32 bytes. Their ID is
+// stored with each encrypted value, so that keys can be rotated: new values
+// are encrypted with the current key, while existing values are decrypted
+// with the key they were encrypted with.
+//
+// An implementation backed by a key management service typically generates
+// data keys, which it caches in memory, and stores them encrypted with a
+// master key of the service.
+type KeyProvider interface {
+	// CurrentKey returns the key and its ID, with which values are encrypted.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key with the given ID.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider holding the keys in memory e.g., read from the
+// environment or a secret store.
+type StaticKeys struct {
+	// Current is the ID of the key used for encryption.
+	Current string
+	// Keys maps key IDs to keys.
+	Keys map[string][]byte
+}
+
+// CurrentKey returns the key with the ID Current.
+func (s StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := s.Key(s.Current)
+	return s.Current, key, err
+}
+
+// Key returns the key with the given ID.
+func (s StaticKeys) Key(id string) ([]byte, error) {
+	if key, ok := s.Keys[id]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", id)
+}
+
+// DefaultKeyProvider encrypts and decrypts the properties of fields tagged
+// `neo4j:",encrypted"` or `neo4j:",encrypted=deterministic"` e.g.,
+//
+//	type Patient struct {
+//		Name  string `neo4j:"name"`
+//		SSN   string `neo4j:"ssn,encrypted"`
+//		Email string `neo4j:"email,encrypted=deterministic"`
+//	}
+//
+// Values are encoded as JSON and encrypted with AES-GCM, and they are stored
+// as strings of the form "enc:<key ID>:<base64>". The property key is
+// authenticated as well, so that values cannot be swapped between properties.
+// Separate subkeys for the cipher and for deriving deterministic nonces are
+// derived from each key with HKDF.
+//
+// By default, each value is encrypted with a random nonce. Deterministic
+// encryption derives the nonce from the value instead, so that equal values
+// have equal ciphertexts. This allows to find nodes by equality e.g., with
+// Template.Find or parameters created by Encrypt, but it reveals, which nodes
+// have equal values. Hence, it should only be used, where this is
+// necessary. Values encrypted with a previous key do not match, until they
+// are encrypted again.
+//
+// Templates encrypt the parameters of Requests created from entities, and
+// Decoders decrypt the values of encrypted fields transparently. Values,
+// which are not encrypted e.g., before the field was tagged, are read as is.
+// It should only be set during initialization.
+var DefaultKeyProvider KeyProvider
+
+// encPrefix is the prefix of encrypted values.
+const encPrefix = "enc:"
+
+// errNoKeyProvider indicates that encrypted properties are used without a
+// DefaultKeyProvider.
+var errNoKeyProvider = errors.New("encrypted property requires a DefaultKeyProvider")
+
+// sealed is the value of an encrypted field in a map of parameters, until it
+// is encrypted by EncryptParams. It hides the plaintext from log messages.
+type sealed struct {
+	prop          string
+	val           any
+	deterministic bool
+}
+
+// String hides the plaintext.
+func (s sealed) String() string {
+	return "<encrypted>"
+}
+
+// Encrypt encrypts the value of the property like the field of an entity
+// tagged `neo4j:",encrypted"` e.g., to find nodes by a deterministically
+// encrypted property in a custom query:
+//
+//	email, err := graph.Encrypt("email", addr, true)
+//	// MATCH (p:Patient {email: $email}) ...
+func Encrypt(prop string, val any, deterministic bool) (string, error) {
+	if DefaultKeyProvider == nil {
+		return "", errNoKeyProvider
+	}
+	id, key, err := DefaultKeyProvider.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	pt, err := json.Marshal(val)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if deterministic {
+		mac := hmac.New(sha256.New, hkdf(key, "roland nonce", sha256.Size))
+		_, _ = mac.Write([]byte(prop))
+		_, _ = mac.Write([]byte{0})
+		_, _ = mac.Write(pt)
+		copy(nonce, mac.Sum(nil))
+	} else if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	ct := aead.Seal(nonce, nonce, pt, []byte(prop))
+	return encPrefix + id + ":" + base64.RawStdEncoding.EncodeToString(ct), nil
+}
+
+// decrypt decrypts the value of the property into dst, which has the type of
+// the field.
+func decrypt(prop, s string, dst reflect.Value) error {
+	if DefaultKeyProvider == nil {
+		return errNoKeyProvider
+	}
+	i := strings.LastIndexByte(s, ':')
+	id := s[len(encPrefix):i]
+	ct, err := base64.RawStdEncoding.DecodeString(s[i+1:])
+	if err != nil {
+		return err
+	}
+	key, err := DefaultKeyProvider.Key(id)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	} else if len(ct) < aead.NonceSize() {
+		return errors.New("invalid encrypted value")
+	}
+	pt, err := aead.Open(nil, ct[:aead.NonceSize()], ct[aead.NonceSize():], []byte(prop))
+	if err != nil {
+		return err
+	}
+	v := reflect.New(dst.Type())
+	if err = json.Unmarshal(pt, v.Interface()); err != nil {
+		return err
+	}
+	dst.Set(v.Elem())
+	return nil
+}
+
+// isEncrypted returns whether the value is an encrypted string.
+func isEncrypted(val any) (string, bool) {
+	s, ok := val.(string)
+	return s, ok && strings.HasPrefix(s, encPrefix) && strings.Count(s, ":") >= 2
+}
+
+// newAEAD creates an AES-GCM cipher with a subkey derived from the key, which
+// is distinct from the subkey deriving the nonces of deterministic encryption.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, aes.KeySizeError(len(key))
+	}
+	b, err := aes.NewCipher(hkdf(key, "roland encryption", len(key)))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(b)
+}
+
+// hkdf derives a subkey of length n from the key using HKDF-SHA256 (RFC 5869)
+// without salt, and with the given info label.
+func hkdf(key []byte, info string, n int) []byte {
+	ext := hmac.New(sha256.New, make([]byte, sha256.Size))
+	_, _ = ext.Write(key)
+	prk := ext.Sum(nil)
+
+	var out, t []byte
+	for i := byte(1); len(out) < n; i++ {
+		exp := hmac.New(sha256.New, prk)
+		_, _ = exp.Write(t)
+		_, _ = exp.Write([]byte(info))
+		_, _ = exp.Write([]byte{i})
+		t = exp.Sum(nil)
+		out = append(out, t...)
+	}
+	return out[:n]
+}
+
+// EncryptParams returns the parameters with the values of encrypted fields
+// encrypted, including those in nested maps and lists e.g., rows for UNWIND.
+// Templates do this before running a query, and Params returns encrypted
+// values already. The given map is not modified.
+func EncryptParams(params map[string]any) (map[string]any, error) {
+	v, changed, err := encryptValue(params)
+	if err != nil || !changed {
+		return params, err
+	}
+	return v.(map[string]any), nil
+}
+
+// encryptValue encrypts sealed values and returns whether any was found.
+func encryptValue(val any) (any, bool, error) {
+	switch v := val.(type) {
+	case sealed:
+		s, err := Encrypt(v.prop, v.val, v.deterministic)
+		return s, true, err
+	case map[string]any:
+		var m map[string]any
+		for k, e := range v {
+			ev, changed, err := encryptValue(e)
+			if err != nil {
+				return nil, false, fmt.Errorf("%s: %w", k, err)
+			} else if changed && m == nil {
+				m = make(map[string]any, len(v))
+				for k, e := range v {
+					m[k] = e
+				}
+			}
+			if m != nil {
+				m[k] = ev
+			}
+		}
+		if m == nil {
+			return v, false, nil
+		}
+		return m, true, nil
+	case []any:
+		var l []any
+		for i, e := range v {
+			ev, changed, err := encryptValue(e)
+			if err != nil {
+				return nil, false, fmt.Errorf("[%d]: %w", i, err)
+			} else if changed && l == nil {
+				l = append(make([]any, 0, len(v)), v...)
+			}
+			if l != nil {
+				l[i] = ev
+			}
+		}
+		if l == nil {
+			return v, false, nil
+		}
+		return l, true, nil
+	case []map[string]any:
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = e
+		}
+		if ev, changed, err := encryptValue(l); err != nil || changed {
+			return ev, changed, err
+		}
+	}
+	return val, false, nil
+}
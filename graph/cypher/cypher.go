@@ -0,0 +1,224 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cypher provides a builder for read queries, which produces a
+// graph.Request. Values are never embedded in the query. Instead, they are
+// passed as parameters, which prevents Cypher injection.
+//
+//	r, err := cypher.Match(cypher.Node("p", "Person")).
+//		Where("p.age >= ?", 18).
+//		Filter("p", graph.StartsWith("name", "A")).
+//		Return("p").
+//		OrderBy("p.name").
+//		Limit(10).
+//		Build()
+package cypher
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/abc-inc/roland/graph"
+)
+
+// Builder builds a Cypher query clause by clause. The first error, such as a
+// clause in an invalid position, is reported by Build.
+type Builder struct {
+	clauses []string
+	last    string
+	ended   bool
+	params  map[string]any
+	err     error
+}
+
+// Node returns a node pattern with the given variable and labels e.g.,
+// (p:`Person`). Labels are quoted.
+func Node(variable string, labels ...string) string {
+	var sb strings.Builder
+	sb.WriteString("(" + variable)
+	for _, l := range labels {
+		sb.WriteString(":" + graph.Quote(l))
+	}
+	return sb.String() + ")"
+}
+
+// Rel returns a directed relationship pattern with the given variable and
+// type e.g., -[r:`KNOWS`]->. The type is quoted, unless it is empty.
+func Rel(variable, relType string) string {
+	if relType != "" {
+		relType = ":" + graph.Quote(relType)
+	}
+	return "-[" + variable + relType + "]->"
+}
+
+// Match starts a new query with a MATCH clause.
+func Match(patterns ...string) *Builder {
+	return (&Builder{params: make(map[string]any)}).Match(patterns...)
+}
+
+// Unwind starts a new query with an UNWIND clause.
+func Unwind(list any, alias string) *Builder {
+	return (&Builder{params: make(map[string]any)}).Unwind(list, alias)
+}
+
+// Match adds a MATCH clause for the comma-separated patterns.
+func (b *Builder) Match(patterns ...string) *Builder {
+	return b.reading("MATCH", patterns)
+}
+
+// OptionalMatch adds an OPTIONAL MATCH clause for the comma-separated patterns.
+func (b *Builder) OptionalMatch(patterns ...string) *Builder {
+	return b.reading("OPTIONAL MATCH", patterns)
+}
+
+// Unwind adds an UNWIND clause, which expands the list, passed as parameter,
+// into rows.
+func (b *Builder) Unwind(list any, alias string) *Builder {
+	if b.ended {
+		return b.fail("UNWIND must not follow RETURN")
+	}
+	return b.add("UNWIND", b.param(list)+" AS "+alias)
+}
+
+// Where adds a predicate to the preceding MATCH, OPTIONAL MATCH or WITH clause.
+// Each ? in the condition is replaced by a parameter holding the corresponding
+// value e.g., Where("p.age >= ? AND p.name <> ?", 18, "Bob"). Calling Where
+// again combines both predicates with AND.
+func (b *Builder) Where(cond string, values ...any) *Builder {
+	if strings.Count(cond, "?") != len(values) {
+		return b.fail("%q expects %d value(s), got %d", cond, strings.Count(cond, "?"), len(values))
+	}
+	for _, v := range values {
+		cond = strings.Replace(cond, "?", b.param(v), 1)
+	}
+	return b.where(cond)
+}
+
+// Filter adds a predicate like Where, which is compiled from the filters on
+// the given variable e.g., Filter("p", graph.Eq("name", name)). All filters
+// must match.
+func (b *Builder) Filter(variable string, fs ...graph.Filter) *Builder {
+	return b.where(graph.And(fs...).Cypher(variable, b.param))
+}
+
+// where adds the condition to the WHERE clause.
+func (b *Builder) where(cond string) *Builder {
+	switch b.last {
+	case "WHERE":
+		b.clauses[len(b.clauses)-1] += " AND (" + cond + ")"
+		return b
+	case "MATCH", "OPTIONAL MATCH", "WITH":
+		return b.add("WHERE", "("+cond+")")
+	}
+	return b.fail("WHERE must follow MATCH, OPTIONAL MATCH or WITH")
+}
+
+// With adds a WITH clause, which projects the given expressions.
+func (b *Builder) With(exprs ...string) *Builder {
+	return b.projection("WITH", exprs)
+}
+
+// Return adds a RETURN clause, which projects the given expressions.
+func (b *Builder) Return(exprs ...string) *Builder {
+	return b.projection("RETURN", exprs)
+}
+
+// OrderBy adds an ORDER BY clause e.g., OrderBy("p.name", "p.age DESC").
+func (b *Builder) OrderBy(exprs ...string) *Builder {
+	if b.last != "RETURN" && b.last != "WITH" {
+		return b.fail("ORDER BY must follow RETURN or WITH")
+	}
+	return b.add("ORDER BY", strings.Join(exprs, ", "))
+}
+
+// Skip adds a SKIP clause.
+func (b *Builder) Skip(n int) *Builder {
+	if b.last != "RETURN" && b.last != "WITH" && b.last != "ORDER BY" {
+		return b.fail("SKIP must follow RETURN, WITH or ORDER BY")
+	}
+	return b.add("SKIP", b.param(int64(n)))
+}
+
+// Limit adds a LIMIT clause.
+func (b *Builder) Limit(n int) *Builder {
+	switch b.last {
+	case "RETURN", "WITH", "ORDER BY", "SKIP":
+		return b.add("LIMIT", b.param(int64(n)))
+	}
+	return b.fail("LIMIT must follow RETURN, WITH, ORDER BY or SKIP")
+}
+
+// Build returns the Request or the first error. The query must end with a
+// RETURN clause or one of its modifiers. It implements graph.Statement, so
+// that the Builder can be passed to Template.QueryStatement.
+func (b *Builder) Build() (graph.Request, error) {
+	if b.err != nil {
+		return graph.Request{}, b.err
+	}
+	if !b.ended {
+		return graph.Request{}, errors.New("query must end with RETURN")
+	}
+	return graph.Request{Query: strings.Join(b.clauses, " "), Params: b.params}, nil
+}
+
+// reading adds a MATCH or OPTIONAL MATCH clause.
+func (b *Builder) reading(kw string, patterns []string) *Builder {
+	if len(patterns) == 0 {
+		return b.fail("%s requires a pattern", kw)
+	}
+	if b.ended {
+		return b.fail("%s must not follow RETURN", kw)
+	}
+	return b.add(kw, strings.Join(patterns, ", "))
+}
+
+// projection adds a WITH or RETURN clause.
+func (b *Builder) projection(kw string, exprs []string) *Builder {
+	if len(exprs) == 0 {
+		return b.fail("%s requires an expression", kw)
+	} else if b.last == "" {
+		return b.fail("%s requires a preceding clause", kw)
+	} else if b.ended {
+		return b.fail("%s must not follow RETURN", kw)
+	}
+	b.add(kw, strings.Join(exprs, ", "))
+	b.ended = kw == "RETURN"
+	return b
+}
+
+// add appends a clause.
+func (b *Builder) add(kw, body string) *Builder {
+	if b.err == nil {
+		b.clauses = append(b.clauses, kw+" "+body)
+		b.last = kw
+	}
+	return b
+}
+
+// param adds a parameter and returns its placeholder.
+func (b *Builder) param(v any) string {
+	p := "p" + strconv.Itoa(len(b.params))
+	b.params[p] = v
+	return "$" + p
+}
+
+// fail records the first error.
+func (b *Builder) fail(format string, args ...any) *Builder {
+	if b.err == nil {
+		b.err = fmt.Errorf(format, args...)
+	}
+	return b
+}
@@ -0,0 +1,287 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"golang.org/x/exp/maps"
+)
+
+// errNoColumn indicates that a Record does not contain a certain key.
+var errNoColumn = errors.New("no such column")
+
+// Decoder assigns the values of Records to the fields of structs.
+// Its zero value stops at the first error and ignores missing keys.
+type Decoder struct {
+	// CollectErrors continues after a field could not be assigned and reports
+	// the errors of all fields at once.
+	CollectErrors bool
+	// RequireAll reports an error for each field, whose key is missing in the
+	// Record.
+	RequireAll bool
+	// TimeLocation, if set, converts temporal values with a time zone to the
+	// given Location e.g., time.UTC. By default, the stored zone is preserved.
+	// Local values without a zone, such as LocalDateTime, are not affected.
+	TimeLocation *time.Location
+}
+
+// Decode assigns the values of the Record to the fields of the struct, which
+// dest points to, using the default Decoder.
+func Decode(rec *neo4j.Record, dest any) error {
+	return Decoder{}.Decode(rec, dest)
+}
+
+// Decode assigns the values of the Record to the fields of the struct, which
+// dest points to. Each field receives the value of the key, which equals its
+// property key. Null values leave the field unchanged.
+func (d Decoder) Decode(rec *neo4j.Record, dest any) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("destination must be a non-nil pointer to a struct")
+	}
+	return d.decode(rec, v.Elem(), fields(v.Type()))
+}
+
+// MapInto is like Decode, but type-safe. It allows callers to reuse dest for
+// many Records instead of allocating a new struct per Record.
+func MapInto[T any](rec *neo4j.Record, dest *T) error {
+	return Decode(rec, dest)
+}
+
+// decode assigns the values of the Record to the fields of the struct v.
+func (d Decoder) decode(rec *neo4j.Record, v reflect.Value, fs []field) error {
+	return d.decodeFunc(rec.Get, rec.Keys, v, fs)
+}
+
+// decodeProps assigns the properties to the fields of the struct v.
+func (d Decoder) decodeProps(props map[string]any, v reflect.Value, fs []field) error {
+	return d.decodeFunc(func(k string) (any, bool) {
+		val, ok := props[k]
+		return val, ok
+	}, maps.Keys(props), v, fs)
+}
+
+// decodeEntity assigns the properties of a Node, Relationship or map to the
+// fields of the struct v. The id field, if any, receives the internal ID of a
+// Node or Relationship instead of a property with the same key.
+func (d Decoder) decodeEntity(val any, v reflect.Value, fs []field) error {
+	props := entityProps(val)
+	get := func(k string) (any, bool) {
+		val, ok := props[k]
+		return val, ok
+	}
+	if f, ok := idField(fs); ok {
+		if id, ok := entityID(val); ok {
+			get = func(k string) (any, bool) {
+				if k == f.name {
+					return id, true
+				}
+				val, ok := props[k]
+				return val, ok
+			}
+		}
+	}
+	return d.decodeFunc(get, maps.Keys(props), v, fs)
+}
+
+// decodeFunc assigns the values returned by get to the fields of the struct v.
+// The values of all keys, which are not mapped to a field, are put into the
+// remainder field, if any.
+func (d Decoder) decodeFunc(get func(key string) (any, bool), keys []string,
+	v reflect.Value, fs []field) error {
+
+	var errs []error
+	for _, f := range fs {
+		if f.remainder {
+			v.FieldByIndex(f.index).Set(reflect.ValueOf(d.remainder(get, keys, fs)))
+			continue
+		}
+		val, ok := get(f.name)
+		var err error
+		if !ok && d.RequireAll {
+			err = errNoColumn
+		} else if s, enc := isEncrypted(val); ok && f.encrypt != "" && enc {
+			err = decrypt(f.name, s, v.FieldByIndex(f.index))
+		} else if ok {
+			err = d.setValue(v.FieldByIndex(f.index), d.inLocation(val))
+		}
+
+		if err == nil {
+			continue
+		} else if !d.CollectErrors {
+			return &MappingError{Key: f.name, Err: err}
+		}
+		errs = append(errs, &MappingError{Key: f.name, Err: err})
+	}
+
+	if len(errs) > 1 {
+		return &MappingError{Err: joinErrs(errs)}
+	}
+	return joinErrs(errs)
+}
+
+// remainder returns the values of all keys, which are not mapped to a field.
+func (d Decoder) remainder(get func(key string) (any, bool), keys []string, fs []field) map[string]any {
+	m := make(map[string]any)
+	for _, k := range keys {
+		if !hasField(fs, k) {
+			val, _ := get(k)
+			m[k] = d.inLocation(val)
+		}
+	}
+	return m
+}
+
+// inLocation converts time.Time values, including those in lists, to the
+// TimeLocation of the Decoder.
+func (d Decoder) inLocation(val any) any {
+	if d.TimeLocation == nil {
+		return val
+	}
+	switch v := val.(type) {
+	case time.Time:
+		return v.In(d.TimeLocation)
+	case []any:
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = d.inLocation(e)
+		}
+		return l
+	}
+	return val
+}
+
+// setValue assigns val to dst, converting numbers and lists if necessary.
+// Byte arrays are assigned to byte slices and arrays of the same length.
+// Nodes, Relationships and maps are decoded into structs, which allows to map
+// collected child nodes e.g., collect(c) AS cars, to a slice of structs.
+// Points and Durations are assigned to Point and time.Duration fields, and
+// temporal values to time.Time fields.
+func (d Decoder) setValue(dst reflect.Value, val any) error {
+	if val == nil {
+		return nil
+	} else if ok, err := setTemporal(dst, val); ok {
+		return err
+	} else if setGraphValue(dst, val) {
+		return nil
+	}
+
+	src := reflect.ValueOf(val)
+	switch {
+	case src.Type().AssignableTo(dst.Type()):
+		dst.Set(src)
+	case dst.Kind() == reflect.Pointer:
+		e := reflect.New(dst.Type().Elem())
+		if err := d.setValue(e.Elem(), val); err != nil {
+			return err
+		}
+		dst.Set(e)
+	case isNumber(src.Kind()) && isNumber(dst.Kind()):
+		if overflows(src, dst.Type()) {
+			return &ConversionError{Value: val, Type: dst.Type(), Overflow: true}
+		}
+		dst.Set(src.Convert(dst.Type()))
+	case src.Kind() == dst.Kind() && src.Type().ConvertibleTo(dst.Type()):
+		dst.Set(src.Convert(dst.Type()))
+	case dst.Kind() == reflect.Array && dst.Type().Elem().Kind() == reflect.Uint8 && src.Type() == reflect.TypeOf([]byte(nil)):
+		if src.Len() != dst.Len() {
+			return &ConversionError{Value: val, Type: dst.Type()}
+		}
+		reflect.Copy(dst, src)
+	case src.Kind() == reflect.Slice && dst.Kind() == reflect.Slice:
+		s := reflect.MakeSlice(dst.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			if err := d.setValue(s.Index(i), src.Index(i).Interface()); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		dst.Set(s)
+	case dst.Kind() == reflect.Struct && isEntity(val):
+		e := reflect.New(dst.Type()).Elem()
+		if err := d.decodeEntity(val, e, fields(dst.Type())); err != nil {
+			return err
+		}
+		dst.Set(e)
+	default:
+		return &ConversionError{Value: val, Type: dst.Type()}
+	}
+	return nil
+}
+
+// isEntity returns whether the value is a Node, a Relationship or a map.
+func isEntity(val any) bool {
+	switch val.(type) {
+	case neo4j.Node, neo4j.Relationship, map[string]any:
+		return true
+	}
+	return false
+}
+
+// entityProps returns the properties of a Node or Relationship, or the map
+// itself.
+func entityProps(val any) map[string]any {
+	switch v := val.(type) {
+	case neo4j.Node:
+		return v.Props
+	case neo4j.Relationship:
+		return v.Props
+	}
+	return val.(map[string]any)
+}
+
+// entityID returns the internal ID of a Node or Relationship.
+func entityID(val any) (int64, bool) {
+	switch v := val.(type) {
+	case neo4j.Node:
+		return v.Id, true
+	case neo4j.Relationship:
+		return v.Id, true
+	}
+	return 0, false
+}
+
+// overflows returns whether the number cannot be represented by the type
+// without truncation e.g., an int64 exceeding the range of an int32 or a
+// fractional float assigned to an integer.
+func overflows(src reflect.Value, typ reflect.Type) bool {
+	dst := reflect.New(typ).Elem()
+	switch {
+	case src.CanInt() && dst.CanInt():
+		return dst.OverflowInt(src.Int())
+	case src.CanInt() && dst.CanUint():
+		return src.Int() < 0 || dst.OverflowUint(uint64(src.Int()))
+	case src.CanUint() && dst.CanInt():
+		return src.Uint() > math.MaxInt64 || dst.OverflowInt(int64(src.Uint()))
+	case src.CanUint() && dst.CanUint():
+		return dst.OverflowUint(src.Uint())
+	case src.CanFloat() && dst.CanFloat():
+		return dst.OverflowFloat(src.Float())
+	case src.CanFloat():
+		f := src.Float()
+		return f != math.Trunc(f) || src.Convert(typ).Convert(src.Type()).Float() != f
+	}
+	return false
+}
+
+// isNumber returns whether the kind is an integer or floating point type.
+func isNumber(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
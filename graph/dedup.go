@@ -0,0 +1,63 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// ErrAlreadyProcessed indicates that an event with the same idempotency key
+// has been processed before.
+var ErrAlreadyProcessed = errors.New("already processed")
+
+// ProcessOnce executes the work in a managed write Transaction, unless an
+// event with the given idempotency key has been processed before, in which
+// case ErrAlreadyProcessed is returned. The key is recorded as a node labeled
+// "ProcessedEvent" in the same Transaction, so that it is only recorded if the
+// work succeeds. This makes consumers of duplicate messages effectively-once.
+//
+// Concurrent deliveries of the same key are only detected reliably if the key
+// is unique, see EnsureProcessedEventConstraint.
+func ProcessOnce[T any](c *Conn, key string, work TxWork[T]) (T, error) {
+	return WriteTx(c, func(tx neo4j.Transaction) (val T, err error) {
+		const cyp = "MERGE (e:ProcessedEvent {key: $key}) ON CREATE SET e.processedAt = datetime()"
+		res, err := tx.Run(cyp, map[string]any{"key": key})
+		if err != nil {
+			return val, wrapErr(cyp, err)
+		}
+		sum, err := res.Consume()
+		if err != nil {
+			return val, wrapErr(cyp, err)
+		} else if sum.Counters().NodesCreated() == 0 {
+			return val, ErrAlreadyProcessed
+		}
+		return work(tx)
+	})
+}
+
+// EnsureProcessedEventConstraint creates the uniqueness constraint on the
+// idempotency keys recorded by ProcessOnce, unless it exists. It requires
+// Neo4j 4.4 or later.
+func (c *Conn) EnsureProcessedEventConstraint() error {
+	r := Request{
+		Query: "CREATE CONSTRAINT processed_event_key IF NOT EXISTS " +
+			"FOR (e:ProcessedEvent) REQUIRE e.key IS UNIQUE",
+		Write: true,
+	}
+	_, err := NewTemplate[any](c).execute(r, discard)
+	return err
+}
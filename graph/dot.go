@@ -0,0 +1,325 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// GraphOptions configures the rendering of a subgraph.
+//
+// NodeCaption and RelCaption are text/template templates, which are executed
+// with a Node and a Relationship, respectively e.g.,
+//
+//	GraphOptions{NodeCaption: `{{index .Labels 0}}: {{.Properties.name}}`}
+//
+// By default, Nodes are labeled with their primary label and Relationships
+// with their type.
+type GraphOptions struct {
+	NodeCaption string
+	RelCaption  string
+}
+
+// QueryToDOT executes the Request and renders all Nodes, Relationships and
+// Paths contained in the result as GraphViz DOT. Nodes are labeled with the
+// value of labelProp or, if it is absent, their primary label. Relationships
+// are labeled with their type. Other values are ignored.
+func (c *Conn) QueryToDOT(r Request, w io.Writer, labelProp string) error {
+	g, err := c.subgraph(r)
+	if err != nil {
+		return err
+	}
+	return g.writeDOT(w, func(n neo4j.Node) (string, error) {
+		return nodeCaption(n, labelProp), nil
+	}, relType)
+}
+
+// QueryToDOTWith is like QueryToDOT, but labels Nodes and Relationships
+// according to the GraphOptions.
+func (c *Conn) QueryToDOTWith(r Request, w io.Writer, o GraphOptions) error {
+	nc, rc, err := o.captions()
+	if err != nil {
+		return err
+	}
+	g, err := c.subgraph(r)
+	if err != nil {
+		return err
+	}
+	return g.writeDOT(w, nc, rc)
+}
+
+// QueryToGraphML executes the Request and renders all Nodes, Relationships and
+// Paths contained in the result as GraphML. Besides the caption according to
+// the GraphOptions, each node has the data keys "labels" (colon-prefixed as
+// in APOC's export) and each edge "type", and both have a key per property.
+// Property values are rendered with fmt.Sprint, and the attribute type of a
+// key is derived from its values.
+func (c *Conn) QueryToGraphML(r Request, w io.Writer, o GraphOptions) error {
+	nc, rc, err := o.captions()
+	if err != nil {
+		return err
+	}
+	g, err := c.subgraph(r)
+	if err != nil {
+		return err
+	}
+	return g.writeGraphML(w, nc, rc)
+}
+
+// subgraph executes the Request and collects the graph values of the result.
+func (c *Conn) subgraph(r Request) (*subgraph, error) {
+	g := newSubgraph()
+	_, err := NewTemplate[any](c).execute(r, func(res neo4j.Result) error {
+		for res.Next() {
+			for _, v := range res.Record().Values {
+				g.add(v)
+			}
+		}
+		return nil
+	})
+	return g, err
+}
+
+// captions parses the templates of the GraphOptions.
+func (o GraphOptions) captions() (func(neo4j.Node) (string, error), func(neo4j.Relationship) (string, error), error) {
+	nc, rc := func(n neo4j.Node) (string, error) { return nodeCaption(n, ""), nil }, relType
+	if o.NodeCaption != "" {
+		t, err := template.New("node").Parse(o.NodeCaption)
+		if err != nil {
+			return nil, nil, err
+		}
+		nc = func(n neo4j.Node) (string, error) { return execCaption(t, NodeOf(n)) }
+	}
+	if o.RelCaption != "" {
+		t, err := template.New("relationship").Parse(o.RelCaption)
+		if err != nil {
+			return nil, nil, err
+		}
+		rc = func(r neo4j.Relationship) (string, error) { return execCaption(t, RelationshipOf(r)) }
+	}
+	return nc, rc, nil
+}
+
+// execCaption executes the caption template with the given value.
+func execCaption(t *template.Template, v any) (string, error) {
+	var sb strings.Builder
+	err := t.Execute(&sb, v)
+	return sb.String(), err
+}
+
+// relType returns the type of the Relationship.
+func relType(r neo4j.Relationship) (string, error) {
+	return r.Type, nil
+}
+
+// subgraph collects distinct Nodes and Relationships in order of appearance.
+type subgraph struct {
+	nodes   []neo4j.Node
+	rels    []neo4j.Relationship
+	nodeIDs map[int64]bool
+	relIDs  map[int64]bool
+}
+
+// newSubgraph creates an empty subgraph.
+func newSubgraph() *subgraph {
+	return &subgraph{nodeIDs: make(map[int64]bool), relIDs: make(map[int64]bool)}
+}
+
+// add adds all Nodes and Relationships contained in the value.
+func (g *subgraph) add(v any) {
+	switch v := v.(type) {
+	case neo4j.Node:
+		if !g.nodeIDs[v.Id] {
+			g.nodeIDs[v.Id] = true
+			g.nodes = append(g.nodes, v)
+		}
+	case neo4j.Relationship:
+		if !g.relIDs[v.Id] {
+			g.relIDs[v.Id] = true
+			g.rels = append(g.rels, v)
+		}
+	case neo4j.Path:
+		for _, n := range v.Nodes {
+			g.add(n)
+		}
+		for _, r := range v.Relationships {
+			g.add(r)
+		}
+	case []any:
+		for _, e := range v {
+			g.add(e)
+		}
+	}
+}
+
+// writeDOT renders the subgraph as directed GraphViz graph.
+func (g *subgraph) writeDOT(w io.Writer, nc func(neo4j.Node) (string, error), rc func(neo4j.Relationship) (string, error)) error {
+	bw := bufio.NewWriter(w)
+	_, _ = fmt.Fprintln(bw, "digraph {")
+	for _, n := range g.nodes {
+		s, err := nc(n)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(bw, "  n%d [label=%s];\n", n.Id, strconv.Quote(s))
+	}
+	for _, r := range g.rels {
+		s, err := rc(r)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(bw, "  n%d -> n%d [label=%s];\n", r.StartId, r.EndId, strconv.Quote(s))
+	}
+	_, _ = fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// graphMLKey is a data key of a GraphML document.
+type graphMLKey struct {
+	id, typ string
+}
+
+// writeGraphML renders the subgraph as directed GraphML graph.
+func (g *subgraph) writeGraphML(w io.Writer, nc func(neo4j.Node) (string, error), rc func(neo4j.Relationship) (string, error)) error {
+	nks, rks := make(map[string]*graphMLKey), make(map[string]*graphMLKey)
+	for _, n := range g.nodes {
+		addKeys(nks, n.Props)
+	}
+	for _, r := range g.rels {
+		addKeys(rks, r.Props)
+	}
+
+	bw := bufio.NewWriter(w)
+	_, _ = fmt.Fprintln(bw, xml.Header+`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	_, _ = fmt.Fprintln(bw, `  <key id="caption" for="all" attr.name="caption" attr.type="string"/>`)
+	_, _ = fmt.Fprintln(bw, `  <key id="labels" for="node" attr.name="labels" attr.type="string"/>`)
+	_, _ = fmt.Fprintln(bw, `  <key id="type" for="edge" attr.name="type" attr.type="string"/>`)
+	nps, rps := writeKeys(bw, "node", "np", nks), writeKeys(bw, "edge", "ep", rks)
+	_, _ = fmt.Fprintln(bw, `  <graph id="G" edgedefault="directed">`)
+	for _, n := range g.nodes {
+		s, err := nc(n)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(bw, `    <node id="n%d">`, n.Id)
+		writeData(bw, "caption", s)
+		writeData(bw, "labels", ":"+strings.Join(n.Labels, ":"))
+		for _, p := range nps {
+			if v, ok := n.Props[p]; ok && v != nil {
+				writeData(bw, nks[p].id, fmt.Sprint(v))
+			}
+		}
+		_, _ = fmt.Fprintln(bw, "</node>")
+	}
+	for _, r := range g.rels {
+		s, err := rc(r)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(bw, `    <edge id="e%d" source="n%d" target="n%d">`, r.Id, r.StartId, r.EndId)
+		writeData(bw, "caption", s)
+		writeData(bw, "type", r.Type)
+		for _, p := range rps {
+			if v, ok := r.Props[p]; ok && v != nil {
+				writeData(bw, rks[p].id, fmt.Sprint(v))
+			}
+		}
+		_, _ = fmt.Fprintln(bw, "</edge>")
+	}
+	_, _ = fmt.Fprintln(bw, "  </graph>\n</graphml>")
+	return bw.Flush()
+}
+
+// addKeys registers the properties and widens the attribute type of their
+// keys, if values of different types occur.
+func addKeys(ks map[string]*graphMLKey, props map[string]any) {
+	for p, v := range props {
+		if v == nil {
+			continue
+		}
+		t := graphMLType(v)
+		if k, ok := ks[p]; !ok {
+			ks[p] = &graphMLKey{typ: t}
+		} else if k.typ != t {
+			if k.typ == "long" && t == "double" || k.typ == "double" && t == "long" {
+				k.typ = "double"
+			} else {
+				k.typ = "string"
+			}
+		}
+	}
+}
+
+// writeKeys writes the key definitions in order of the property names, assigns
+// their ids and returns the sorted property names.
+func writeKeys(w io.Writer, domain, prefix string, ks map[string]*graphMLKey) []string {
+	ps := make([]string, 0, len(ks))
+	for p := range ks {
+		ps = append(ps, p)
+	}
+	sort.Strings(ps)
+	for i, p := range ps {
+		ks[p].id = prefix + strconv.Itoa(i)
+		_, _ = fmt.Fprintf(w, `  <key id="%s" for="%s" attr.name="%s" attr.type="%s"/>`+"\n",
+			ks[p].id, domain, escapeXML(p), ks[p].typ)
+	}
+	return ps
+}
+
+// writeData writes a data element with the escaped value.
+func writeData(w io.Writer, key, val string) {
+	_, _ = fmt.Fprintf(w, `<data key="%s">%s</data>`, key, escapeXML(val))
+}
+
+// graphMLType returns the GraphML attribute type of a property value.
+func graphMLType(v any) string {
+	switch v.(type) {
+	case bool:
+		return "boolean"
+	case int64:
+		return "long"
+	case float64:
+		return "double"
+	}
+	return "string"
+}
+
+// escapeXML escapes the characters, which are not allowed in XML text and
+// attributes.
+func escapeXML(s string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+// nodeCaption returns the value of the property or the primary label.
+func nodeCaption(n neo4j.Node, prop string) string {
+	if v, ok := n.Props[prop]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	if len(n.Labels) > 0 {
+		return n.Labels[0]
+	}
+	return strconv.FormatInt(n.Id, 10)
+}
@@ -0,0 +1,94 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// MaxEgoDepth is the maximum number of hops supported by EgoNetwork.
+const MaxEgoDepth = 3
+
+// EgoNodeLimit is the maximum number of neighbors returned by EgoNetwork.
+const EgoNodeLimit = 1000
+
+// Neighborhood is a node together with its neighbors and the relationships
+// between all of them.
+type Neighborhood struct {
+	Center        neo4j.Node
+	Nodes         []neo4j.Node
+	Relationships []neo4j.Relationship
+}
+
+// EgoNetwork returns the node with the given label and key properties, the
+// nodes within the given number of hops, regardless of the direction, and all
+// relationships between them. The depth must be between 1 and MaxEgoDepth,
+// and at most EgoNodeLimit neighbors are returned, so that a densely connected
+// node cannot cause a huge fetch. If no node matches the key, ErrEmpty is
+// returned; if several nodes match, ErrMultiple.
+func (c *Conn) EgoNetwork(label string, key map[string]any, depth int) (nb Neighborhood, err error) {
+	if depth < 1 || depth > MaxEgoDepth {
+		return nb, fmt.Errorf("depth must be between 1 and %d, got %d", MaxEgoDepth, depth)
+	} else if len(key) == 0 {
+		return nb, errors.New("at least one key property is required")
+	}
+
+	ks := maps.Keys(key)
+	slices.Sort(ks)
+	params := map[string]any{"limit": EgoNodeLimit}
+	conds := make([]string, len(ks))
+	for i, k := range ks {
+		p := "k" + strconv.Itoa(i)
+		params[p] = key[k]
+		conds[i] = "c." + Quote(k) + " = $" + p
+	}
+
+	cyp := fmt.Sprintf("MATCH (c:%s) WHERE %s "+
+		"CALL { WITH c OPTIONAL MATCH (c)-[*1..%d]-(m) WHERE m <> c "+
+		"WITH DISTINCT m LIMIT $limit RETURN collect(m) AS ns } "+
+		"CALL { WITH c, ns UNWIND [c] + ns AS a MATCH (a)-[r]->(b) WHERE b = c OR b IN ns "+
+		"RETURN collect(DISTINCT r) AS rels } "+
+		"RETURN c, ns, rels", Quote(label), strings.Join(conds, " AND "), depth)
+
+	found := 0
+	_, err = NewTemplate[any](c).execute(Request{Query: cyp, Params: params}, func(res neo4j.Result) error {
+		nb, found = Neighborhood{}, 0
+		for res.Next() {
+			if found++; found > 1 {
+				return ErrMultiple
+			}
+			vs := res.Record().Values
+			nb.Center = vs[0].(neo4j.Node)
+			for _, n := range vs[1].([]any) {
+				nb.Nodes = append(nb.Nodes, n.(neo4j.Node))
+			}
+			for _, r := range vs[2].([]any) {
+				nb.Relationships = append(nb.Relationships, r.(neo4j.Relationship))
+			}
+		}
+		return nil
+	})
+	if err == nil && found == 0 && !c.DryRun {
+		err = ErrEmpty
+	}
+	return nb, err
+}
@@ -0,0 +1,286 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"reflect"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// field describes a struct field, which is mapped to a property.
+// The property key is taken from the "neo4j" tag, or derived from the field
+// name using the DefaultNaming strategy if the tag is absent.
+// Fields tagged with "-" are ignored.
+type field struct {
+	name      string
+	index     []int
+	opts      []string
+	version   bool
+	remainder bool
+	id        bool
+	rel       *relation
+	audit     string
+	encrypt   string
+}
+
+// fields returns all exported fields of the struct type, including the fields
+// of embedded structs. Embedded pointers to structs and their fields are
+// skipped, because they cannot be accessed, if the pointer is nil.
+func fields(typ reflect.Type) (fs []field) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	for _, f := range reflect.VisibleFields(typ) {
+		if !f.IsExported() || f.Anonymous && isStruct(f.Type) || viaPointer(typ, f.Index) {
+			continue
+		}
+
+		tag := f.Tag.Get("neo4j")
+		if tag == "-" {
+			continue
+		}
+		name, opt, _ := strings.Cut(tag, ",")
+		if strings.Contains(name, "=") {
+			name, opt = "", tag
+		}
+		if name == "" {
+			name = DefaultNaming(f.Name)
+		}
+		var opts []string
+		if opt != "" {
+			opts = strings.Split(opt, ",")
+		}
+		fs = append(fs, field{name: name, index: f.Index, opts: opts,
+			version: isVersion(name, opts, f.Type), remainder: isRemainder(opts, f.Type),
+			id: isID(opts, f.Type), rel: parseRel(opts, f.Type), audit: optValue(opts, "audit"),
+			encrypt: encryptOpt(opts)})
+	}
+	return fs
+}
+
+// isStruct returns whether the type is a struct or a pointer to one.
+func isStruct(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Struct
+}
+
+// viaPointer returns whether the field with the given index is promoted
+// through an embedded pointer.
+func viaPointer(typ reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		if typ = typ.Field(i).Type; typ.Kind() == reflect.Pointer {
+			return true
+		}
+	}
+	return false
+}
+
+// StructProperty describes a field of a struct type, which is mapped to a
+// property.
+type StructProperty struct {
+	Key   string
+	Field reflect.StructField
+	Opts  []string
+}
+
+// StructProperties returns the fields of the struct type, which are mapped to
+// properties, in the order of the fields. Like fields, it follows pointers and
+// includes embedded structs, but ids, remainders and relationships are
+// omitted, because they are not stored as properties. It panics, if typ is
+// not a struct type or a pointer to one.
+func StructProperties(typ reflect.Type) []StructProperty {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	var ps []StructProperty
+	for _, f := range fields(typ) {
+		if f.id || f.remainder || f.rel != nil {
+			continue
+		}
+		ps = append(ps, StructProperty{Key: f.name, Field: typ.FieldByIndex(f.index), Opts: f.opts})
+	}
+	return ps
+}
+
+// isVersion returns whether a field holds the version used for optimistic
+// locking. This is the case for integer fields tagged `neo4j:"version"` or
+// having the "version" option e.g., `neo4j:"rev,version"`.
+func isVersion(name string, opts []string, typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return name == "version" || slices.Contains(opts, "version")
+	default:
+		return false
+	}
+}
+
+// isRemainder returns whether a field captures all properties, which are not
+// mapped to other fields. This is the case for fields of type map[string]any
+// having the "remainder" option e.g., `neo4j:",remainder"`.
+func isRemainder(opts []string, typ reflect.Type) bool {
+	return typ == reflect.TypeOf(map[string]any(nil)) && slices.Contains(opts, "remainder")
+}
+
+// softDelete returns whether the field holds the time, when the node was
+// soft-deleted e.g., `neo4j:"deletedAt,softDelete"`. It is only written by
+// Repository.DeleteByID and Template.SoftDeleteByID.
+func (f field) softDelete() bool {
+	return slices.Contains(f.opts, "softDelete")
+}
+
+// encryptOpt returns "random" or "deterministic" for fields, whose property is
+// encrypted e.g., `neo4j:",encrypted"` or `neo4j:",encrypted=deterministic"`,
+// respectively, and an empty string otherwise. See DefaultKeyProvider.
+func encryptOpt(opts []string) string {
+	if slices.Contains(opts, "encrypted") {
+		return "random"
+	}
+	return optValue(opts, "encrypted")
+}
+
+// optValue returns the value of an option of the form key=value e.g.,
+// "audit=created", or an empty string, if there is no such option.
+func optValue(opts []string, key string) string {
+	for _, o := range opts {
+		if k, v, ok := strings.Cut(o, "="); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// isID returns whether a field holds the internal ID of the node e.g.,
+// `neo4j:",id"`. The ID is not written as a property.
+func isID(opts []string, typ reflect.Type) bool {
+	return typ.Kind() == reflect.Int64 && slices.Contains(opts, "id")
+}
+
+// idField returns the field holding the internal ID, if any.
+func idField(fs []field) (field, bool) {
+	for _, f := range fs {
+		if f.id {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// versionField returns the field used for optimistic locking, if any.
+func versionField(fs []field) (field, bool) {
+	for _, f := range fs {
+		if f.version {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// NullPolicy controls, which fields of an entity are written.
+type NullPolicy int
+
+const (
+	// OmitNil skips nil pointers, maps, slices and interfaces, so that the
+	// corresponding properties are left intact. This is the default.
+	OmitNil NullPolicy = iota
+	// OmitZero skips all fields having their zero value.
+	OmitZero
+	// WriteAll writes all fields and replaces all properties of the node i.e.,
+	// properties, which are nil or not mapped to a field, are removed.
+	WriteAll
+)
+
+// setOp returns the Cypher operator used to set the properties of a node.
+func (p NullPolicy) setOp() string {
+	if p == WriteAll {
+		return "="
+	}
+	return "+="
+}
+
+// props extracts the properties of a struct, except for the version field,
+// the id field and relationship fields. Temporal options of fields, such as
+// "date", are applied. The values of encrypted fields are encrypted, when the
+// parameters are passed to the driver (see EncryptParams).
+// Depending on the NullPolicy, nil or zero values are omitted. The entries of
+// the remainder field are written as well, unless another field has the same
+// property key.
+func props(v reflect.Value, fs []field, p NullPolicy) map[string]any {
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	m := make(map[string]any, len(fs))
+	var rest map[string]any
+	for _, f := range fs {
+		fv := v.FieldByIndex(f.index)
+		if f.remainder {
+			rest = fv.Interface().(map[string]any)
+			continue
+		} else if f.version || f.id || f.rel != nil || f.softDelete() ||
+			p == OmitNil && isNil(fv) || p == OmitZero && fv.IsZero() {
+			continue
+		}
+		if f.encrypt != "" && !isNil(fv) {
+			m[f.name] = sealed{prop: f.name, val: propValue(fv), deterministic: f.encrypt == "deterministic"}
+			continue
+		}
+		m[f.name] = temporalValue(propValue(fv), f.opts)
+	}
+	for k, val := range rest {
+		if _, ok := m[k]; !ok && !hasField(fs, k) {
+			m[k] = val
+		}
+	}
+	return m
+}
+
+// propValue returns the value of a field as it is written to the database.
+// Byte slices of named types and byte arrays, such as [32]byte hashes, are
+// converted to []byte, because the driver would write them as a list of
+// integers or reject them, respectively.
+func propValue(v reflect.Value) any {
+	isByte := (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() == reflect.Uint8
+	switch {
+	case !isByte || v.Type() == reflect.TypeOf([]byte(nil)):
+		return v.Interface()
+	case v.Kind() == reflect.Slice && v.IsNil():
+		return []byte(nil)
+	}
+	b := make([]byte, v.Len())
+	reflect.Copy(reflect.ValueOf(b), v)
+	return b
+}
+
+// hasField returns whether a field, other than the remainder field, is mapped
+// to the given property key.
+func hasField(fs []field, key string) bool {
+	return slices.IndexFunc(fs, func(f field) bool {
+		return f.name == key && !f.remainder
+	}) >= 0
+}
+
+// isNil returns whether the value is nil. Unlike reflect.Value.IsNil, it
+// returns false for kinds, which cannot be nil.
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
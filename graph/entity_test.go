@@ -0,0 +1,139 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type blob []byte
+
+type hashes struct {
+	Raw   []byte
+	Named blob
+	Hash  [4]byte
+	Ptr   *[]byte
+	List  []int
+}
+
+func TestPropValue(t *testing.T) {
+	raw := []byte{1, 2}
+	tests := []struct {
+		name string
+		in   any
+		want any
+	}{
+		{name: "byte slice", in: raw, want: raw},
+		{name: "nil byte slice", in: []byte(nil), want: []byte(nil)},
+		{name: "named byte slice", in: blob{3, 4}, want: []byte{3, 4}},
+		{name: "nil named byte slice", in: blob(nil), want: []byte(nil)},
+		{name: "byte array", in: [4]byte{5, 6, 7, 8}, want: []byte{5, 6, 7, 8}},
+		{name: "empty byte array", in: [0]byte{}, want: []byte{}},
+		{name: "int slice", in: []int{1, 2}, want: []int{1, 2}},
+		{name: "string", in: "abc", want: "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := propValue(reflect.ValueOf(tt.in))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("propValue(%#v) = %#v (%[2]T), want %#v (%[3]T)", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestByteRoundTrip(t *testing.T) {
+	ptr := []byte{9}
+	in := hashes{Raw: []byte{1, 2}, Named: blob{3}, Hash: [4]byte{4, 5, 6, 7}, Ptr: &ptr, List: []int{8}}
+	fs := fields(reflect.TypeOf(in))
+	ps := props(reflect.ValueOf(in), fs, WriteAll)
+	for _, k := range []string{"Raw", "Named", "Hash"} {
+		if _, ok := ps[k].([]byte); !ok {
+			t.Errorf("property %s = %#v (%[2]T), want []byte", k, ps[k])
+		}
+	}
+
+	var out hashes
+	v := reflect.ValueOf(&out).Elem()
+	for _, f := range fs {
+		if err := (Decoder{}).setValue(v.FieldByIndex(f.index), ps[f.name]); err != nil {
+			t.Fatalf("setValue(%s, %#v): %v", f.name, ps[f.name], err)
+		}
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip = %#v, want %#v", out, in)
+	}
+}
+
+func TestSetValueByteArray(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      any
+		want    [4]byte
+		wantErr bool
+	}{
+		{name: "same length", in: []byte{1, 2, 3, 4}, want: [4]byte{1, 2, 3, 4}},
+		{name: "too short", in: []byte{1, 2, 3}, wantErr: true},
+		{name: "too long", in: []byte{1, 2, 3, 4, 5}, wantErr: true},
+		{name: "not bytes", in: "abcd", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [4]byte
+			err := (Decoder{}).setValue(reflect.ValueOf(&got).Elem(), tt.in)
+			var cerr *ConversionError
+			if tt.wantErr != errors.As(err, &cerr) {
+				t.Fatalf("setValue(%#v) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got[:], tt.want[:]) {
+				t.Errorf("setValue(%#v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+type EmbeddedBase struct {
+	ID   int64 `neo4j:",id"`
+	Kind string
+}
+
+type embeddingPtr struct {
+	*EmbeddedBase
+	Name string
+}
+
+func TestFieldsEmbeddedPointer(t *testing.T) {
+	fs := fields(reflect.TypeOf(embeddingPtr{}))
+	if len(fs) != 1 || fs[0].name != "Name" {
+		t.Fatalf("fields = %+v, want only Name", fs)
+	}
+
+	in := embeddingPtr{Name: "Alice"}
+	ps := props(reflect.ValueOf(in), fs, WriteAll)
+	if want := map[string]any{"Name": "Alice"}; !reflect.DeepEqual(ps, want) {
+		t.Errorf("props = %#v, want %#v", ps, want)
+	}
+
+	var out embeddingPtr
+	get := func(key string) (any, bool) { v, ok := ps[key]; return v, ok }
+	if err := (Decoder{}).decodeFunc(get, []string{"Name"}, reflect.ValueOf(&out).Elem(), fs); err != nil {
+		t.Fatalf("decodeFunc: %v", err)
+	} else if out.Name != "Alice" || out.EmbeddedBase != nil {
+		t.Errorf("decoded = %+v, want Name Alice and nil embedded pointer", out)
+	}
+}
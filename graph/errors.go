@@ -0,0 +1,411 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// ErrPoolExhausted indicates that no connection could be acquired from the
+// pool within the acquisition timeout.
+var ErrPoolExhausted = errors.New("connection pool exhausted")
+
+// ErrClientTimeout indicates that the deadline of the context passed by the
+// caller expired before the query completed.
+var ErrClientTimeout = errors.New("client timeout")
+
+// ErrServerTimeout indicates that the server terminated the Transaction,
+// because it ran longer than the transaction timeout.
+var ErrServerTimeout = errors.New("server timeout")
+
+// QueryError wraps an error returned by the driver while executing a query.
+type QueryError struct {
+	Query string
+	Err   error
+}
+
+// wrapErr wraps err in a QueryError unless it is nil. Errors reported by the
+// server are classified, if possible e.g., as ConstraintViolationError.
+func wrapErr(query string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &QueryError{Query: query, Err: classify(err)}
+}
+
+// Error returns the message of the underlying error.
+func (e *QueryError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error matches the target. In addition to the errors
+// in the chain, it matches ErrPoolExhausted, if the driver failed to acquire a
+// connection from the pool, and ErrServerTimeout, if the Transaction timed out.
+func (e *QueryError) Is(target error) bool {
+	return target == ErrPoolExhausted && isPoolExhausted(e.Err) ||
+		target == ErrServerTimeout && e.IsServerTimeout()
+}
+
+// isPoolExhausted returns whether the error was caused by a full pool.
+// The driver does not expose the types of pool errors, so the message of the
+// ConnectivityError is inspected.
+func isPoolExhausted(err error) bool {
+	if !neo4j.IsConnectivityError(err) {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "Timeout while waiting for connection") ||
+		strings.Contains(msg, "No idle connections")
+}
+
+// Code returns the Neo4j status code e.g., "Neo.ClientError.Security.Forbidden"
+// or an empty string, if the error was not reported by the server.
+func (e *QueryError) Code() string {
+	var nerr *neo4j.Neo4jError
+	if errors.As(e.Err, &nerr) {
+		return nerr.Code
+	}
+	return ""
+}
+
+// IsAuthError returns whether the error was caused by missing, invalid or
+// expired credentials. It corresponds to HTTP status 401.
+func (e *QueryError) IsAuthError() bool {
+	var terr *neo4j.TokenExpiredError
+	if errors.As(e.Err, &terr) {
+		return true
+	}
+	switch e.Code() {
+	case "Neo.ClientError.Security.Unauthorized",
+		"Neo.ClientError.Security.AuthenticationRateLimit",
+		"Neo.ClientError.Security.CredentialsExpired",
+		"Neo.ClientError.Security.TokenExpired":
+		return true
+	}
+	return false
+}
+
+// IsForbidden returns whether the authenticated user lacks the privileges to
+// execute the query. It corresponds to HTTP status 403.
+func (e *QueryError) IsForbidden() bool {
+	return e.Code() == "Neo.ClientError.Security.Forbidden"
+}
+
+// Retryable returns whether executing the query again might succeed.
+// Like in the driver, Transactions terminated by a user or an administrator
+// are not retried, although the server classifies them as transient.
+// Security errors are never retryable either.
+func (e *QueryError) Retryable() bool {
+	switch e.Code() {
+	case "Neo.TransientError.Transaction.Terminated",
+		"Neo.TransientError.Transaction.LockClientStopped",
+		"Neo.ClientError.Transaction.Terminated",
+		"Neo.ClientError.Transaction.LockClientStopped":
+		return false
+	}
+	if e.IsAuthError() || strings.HasPrefix(e.Code(), "Neo.ClientError.Security.") {
+		return false
+	}
+	return strings.HasPrefix(e.Code(), "Neo.TransientError.") || neo4j.IsConnectivityError(e.Err)
+}
+
+// IsServerTimeout returns whether the server terminated the Transaction,
+// because it exceeded the transaction timeout.
+func (e *QueryError) IsServerTimeout() bool {
+	return strings.HasPrefix(e.Code(), "Neo.ClientError.Transaction.TransactionTimedOut")
+}
+
+// TimeoutError indicates that a query did not complete in time. It matches
+// ErrServerTimeout if the transaction timeout of the server expired, and
+// ErrClientTimeout if the deadline of the context expired. The remedies differ:
+// the former is configured by the Request or the Conn, the latter by the
+// caller.
+type TimeoutError struct {
+	Server bool
+	Err    error
+}
+
+// Error describes, which timeout expired.
+func (e *TimeoutError) Error() string {
+	if e.Server {
+		return "server timeout: " + e.Err.Error()
+	}
+	return "client timeout: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error e.g., context.DeadlineExceeded.
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrServerTimeout or ErrClientTimeout,
+// depending on which timeout expired.
+func (e *TimeoutError) Is(target error) bool {
+	return e.Server && target == ErrServerTimeout || !e.Server && target == ErrClientTimeout
+}
+
+// MappingError indicates that a value of a Record could not be mapped.
+// Since a Mapper cannot return an error, it panics with a MappingError, which
+// is recovered by the Template and returned as error.
+type MappingError struct {
+	Key string
+	Err error
+}
+
+// Error returns the key and the reason why it could not be mapped.
+// If several keys could not be mapped, Key is empty and Err combines the
+// MappingErrors of all keys.
+func (e *MappingError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("cannot map record: %v", e.Err)
+	}
+	return fmt.Sprintf("cannot map %q: %v", e.Key, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *MappingError) Unwrap() error {
+	return e.Err
+}
+
+// ConversionError indicates that a value cannot be converted to the type of
+// a field. If Overflow is true, the value is a number, which is out of the
+// range of the type, or a fractional number assigned to an integer type.
+type ConversionError struct {
+	Value    any
+	Type     reflect.Type
+	Overflow bool
+}
+
+// Error describes the value and the target type.
+func (e *ConversionError) Error() string {
+	if e.Overflow {
+		return fmt.Sprintf("%v overflows %s", e.Value, e.Type)
+	}
+	return fmt.Sprintf("cannot assign %T to %s", e.Value, e.Type)
+}
+
+// recoverMapping recovers from a panic caused by a MappingError and stores the
+// MappingError in err. Other panics are propagated.
+func recoverMapping(err *error) {
+	if p := recover(); p != nil {
+		merr, ok := p.(*MappingError)
+		if !ok {
+			panic(p)
+		}
+		*err = merr
+	}
+}
+
+// multiError combines several errors into one.
+type multiError []error
+
+// joinErrs returns nil, the only error, or a multiError of all errors.
+func joinErrs(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return multiError(append([]error(nil), errs...))
+	}
+}
+
+// Error returns the messages of all errors, separated by newlines.
+func (e multiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the combined errors.
+func (e multiError) Unwrap() []error {
+	return e
+}
+
+// Is reports whether any of the combined errors matches the target. Unlike
+// Unwrap, which is only followed by the errors package since Go 1.20, it
+// also works with Go 1.19.
+func (e multiError) Is(target error) bool {
+	return anyIs(e, target)
+}
+
+// As finds the first of the combined errors, which matches the target, like
+// errors.As. See Is.
+func (e multiError) As(target any) bool {
+	return anyAs(e, target)
+}
+
+// anyIs reports whether any of the errors matches the target.
+func anyIs(errs []error, target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyAs finds the first of the errors, which matches the target.
+func anyAs(errs []error, target any) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// syntaxPos matches the position of a syntax error in its message.
+	syntaxPos = regexp.MustCompile(`\(line (\d+), column (\d+) \(offset: (\d+)\)\)`)
+	// violation matches the label and property in the message of a violated
+	// uniqueness or node key constraint.
+	violation = regexp.MustCompile("with label `([^`]*)` and propert(?:y|ies) `([^`]*)`")
+)
+
+// ConstraintViolationError indicates that a write violated a constraint e.g.,
+// a duplicate value of a unique property. Label and Property are extracted
+// from the message, if possible.
+type ConstraintViolationError struct {
+	Code     string
+	Msg      string
+	Label    string
+	Property string
+	Err      error
+}
+
+// TransientError indicates a temporary failure e.g., a deadlock or a leader
+// switch, after which the Transaction may be retried.
+type TransientError struct {
+	Code string
+	Msg  string
+	Err  error
+}
+
+// AuthError indicates that the credentials are missing, invalid or expired.
+type AuthError struct {
+	Code string
+	Msg  string
+	Err  error
+}
+
+// SyntaxError indicates an invalid query. Line and Column are 1-based, and
+// Offset is the 0-based position in the query. They are 0, if the server did
+// not report the position.
+type SyntaxError struct {
+	Msg    string
+	Line   int
+	Column int
+	Offset int
+	Err    error
+}
+
+// Error returns the message of the server.
+func (e *ConstraintViolationError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error reported by the driver.
+func (e *ConstraintViolationError) Unwrap() error {
+	return e.Err
+}
+
+// Error returns the message of the server.
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error reported by the driver.
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// Error returns the message of the server.
+func (e *AuthError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error reported by the driver.
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// Error returns the message of the server.
+func (e *SyntaxError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error reported by the driver.
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// ClassifyError wraps an error reported by the server in the type corresponding
+// to its status code e.g., ConstraintViolationError, like the errors returned
+// by Conn. It allows adapters for other driver versions to classify errors,
+// which convert to errors of driver v4 using errors.As.
+func ClassifyError(err error) error {
+	return classify(err)
+}
+
+// classify wraps an error reported by the server in the type corresponding to
+// its status code. Other errors are returned as they are.
+func classify(err error) error {
+	var terr *neo4j.TokenExpiredError
+	if errors.As(err, &terr) {
+		return &AuthError{Code: terr.Code, Msg: terr.Message, Err: err}
+	}
+	var nerr *neo4j.Neo4jError
+	if !errors.As(err, &nerr) {
+		return err
+	}
+
+	switch code := nerr.Code; {
+	case code == "Neo.ClientError.Schema.ConstraintValidationFailed":
+		cv := &ConstraintViolationError{Code: code, Msg: nerr.Msg, Err: err}
+		if m := violation.FindStringSubmatch(nerr.Msg); m != nil {
+			cv.Label, cv.Property = m[1], m[2]
+		}
+		return cv
+	case code == "Neo.ClientError.Statement.SyntaxError":
+		se := &SyntaxError{Msg: nerr.Msg, Err: err}
+		if m := syntaxPos.FindStringSubmatch(nerr.Msg); m != nil {
+			se.Line, _ = strconv.Atoi(m[1])
+			se.Column, _ = strconv.Atoi(m[2])
+			se.Offset, _ = strconv.Atoi(m[3])
+		}
+		return se
+	case (&QueryError{Err: err}).IsAuthError():
+		return &AuthError{Code: code, Msg: nerr.Msg, Err: err}
+	case strings.HasPrefix(code, "Neo.TransientError."):
+		return &TransientError{Code: code, Msg: nerr.Msg, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+
+	"github.com/abc-inc/roland/plan"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// PlanWarnings lists the operators, which are reported to Conn.PlanWarning,
+// because they often indicate a missing index or an unintentionally
+// disconnected pattern.
+var PlanWarnings = []string{"AllNodesScan", "CartesianProduct"}
+
+// Explain plans the query of the Request using EXPLAIN without executing it,
+// and returns the plan with the estimated rows of each operation.
+func (t Template[T]) Explain(r Request) (*plan.Op, error) {
+	r.Query = "EXPLAIN " + r.Query
+	sum, err := t.execute(r, discard)
+	if err != nil {
+		return nil, err
+	} else if sum.Plan() == nil {
+		return nil, errors.New("no plan returned")
+	}
+	op := plan.FromPlan(sum.Plan())
+	t.conn.checkPlan(r, op)
+	return op, nil
+}
+
+// Profile executes the query of the Request using PROFILE, discards its
+// Records and returns the plan with the rows and DB hits of each operation.
+// Unlike Explain, the query is executed, including its writes.
+func (t Template[T]) Profile(r Request) (*plan.Op, neo4j.ResultSummary, error) {
+	r.Query = "PROFILE " + r.Query
+	sum, err := t.execute(r, discard)
+	if err != nil {
+		return nil, nil, err
+	} else if sum.Profile() == nil {
+		return nil, sum, errors.New("no profile returned")
+	}
+	op := plan.FromProfile(sum.Profile())
+	t.conn.checkPlan(r, op)
+	return op, sum, nil
+}
+
+// checkPlan passes all operations of the plan, which are listed in
+// PlanWarnings, to the PlanWarning hook of the Conn.
+func (c *Conn) checkPlan(r Request, op *plan.Op) {
+	if c.PlanWarning == nil {
+		return
+	}
+	for _, w := range op.Find(PlanWarnings...) {
+		c.PlanWarning(r, w)
+	}
+}
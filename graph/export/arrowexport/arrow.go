@@ -0,0 +1,161 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package arrowexport implements export.BatchWriters for Apache Arrow IPC
+// streams and Parquet files.
+//
+// Timestamps are written with microsecond precision in UTC, Dates as days
+// since the epoch, and Lists as lists of their element type. Nested Lists are
+// not supported.
+//
+//	w := arrowexport.NewParquetWriter(f)
+//	err := export.Exporter{}.Export(ctx, c, r, w)
+//	if err == nil {
+//		err = w.Close()
+//	}
+package arrowexport
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/abc-inc/roland/graph/export"
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// timestampType is the Arrow type of Timestamp columns.
+var timestampType = &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+
+// Schema converts the export Schema to an Arrow schema. All fields are
+// nullable.
+func Schema(fs []export.Field) (*arrow.Schema, error) {
+	afs := make([]arrow.Field, len(fs))
+	for i, f := range fs {
+		dt, err := dataType(f.Type)
+		if err == nil && f.Type == export.List {
+			var et arrow.DataType
+			if et, err = dataType(f.Elem); err == nil {
+				dt = arrow.ListOf(et)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %w", f.Name, err)
+		}
+		afs[i] = arrow.Field{Name: f.Name, Type: dt, Nullable: true}
+	}
+	return arrow.NewSchema(afs, nil), nil
+}
+
+// dataType returns the Arrow type of a scalar Type. For List, it returns nil.
+func dataType(t export.Type) (arrow.DataType, error) {
+	switch t {
+	case export.String:
+		return arrow.BinaryTypes.String, nil
+	case export.Bool:
+		return arrow.FixedWidthTypes.Boolean, nil
+	case export.Int64:
+		return arrow.PrimitiveTypes.Int64, nil
+	case export.Float64:
+		return arrow.PrimitiveTypes.Float64, nil
+	case export.Bytes:
+		return arrow.BinaryTypes.Binary, nil
+	case export.Timestamp:
+		return timestampType, nil
+	case export.Date:
+		return arrow.FixedWidthTypes.Date32, nil
+	case export.List:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", t)
+}
+
+// Record converts the Batch to an Arrow record with the given schema, which
+// must correspond to the Schema of the Batch. The caller must release the
+// record.
+func Record(mem memory.Allocator, schema *arrow.Schema, b export.Batch) (arrow.Record, error) {
+	rb := array.NewRecordBuilder(mem, schema)
+	defer rb.Release()
+	for i, col := range b.Columns {
+		for _, v := range col {
+			if err := appendValue(rb.Field(i), v); err != nil {
+				return nil, fmt.Errorf("column %q: %w", b.Schema[i].Name, err)
+			}
+		}
+	}
+	return rb.NewRecord(), nil
+}
+
+// appendValue appends a value of a Batch to the builder of its column.
+func appendValue(b array.Builder, v any) error {
+	if v == nil {
+		b.AppendNull()
+		return nil
+	}
+	ok := true
+	switch b := b.(type) {
+	case *array.StringBuilder:
+		var s string
+		if s, ok = v.(string); ok {
+			b.Append(s)
+		}
+	case *array.BooleanBuilder:
+		var x bool
+		if x, ok = v.(bool); ok {
+			b.Append(x)
+		}
+	case *array.Int64Builder:
+		var x int64
+		if x, ok = v.(int64); ok {
+			b.Append(x)
+		}
+	case *array.Float64Builder:
+		var x float64
+		if x, ok = v.(float64); ok {
+			b.Append(x)
+		}
+	case *array.BinaryBuilder:
+		var x []byte
+		if x, ok = v.([]byte); ok {
+			b.Append(x)
+		}
+	case *array.TimestampBuilder:
+		var t time.Time
+		if t, ok = v.(time.Time); ok {
+			b.Append(arrow.Timestamp(t.UnixMicro()))
+		}
+	case *array.Date32Builder:
+		var t time.Time
+		if t, ok = v.(time.Time); ok {
+			b.Append(arrow.Date32FromTime(t))
+		}
+	case *array.ListBuilder:
+		var l []any
+		if l, ok = v.([]any); ok {
+			b.Append(true)
+			for _, e := range l {
+				if err := appendValue(b.ValueBuilder(), e); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported Arrow type %v", b.Type())
+	}
+	if !ok {
+		return fmt.Errorf("unexpected value of type %T", v)
+	}
+	return nil
+}
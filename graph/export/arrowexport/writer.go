@@ -0,0 +1,107 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arrowexport
+
+import (
+	"io"
+
+	"github.com/abc-inc/roland/graph/export"
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/apache/arrow/go/v12/parquet"
+	"github.com/apache/arrow/go/v12/parquet/pqarrow"
+)
+
+// recordWriter writes Arrow records to a format, which is opened with the
+// schema of the first Batch.
+type recordWriter interface {
+	Write(rec arrow.Record) error
+	Close() error
+}
+
+// batchWriter converts Batches to Arrow records and writes them.
+type batchWriter struct {
+	mem  memory.Allocator
+	open func(schema *arrow.Schema) (recordWriter, error)
+	rw   recordWriter
+	sch  *arrow.Schema
+}
+
+// WriteBatch converts the Batch to an Arrow record and writes it. The first
+// Batch determines the schema.
+func (w *batchWriter) WriteBatch(b export.Batch) error {
+	if w.rw == nil {
+		sch, err := Schema(b.Schema)
+		if err != nil {
+			return err
+		}
+		if w.rw, err = w.open(sch); err != nil {
+			return err
+		}
+		w.sch = sch
+	}
+	rec, err := Record(w.mem, w.sch, b)
+	if err != nil {
+		return err
+	}
+	defer rec.Release()
+	return w.rw.Write(rec)
+}
+
+// Close finishes the output. If no Batch was written, nothing is written.
+func (w *batchWriter) Close() error {
+	if w.rw == nil {
+		return nil
+	}
+	return w.rw.Close()
+}
+
+// IPCWriter writes Batches as Arrow IPC stream. Close must be called after
+// the export to write the end-of-stream marker.
+type IPCWriter struct {
+	batchWriter
+}
+
+// NewIPCWriter creates a new IPCWriter, which writes to w.
+func NewIPCWriter(w io.Writer) *IPCWriter {
+	mem := memory.DefaultAllocator
+	return &IPCWriter{batchWriter{mem: mem, open: func(sch *arrow.Schema) (recordWriter, error) {
+		return ipc.NewWriter(w, ipc.WithSchema(sch), ipc.WithAllocator(mem)), nil
+	}}}
+}
+
+// ParquetWriter writes Batches to a Parquet file, one row group per Batch.
+// Close must be called after the export to write the file footer. Note that
+// it does not close the underlying writer.
+type ParquetWriter struct {
+	batchWriter
+}
+
+// NewParquetWriter creates a new ParquetWriter, which writes to w.
+func NewParquetWriter(w io.Writer) *ParquetWriter {
+	mem := memory.DefaultAllocator
+	return &ParquetWriter{batchWriter{mem: mem, open: func(sch *arrow.Schema) (recordWriter, error) {
+		props := parquet.NewWriterProperties(parquet.WithAllocator(mem))
+		awp := pqarrow.NewArrowWriterProperties(pqarrow.WithAllocator(mem), pqarrow.WithStoreSchema())
+		return pqarrow.NewFileWriter(sch, nopCloser{w}, props, awp)
+	}}}
+}
+
+// nopCloser prevents the Parquet writer from closing the underlying writer,
+// which is owned by the caller.
+type nopCloser struct {
+	io.Writer
+}
@@ -0,0 +1,301 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package export streams query results in columnar batches, which can be
+// written to columnar formats such as Apache Arrow or Parquet.
+//
+// A format is supported by implementing BatchWriter. Package arrowexport
+// writes Arrow IPC streams and Parquet files. The Schema is either inferred
+// from the results, or derived from a struct type using SchemaOf.
+//
+// CSVWriter, JSONLinesWriter and JSONWriter write text formats e.g., for data
+// dumps and command line tools. Their Format selects and orders the columns,
+// and controls how nulls and temporal values are written:
+//
+//	w := export.NewCSVWriter(os.Stdout, export.Format{Columns: []string{"name", "born"}, Null: "n/a"})
+//	err := export.Exporter{}.Export(ctx, c, graph.Request{Query: "MATCH (p:Person) RETURN p.name AS name, p.born AS born"}, w)
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/abc-inc/roland/graph"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Type is the type of a column.
+type Type int
+
+const (
+	String Type = iota
+	Bool
+	Int64
+	Float64
+	Bytes
+	// Timestamp columns contain time.Time values in UTC.
+	Timestamp
+	// Date columns contain time.Time values at midnight UTC.
+	Date
+	// List columns contain []any values, whose elements are nil or of the Go
+	// type corresponding to the Elem of the Field.
+	List
+)
+
+// String returns the name of the Type.
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "String"
+	case Bool:
+		return "Bool"
+	case Int64:
+		return "Int64"
+	case Float64:
+		return "Float64"
+	case Bytes:
+		return "Bytes"
+	case Timestamp:
+		return "Timestamp"
+	case Date:
+		return "Date"
+	case List:
+		return "List"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// Field describes a column of a Batch. Elem is the type of the elements of
+// List columns.
+type Field struct {
+	Name string
+	Type Type
+	Elem Type
+}
+
+// Batch contains a chunk of rows in columnar layout i.e., Columns[i][j] is the
+// value of the Field Schema[i] in the j-th row. Values are nil or of the Go
+// type corresponding to the Type of the Field.
+type Batch struct {
+	Schema  []Field
+	Columns [][]any
+}
+
+// Len returns the number of rows in the Batch.
+func (b Batch) Len() int {
+	if len(b.Columns) == 0 {
+		return 0
+	}
+	return len(b.Columns[0])
+}
+
+// BatchWriter writes Batches to a columnar format. All Batches of an export
+// have the same Schema.
+type BatchWriter interface {
+	WriteBatch(b Batch) error
+}
+
+// Exporter streams the results of a query to a BatchWriter.
+type Exporter struct {
+	// Size is the maximum number of rows per Batch. If it is not positive,
+	// graph.DefaultBatchSize is used.
+	Size int
+	// Schema defines the columns and their types e.g., SchemaOf a struct
+	// type. If it is nil, the Schema is inferred from the first Batch: the
+	// type of a column is derived from its first non-null value, and columns
+	// containing only nulls are Strings. Likewise, the element type of a List
+	// column is derived from its first non-null element.
+	Schema []Field
+}
+
+// Export executes the Request and writes its Records to w in Batches. The
+// Records are streamed, so that at most one Batch is held in memory. Temporal
+// and spatial values are converted to Timestamps, Dates or Strings, and maps,
+// Nodes and Relationships are encoded as JSON Strings. A value, which cannot
+// be converted to the type of its column, fails the export.
+func (e Exporter) Export(ctx context.Context, c *graph.Conn, r graph.Request, w BatchWriter) error {
+	size := e.Size
+	if size <= 0 {
+		size = graph.DefaultBatchSize
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s := graph.NewTemplate[*neo4j.Record](c).Stream(ctx, r,
+		func(rec *neo4j.Record) *neo4j.Record { return rec }, size)
+
+	schema := e.Schema
+	var rows []*neo4j.Record
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		if schema == nil {
+			schema = inferSchema(rows)
+		}
+		b, err := newBatch(schema, rows)
+		if err == nil {
+			err = w.WriteBatch(b)
+		}
+		rows = rows[:0]
+		return err
+	}
+
+	for s.Next() {
+		if rows = append(rows, s.Value()); len(rows) == size {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// inferSchema derives the type of each column from its first non-null value.
+func inferSchema(rows []*neo4j.Record) []Field {
+	schema := make([]Field, len(rows[0].Keys))
+	for i, k := range rows[0].Keys {
+		schema[i] = Field{Name: k, Type: String}
+		for _, rec := range rows {
+			if v, typ := convert(rec.Values[i]); v != nil {
+				schema[i].Type = typ
+				break
+			}
+		}
+		if schema[i].Type == List {
+			schema[i].Elem = inferElem(rows, i)
+		}
+	}
+	return schema
+}
+
+// inferElem derives the element type of the i-th column from its first
+// non-null element.
+func inferElem(rows []*neo4j.Record, i int) Type {
+	for _, rec := range rows {
+		l, _ := rec.Values[i].([]any)
+		for _, e := range l {
+			if v, typ := convert(e); v != nil {
+				return typ
+			}
+		}
+	}
+	return String
+}
+
+// newBatch converts the Records to a Batch with the given Schema.
+func newBatch(schema []Field, rows []*neo4j.Record) (Batch, error) {
+	b := Batch{Schema: schema, Columns: make([][]any, len(schema))}
+	for i, f := range schema {
+		col := make([]any, len(rows))
+		for j, rec := range rows {
+			val, ok := rec.Get(f.Name)
+			if !ok {
+				return b, fmt.Errorf("column %q is missing", f.Name)
+			}
+			v, err := convertTo(val, f.Type)
+			if err == nil && v != nil && f.Type == List {
+				v, err = convertElems(v.([]any), f.Elem)
+			}
+			if err != nil {
+				return b, fmt.Errorf("column %q: %w", f.Name, err)
+			}
+			col[j] = v
+		}
+		b.Columns[i] = col
+	}
+	return b, nil
+}
+
+// convertTo converts a value returned by the driver to the given Type. Values
+// of other types are formatted, if typ is String, and rejected otherwise.
+func convertTo(val any, typ Type) (any, error) {
+	v, t := convert(val)
+	switch {
+	case v == nil || t == typ:
+		return v, nil
+	case typ == String:
+		return fmt.Sprint(v), nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to %v", val, typ)
+}
+
+// convertElems converts the elements of a list to the given Type.
+func convertElems(l []any, typ Type) ([]any, error) {
+	cl := make([]any, len(l))
+	for i, e := range l {
+		v, err := convertTo(e, typ)
+		if err != nil {
+			return nil, err
+		}
+		cl[i] = v
+	}
+	return cl, nil
+}
+
+// convert converts a value returned by the driver to the Go type of its Type.
+// For nil, the Type is String.
+func convert(val any) (any, Type) {
+	switch v := val.(type) {
+	case nil, string:
+		return v, String
+	case bool:
+		return v, Bool
+	case int64:
+		return v, Int64
+	case float64:
+		return v, Float64
+	case []byte:
+		return v, Bytes
+	case time.Time:
+		return v.UTC(), Timestamp
+	case neo4j.LocalDateTime:
+		t := time.Time(v)
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC), Timestamp
+	case neo4j.Date:
+		t := time.Time(v)
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), Date
+	case neo4j.LocalTime:
+		return time.Time(v).Format("15:04:05.999999999"), String
+	case neo4j.Time:
+		return time.Time(v).Format("15:04:05.999999999Z07:00"), String
+	case neo4j.Duration:
+		return v.String(), String
+	case neo4j.Point2D:
+		return fmt.Sprintf("POINT(%v %v)", v.X, v.Y), String
+	case neo4j.Point3D:
+		return fmt.Sprintf("POINT Z(%v %v %v)", v.X, v.Y, v.Z), String
+	case []any:
+		return v, List
+	case neo4j.Node:
+		return toJSON(v.Props), String
+	case neo4j.Relationship:
+		return toJSON(v.Props), String
+	}
+	return toJSON(val), String
+}
+
+// toJSON encodes the value as JSON, falling back to its default format.
+func toJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/abc-inc/roland/graph"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"golang.org/x/exp/slices"
+)
+
+// SchemaOf derives a Schema from the fields of the struct type T, which are
+// mapped to properties (see graph.StructProperties). The columns are named
+// after the property keys, so the query has to return them under these names:
+//
+//	schema, err := export.SchemaOf[Person]()
+//	err = export.Exporter{Schema: schema}.Export(ctx, c, graph.Request{Query: "MATCH (p:Person) RETURN p.name AS name, p.born AS born"}, w)
+//
+// Strings, booleans, integers, floats and byte slices map to the respective
+// Types, and time.Time maps to Timestamp or, if the field has the "date"
+// option, to Date. Other slices are Lists, whose element type is derived
+// likewise. All other types e.g., maps and structs, are Strings.
+func SchemaOf[T any]() ([]Field, error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot derive a schema from %v: not a struct", typ)
+	}
+
+	var schema []Field
+	for _, p := range graph.StructProperties(typ) {
+		f := Field{Name: p.Key, Type: typeOf(p.Field.Type, p.Opts)}
+		if f.Type == List {
+			f.Elem = typeOf(elemType(p.Field.Type).Elem(), p.Opts)
+		}
+		schema = append(schema, f)
+	}
+	return schema, nil
+}
+
+// typeOf returns the Type of the column, which a field of the Go type is
+// exported to.
+func typeOf(typ reflect.Type, opts []string) Type {
+	typ = elemType(typ)
+	switch typ {
+	case reflect.TypeOf(time.Time{}):
+		if slices.Contains(opts, "date") {
+			return Date
+		}
+		return Timestamp
+	case reflect.TypeOf(neo4j.Date{}):
+		return Date
+	case reflect.TypeOf(neo4j.LocalDateTime{}):
+		return Timestamp
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return Bool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Int64
+	case reflect.Float32, reflect.Float64:
+		return Float64
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return Bytes
+		}
+		return List
+	}
+	return String
+}
+
+// elemType dereferences pointer types.
+func elemType(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ
+}
@@ -0,0 +1,305 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Format controls how the text writers i.e., CSVWriter, JSONLinesWriter and
+// JSONWriter, write the values of a Batch.
+type Format struct {
+	// Columns selects the columns to write and their order. If it is empty,
+	// all columns are written in the order of the Schema.
+	Columns []string
+	// Null is written for null values in CSV. JSON writers write null, unless
+	// OmitNull is set.
+	Null string
+	// OmitNull omits null values from JSON objects.
+	OmitNull bool
+	// TimeFormat is the layout of Timestamps. It defaults to time.RFC3339Nano.
+	TimeFormat string
+	// DateFormat is the layout of Dates. It defaults to "2006-01-02".
+	DateFormat string
+	// Value optionally formats a non-null value of the Field. If it returns
+	// false, the value is formatted by default. The result is written as
+	// string, also in JSON.
+	Value func(f Field, v any) (string, bool)
+}
+
+// columns returns the indices of the Fields to write, in order.
+func (f Format) columns(schema []Field) ([]int, error) {
+	if len(f.Columns) == 0 {
+		idx := make([]int, len(schema))
+		for i := range idx {
+			idx[i] = i
+		}
+		return idx, nil
+	}
+	idx := make([]int, len(f.Columns))
+	for i, c := range f.Columns {
+		idx[i] = -1
+		for j, fd := range schema {
+			if fd.Name == c {
+				idx[i] = j
+				break
+			}
+		}
+		if idx[i] < 0 {
+			return nil, fmt.Errorf("column %q is missing", c)
+		}
+	}
+	return idx, nil
+}
+
+// custom applies the Value function, if any.
+func (f Format) custom(fd Field, v any) (string, bool) {
+	if f.Value == nil || v == nil {
+		return "", false
+	}
+	return f.Value(fd, v)
+}
+
+// time formats a Timestamp or Date.
+func (f Format) time(fd Field, t time.Time) string {
+	if fd.Type == Date {
+		if f.DateFormat == "" {
+			return t.Format("2006-01-02")
+		}
+		return t.Format(f.DateFormat)
+	}
+	if f.TimeFormat == "" {
+		return t.Format(time.RFC3339Nano)
+	}
+	return t.Format(f.TimeFormat)
+}
+
+// text formats a value as CSV field.
+func (f Format) text(fd Field, v any) string {
+	if s, ok := f.custom(fd, v); ok {
+		return s
+	}
+	switch v := v.(type) {
+	case nil:
+		return f.Null
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case time.Time:
+		return f.time(fd, v)
+	}
+	b, _ := f.json(fd, v)
+	return string(b)
+}
+
+// json encodes a value as JSON. Temporal elements of lists are formatted as
+// Timestamps.
+func (f Format) json(fd Field, v any) ([]byte, error) {
+	if s, ok := f.custom(fd, v); ok {
+		return json.Marshal(s)
+	}
+	switch v := v.(type) {
+	case time.Time:
+		return json.Marshal(f.time(fd, v))
+	case []any:
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			b, err := f.json(Field{Name: fd.Name, Type: Timestamp}, e)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(b)
+		}
+		buf.WriteByte(']')
+		return buf.Bytes(), nil
+	}
+	return json.Marshal(v)
+}
+
+// object encodes the row j of the Batch as JSON object, whose keys are in the
+// order of the columns.
+func (f Format) object(b Batch, cols []int, j int) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	n := 0
+	for _, i := range cols {
+		v := b.Columns[i][j]
+		if v == nil && f.OmitNull {
+			continue
+		}
+		if n++; n > 1 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(b.Schema[i].Name)
+		val, err := f.json(b.Schema[i], v)
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %w", b.Schema[i].Name, err)
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// CSVWriter writes Batches as CSV with a header row.
+type CSVWriter struct {
+	w      *csv.Writer
+	f      Format
+	header bool
+}
+
+// NewCSVWriter creates a new CSVWriter, which writes to w. The delimiter can
+// be changed via Writer.
+func NewCSVWriter(w io.Writer, f Format) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w), f: f}
+}
+
+// Writer returns the underlying csv.Writer e.g., to set its Comma.
+func (cw *CSVWriter) Writer() *csv.Writer {
+	return cw.w
+}
+
+// WriteBatch writes the rows of the Batch, preceded by the header row, if it
+// is the first Batch.
+func (cw *CSVWriter) WriteBatch(b Batch) error {
+	cols, err := cw.f.columns(b.Schema)
+	if err != nil {
+		return err
+	}
+	row := make([]string, len(cols))
+	if !cw.header {
+		for k, i := range cols {
+			row[k] = b.Schema[i].Name
+		}
+		if err = cw.w.Write(row); err != nil {
+			return err
+		}
+		cw.header = true
+	}
+	for j := 0; j < b.Len(); j++ {
+		for k, i := range cols {
+			row[k] = cw.f.text(b.Schema[i], b.Columns[i][j])
+		}
+		if err = cw.w.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// JSONLinesWriter writes each row as JSON object on a separate line.
+type JSONLinesWriter struct {
+	w io.Writer
+	f Format
+}
+
+// NewJSONLinesWriter creates a new JSONLinesWriter, which writes to w.
+func NewJSONLinesWriter(w io.Writer, f Format) *JSONLinesWriter {
+	return &JSONLinesWriter{w: w, f: f}
+}
+
+// WriteBatch writes the rows of the Batch.
+func (jw *JSONLinesWriter) WriteBatch(b Batch) error {
+	cols, err := jw.f.columns(b.Schema)
+	if err != nil {
+		return err
+	}
+	for j := 0; j < b.Len(); j++ {
+		obj, err := jw.f.object(b, cols, j)
+		if err != nil {
+			return err
+		}
+		if _, err = jw.w.Write(append(obj, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JSONWriter writes all rows as indented JSON array of objects. Close must be
+// called after the export to terminate the array.
+type JSONWriter struct {
+	w      io.Writer
+	f      Format
+	indent string
+	n      int
+}
+
+// NewJSONWriter creates a new JSONWriter, which writes to w and indents the
+// objects with the given indent e.g., two spaces.
+func NewJSONWriter(w io.Writer, f Format, indent string) *JSONWriter {
+	return &JSONWriter{w: w, f: f, indent: indent}
+}
+
+// WriteBatch writes the rows of the Batch as elements of the array.
+func (jw *JSONWriter) WriteBatch(b Batch) error {
+	cols, err := jw.f.columns(b.Schema)
+	if err != nil {
+		return err
+	}
+	for j := 0; j < b.Len(); j++ {
+		obj, err := jw.f.object(b, cols, j)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if jw.n == 0 {
+			buf.WriteString("[\n")
+		} else {
+			buf.WriteString(",\n")
+		}
+		buf.WriteString(jw.indent)
+		if err = json.Indent(&buf, obj, jw.indent, jw.indent); err != nil {
+			return err
+		}
+		if _, err = jw.w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		jw.n++
+	}
+	return nil
+}
+
+// Close terminates the array. If no rows were written, an empty array is
+// written. It does not close the underlying io.Writer.
+func (jw *JSONWriter) Close() error {
+	s := "\n]\n"
+	if jw.n == 0 {
+		s = "[]\n"
+	}
+	_, err := io.WriteString(jw.w, s)
+	return err
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Filter is a predicate on the properties of a node or relationship, which
+// compiles to a WHERE condition. Values are never embedded in the condition,
+// but passed as parameters, and property keys are quoted. Hence, filters can
+// be built from user input e.g., the query string of a REST endpoint, without
+// the risk of Cypher injection.
+//
+//	r.FindAll(graph.And(graph.Eq("country", "AT"), graph.Or(graph.Gt("age", 17), graph.IsNull("age"))))
+type Filter interface {
+	// Cypher returns the condition on the given variable. Each value is bound
+	// by calling param, which returns its placeholder e.g., $p0.
+	Cypher(variable string, param func(value any) string) string
+}
+
+// FilterFunc adapts a function to a Filter e.g., for conditions, which are
+// not covered by the predefined filters.
+type FilterFunc func(variable string, param func(value any) string) string
+
+// Cypher calls f.
+func (f FilterFunc) Cypher(variable string, param func(value any) string) string {
+	return f(variable, param)
+}
+
+// compare returns a Filter comparing a property with a value.
+func compare(key, op string, value any) Filter {
+	return FilterFunc(func(v string, param func(any) string) string {
+		return v + "." + Quote(key) + " " + op + " " + param(value)
+	})
+}
+
+// Eq returns a Filter, which is true if the property equals the value. If the
+// value is nil, it is true if the property is missing, like IsNull.
+func Eq(key string, value any) Filter {
+	if value == nil {
+		return IsNull(key)
+	}
+	return compare(key, "=", value)
+}
+
+// Ne returns a Filter, which is true if the property differs from the value.
+// If the value is nil, it is true if the property is present.
+func Ne(key string, value any) Filter {
+	if value == nil {
+		return Not(IsNull(key))
+	}
+	return compare(key, "<>", value)
+}
+
+// Gt returns a Filter, which is true if the property is greater than the value.
+func Gt(key string, value any) Filter {
+	return compare(key, ">", value)
+}
+
+// Ge returns a Filter, which is true if the property is greater than or equal
+// to the value.
+func Ge(key string, value any) Filter {
+	return compare(key, ">=", value)
+}
+
+// Lt returns a Filter, which is true if the property is less than the value.
+func Lt(key string, value any) Filter {
+	return compare(key, "<", value)
+}
+
+// Le returns a Filter, which is true if the property is less than or equal to
+// the value.
+func Le(key string, value any) Filter {
+	return compare(key, "<=", value)
+}
+
+// In returns a Filter, which is true if the property equals one of the values
+// of the list e.g., a slice.
+func In(key string, list any) Filter {
+	return compare(key, "IN", list)
+}
+
+// Contains returns a Filter, which is true if the string property contains
+// the substring.
+func Contains(key, substr string) Filter {
+	return compare(key, "CONTAINS", substr)
+}
+
+// StartsWith returns a Filter, which is true if the string property starts
+// with the prefix.
+func StartsWith(key, prefix string) Filter {
+	return compare(key, "STARTS WITH", prefix)
+}
+
+// EndsWith returns a Filter, which is true if the string property ends with
+// the suffix.
+func EndsWith(key, suffix string) Filter {
+	return compare(key, "ENDS WITH", suffix)
+}
+
+// IsNull returns a Filter, which is true if the property is missing.
+func IsNull(key string) Filter {
+	return FilterFunc(func(v string, _ func(any) string) string {
+		return v + "." + Quote(key) + " IS NULL"
+	})
+}
+
+// And returns a Filter, which is true if all filters are true. Without
+// filters, it is always true.
+func And(fs ...Filter) Filter {
+	return junction(" AND ", "true", fs)
+}
+
+// Or returns a Filter, which is true if any filter is true. Without filters,
+// it is always false.
+func Or(fs ...Filter) Filter {
+	return junction(" OR ", "false", fs)
+}
+
+// Not returns a Filter, which negates the given one.
+func Not(f Filter) Filter {
+	return FilterFunc(func(v string, param func(any) string) string {
+		return "NOT (" + f.Cypher(v, param) + ")"
+	})
+}
+
+// junction joins the conditions of the filters, each in parentheses.
+func junction(sep, empty string, fs []Filter) Filter {
+	return FilterFunc(func(v string, param func(any) string) string {
+		if len(fs) == 0 {
+			return empty
+		} else if len(fs) == 1 {
+			return fs[0].Cypher(v, param)
+		}
+		cs := make([]string, len(fs))
+		for i, f := range fs {
+			cs[i] = "(" + f.Cypher(v, param) + ")"
+		}
+		return strings.Join(cs, sep)
+	})
+}
+
+// filterParams returns a param function for Filter.Cypher, which adds the
+// values to params with the given prefix and a sequence number.
+func filterParams(params map[string]any, prefix string) func(any) string {
+	return func(value any) string {
+		k := prefix + strconv.Itoa(len(params))
+		params[k] = value
+		return "$" + k
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Find returns all nodes with the label of the Template, whose properties
+// equal the non-zero fields of the filter struct i.e., query by example.
+// The property keys are derived from the filter like from an entity, so the
+// filter may be of type T or any other struct. Fields having their zero value
+// are not part of the condition; hence, a zero filter matches all nodes within
+// the scope of the Template. The id field matches the internal ID, whereas
+// relationship fields are ignored. Deterministically encrypted fields match
+// the encrypted properties, whereas other encrypted fields cannot be part of
+// the condition. Soft-deleted nodes are excluded, unless the Template
+// includes them.
+func (t Template[T]) Find(filter any) ([]T, error) {
+	v := reflect.ValueOf(filter)
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, errors.New("filter must be a struct")
+	}
+
+	params := make(map[string]any)
+	var conds []string
+	for _, f := range fields(v.Type()) {
+		fv := v.FieldByIndex(f.index)
+		if f.remainder || f.rel != nil || fv.IsZero() {
+			continue
+		}
+		p := "f" + strconv.Itoa(len(conds))
+		params[p] = fv.Interface()
+		if f.encrypt == "deterministic" {
+			params[p] = sealed{prop: f.name, val: propValue(fv), deterministic: true}
+		} else if f.encrypt != "" {
+			return nil, errors.New("cannot find by randomly encrypted property " + f.name)
+		}
+		if f.id {
+			conds = append(conds, "id(n) = $"+p)
+		} else {
+			conds = append(conds, "n."+Quote(f.name)+" = $"+p)
+		}
+	}
+
+	cyp := "MATCH (n:" + labelExpr(t.labels) + ")" + t.live(conds...) + " RETURN n"
+	params = t.scoped(params)
+
+	var list []T
+	fs := fields(reflect.TypeOf(list).Elem())
+	_, err := t.execute(Request{Query: cyp, Params: params}, func(res neo4j.Result) error {
+		list = list[:0]
+		for res.Next() {
+			var e T
+			n := res.Record().Values[0].(neo4j.Node)
+			if err := t.dec.decodeEntity(n, reflect.ValueOf(&e).Elem(), fs); err != nil {
+				return err
+			}
+			list = append(list, e)
+		}
+		return nil
+	})
+	return list, err
+}
@@ -0,0 +1,294 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fixtures loads declarative seed data into the graph e.g., for tests
+// and for bootstrapping local development databases. A Fixture declares nodes
+// with labels and properties, and relationships between them, which refer to
+// the nodes by their Ref:
+//
+//	{
+//	  "nodes": [
+//	    {"ref": "alice", "labels": ["Person"], "properties": {"name": "Alice"}},
+//	    {"ref": "matrix", "labels": ["Movie"], "properties": {"title": "The Matrix"}}
+//	  ],
+//	  "relationships": [
+//	    {"from": "alice", "type": "LIKES", "to": "matrix", "properties": {"stars": 5}}
+//	  ]
+//	}
+//
+// The Ref is stored in the property RefKey, so that the nodes can be found
+// deterministically e.g., MATCH (p:Person {fixtureRef: "alice"}), and loading
+// the same Fixture again updates the nodes and relationships instead of
+// duplicating them.
+//
+// JSON is supported out of the box. Other formats can be registered in
+// Unmarshal e.g., YAML:
+//
+//	fixtures.Unmarshal[".yaml"] = yaml.Unmarshal
+package fixtures
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abc-inc/roland/graph"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// RefKey is the property, which holds the Ref of a node.
+const RefKey = "fixtureRef"
+
+// Fixture is a set of nodes and relationships.
+type Fixture struct {
+	Nodes         []Node         `json:"nodes" yaml:"nodes"`
+	Relationships []Relationship `json:"relationships" yaml:"relationships"`
+}
+
+// Node is a node with at least one label. The first label identifies the
+// node together with its Ref. If the Ref is empty, it defaults to the first
+// label and the position among the nodes with that label e.g., "Person#0".
+type Node struct {
+	Ref        string         `json:"ref" yaml:"ref"`
+	Labels     []string       `json:"labels" yaml:"labels"`
+	Properties map[string]any `json:"properties" yaml:"properties"`
+}
+
+// Relationship connects the nodes with the Refs From and To. There is at most
+// one Relationship of a type between two nodes.
+type Relationship struct {
+	From       string         `json:"from" yaml:"from"`
+	Type       string         `json:"type" yaml:"type"`
+	To         string         `json:"to" yaml:"to"`
+	Properties map[string]any `json:"properties" yaml:"properties"`
+}
+
+// Refs maps the Refs of the loaded nodes to their internal IDs.
+type Refs map[string]int64
+
+// Unmarshal holds the functions, which decode the files of LoadFS by their
+// extension. Numbers in JSON files are decoded as integers, if possible.
+var Unmarshal = map[string]func(data []byte, v any) error{
+	".json": unmarshalJSON,
+}
+
+// unmarshalJSON decodes JSON, keeping numbers as json.Number.
+func unmarshalJSON(data []byte, v any) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// LoadFS loads the files of the file system, which match the patterns, in
+// lexical order like Load. Relationships may refer to nodes of other files.
+func LoadFS(ctx context.Context, c *graph.Conn, fsys fs.FS, patterns ...string) (Refs, error) {
+	var files []string
+	for _, p := range patterns {
+		ms, err := fs.Glob(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, ms...)
+	}
+	sort.Strings(files)
+
+	fxs := make([]Fixture, len(files))
+	for i, f := range files {
+		um, ok := Unmarshal[path.Ext(f)]
+		if !ok {
+			return nil, fmt.Errorf("fixture %s: unsupported file type", f)
+		}
+		b, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return nil, err
+		} else if err = um(b, &fxs[i]); err != nil {
+			return nil, fmt.Errorf("fixture %s: %w", f, err)
+		}
+	}
+	return Load(ctx, c, fxs...)
+}
+
+// Load merges the nodes and relationships of the Fixtures into the graph in a
+// single Transaction (see graph.Conn.WithinTx), and returns the internal IDs
+// of the nodes. Nodes declared by several Fixtures with the same first label
+// and Ref are merged. If a Relationship refers to an unknown Ref, nothing is
+// loaded.
+func Load(ctx context.Context, c *graph.Conn, fxs ...Fixture) (Refs, error) {
+	var ns []Node
+	var rs []Relationship
+	for _, fx := range fxs {
+		ns, rs = append(ns, fx.Nodes...), append(rs, fx.Relationships...)
+	}
+	ns, err := assignRefs(ns)
+	if err != nil {
+		return nil, err
+	}
+	if err = resolve(ns, rs); err != nil {
+		return nil, err
+	}
+
+	refs := make(Refs, len(ns))
+	err = c.WithinTx(ctx, func(tx *graph.Conn) error {
+		if err := loadNodes(ctx, tx, ns, refs); err != nil {
+			return err
+		}
+		return loadRels(ctx, tx, rs, refs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// assignRefs returns a copy of the nodes with default Refs.
+func assignRefs(ns []Node) ([]Node, error) {
+	out := make([]Node, len(ns))
+	cnt := make(map[string]int)
+	for i, n := range ns {
+		if len(n.Labels) == 0 {
+			return nil, fmt.Errorf("node %d (%q) has no label", i, n.Ref)
+		}
+		if n.Ref == "" {
+			n.Ref = n.Labels[0] + "#" + strconv.Itoa(cnt[n.Labels[0]])
+		}
+		cnt[n.Labels[0]]++
+		out[i] = n
+	}
+	return out, nil
+}
+
+// resolve verifies that the Refs are unique, and that the Relationships refer
+// to known Refs.
+func resolve(ns []Node, rs []Relationship) error {
+	labels := make(map[string]string, len(ns))
+	for _, n := range ns {
+		if l, ok := labels[n.Ref]; ok && l != n.Labels[0] {
+			return fmt.Errorf("ref %q is used by nodes labeled %s and %s", n.Ref, l, n.Labels[0])
+		}
+		labels[n.Ref] = n.Labels[0]
+	}
+	for _, r := range rs {
+		for _, ref := range []string{r.From, r.To} {
+			if _, ok := labels[ref]; !ok {
+				return fmt.Errorf("relationship %s refers to unknown ref %q", r.Type, ref)
+			}
+		}
+	}
+	return nil
+}
+
+// loadNodes merges the nodes, grouped by labels, and records their IDs.
+func loadNodes(ctx context.Context, c *graph.Conn, ns []Node, refs Refs) error {
+	groups := make(map[string][]any)
+	var keys []string
+	for _, n := range ns {
+		k := strings.Join(n.Labels, "\x00")
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], map[string]any{"ref": n.Ref, "props": normalize(n.Properties)})
+	}
+
+	for _, k := range keys {
+		ls := strings.Split(k, "\x00")
+		cyp := fmt.Sprintf("UNWIND $rows AS row MERGE (n:%s {%s: row.ref}) SET n += row.props",
+			graph.Quote(ls[0]), graph.Quote(RefKey))
+		for _, l := range ls[1:] {
+			cyp += " SET n:" + graph.Quote(l)
+		}
+		cyp += " RETURN row.ref, id(n)"
+
+		r := graph.Request{Query: cyp, Params: map[string]any{"rows": groups[k]}, Write: true}
+		ids, _, err := graph.NewTemplate[graph.Pair[string, int64]](c).
+			QueryContext(ctx, r, graph.NewPairMapper[string, int64]())
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			refs[id.Key] = id.Value
+		}
+	}
+	return nil
+}
+
+// loadRels merges the Relationships, grouped by type.
+func loadRels(ctx context.Context, c *graph.Conn, rs []Relationship, refs Refs) error {
+	groups := make(map[string][]any)
+	var types []string
+	for _, r := range rs {
+		if _, ok := groups[r.Type]; !ok {
+			types = append(types, r.Type)
+		}
+		groups[r.Type] = append(groups[r.Type], map[string]any{
+			"from": refs[r.From], "to": refs[r.To], "props": normalize(r.Properties)})
+	}
+
+	for _, t := range types {
+		cyp := "UNWIND $rows AS row MATCH (a) WHERE id(a) = row.from MATCH (b) WHERE id(b) = row.to " +
+			"MERGE (a)-[r:" + graph.Quote(t) + "]->(b) SET r += row.props"
+		r := graph.Request{Query: cyp, Params: map[string]any{"rows": groups[t]}, Write: true}
+		if _, _, err := graph.NewTemplate[any](c).QueryContext(ctx, r, discard); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalize converts json.Number values to integers or floats, and the keys
+// of nested maps to strings, so that the driver accepts them.
+func normalize(props map[string]any) map[string]any {
+	m := make(map[string]any, len(props))
+	for k, v := range props {
+		m[k] = value(v)
+	}
+	return m
+}
+
+// value converts a decoded value like normalize.
+func value(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		return normalize(v)
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = value(e)
+		}
+		return m
+	case []any:
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = value(e)
+		}
+		return l
+	}
+	return v
+}
+
+// discard ignores a Record.
+func discard(*neo4j.Record) any {
+	return nil
+}
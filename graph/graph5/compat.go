@@ -0,0 +1,242 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph5
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/abc-inc/roland/graph"
+	neo4j4 "github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Mapper is used by Template for mapping results on a per-record basis.
+// Like graph.Mapper, it may panic with a graph.MappingError to report a value,
+// which cannot be mapped.
+type Mapper[T any] func(rec *neo4j.Record) T
+
+// NewSingleValueMapper creates a new Mapper that converts a single column into
+// a single result value per record.
+func NewSingleValueMapper[T any](idx int) Mapper[T] {
+	return func(rec *neo4j.Record) T {
+		return rec.Values[idx].(T)
+	}
+}
+
+// NewStructMapper creates a new Mapper that assigns the values of each Record
+// to the fields of a struct, like graph.NewStructMapper.
+func NewStructMapper[T any]() Mapper[T] {
+	return Adapt(graph.NewStructMapper[T]())
+}
+
+// NewNodeMapper creates a new Mapper that converts the Node in the column with
+// the given key, like graph.NewNodeMapper, but keeps its element ID.
+func NewNodeMapper(key string) Mapper[graph.Node] {
+	return newValueMapper(key, "node", NodeOf)
+}
+
+// NewRelationshipMapper is like NewNodeMapper, but converts a Relationship.
+func NewRelationshipMapper(key string) Mapper[graph.Relationship] {
+	return newValueMapper(key, "relationship", RelationshipOf)
+}
+
+// NewPathValueMapper is like NewNodeMapper, but converts a Path.
+func NewPathValueMapper(key string) Mapper[graph.Path] {
+	return newValueMapper(key, "path", PathOf)
+}
+
+// newValueMapper creates a new Mapper that converts the driver value of type
+// S in the column with the given key to T.
+func newValueMapper[S, T any](key, kind string, conv func(S) T) Mapper[T] {
+	return func(rec *neo4j.Record) T {
+		v, ok := rec.Get(key)
+		if !ok {
+			panic(&graph.MappingError{Key: key, Err: fmt.Errorf("column %q is missing", key)})
+		}
+		s, ok := v.(S)
+		if !ok {
+			panic(&graph.MappingError{Key: key, Err: fmt.Errorf("expected a %s, got %T", kind, v)})
+		}
+		return conv(s)
+	}
+}
+
+// NodeOf converts a node of driver v5 to a graph.Node including its element
+// ID.
+func NodeOf(n neo4j.Node) graph.Node {
+	gn := graph.NodeOf(node(n))
+	gn.ElementID = n.ElementId
+	return gn
+}
+
+// RelationshipOf converts a relationship of driver v5 to a graph.Relationship
+// including its element IDs.
+func RelationshipOf(r neo4j.Relationship) graph.Relationship {
+	gr := graph.RelationshipOf(rel(r))
+	gr.ElementID, gr.StartElementID, gr.EndElementID = r.ElementId, r.StartElementId, r.EndElementId
+	return gr
+}
+
+// PathOf converts a path of driver v5 to a graph.Path including the element
+// IDs of its Nodes and Relationships.
+func PathOf(p neo4j.Path) graph.Path {
+	gp := graph.Path{Nodes: make([]graph.Node, len(p.Nodes)), Relationships: make([]graph.Relationship, len(p.Relationships))}
+	for i, n := range p.Nodes {
+		gp.Nodes[i] = NodeOf(n)
+	}
+	for i, r := range p.Relationships {
+		gp.Relationships[i] = RelationshipOf(r)
+	}
+	return gp
+}
+
+// Adapt converts a Mapper for Records of driver v4 into a Mapper for Records
+// of driver v5. Each Record is converted with Record before it is mapped.
+func Adapt[T any](m graph.Mapper[T]) Mapper[T] {
+	return func(rec *neo4j.Record) T {
+		return m(Record(rec))
+	}
+}
+
+// Record converts a Record of driver v5 into a Record of driver v4.
+// Nodes, Relationships and Paths are identified by their legacy numeric IDs,
+// since v4 has no element IDs. Use NodeOf, RelationshipOf and PathOf or the
+// corresponding Mappers to keep the element IDs. Temporal and spatial values
+// are converted to their v4 counterparts.
+func Record(rec *neo4j.Record) *neo4j4.Record {
+	vals := make([]any, len(rec.Values))
+	for i, v := range rec.Values {
+		vals[i] = Value(v)
+	}
+	return &neo4j4.Record{Keys: rec.Keys, Values: vals}
+}
+
+// Value converts a value of driver v5 into the corresponding value of driver
+// v4. Lists and maps are converted recursively. Other values are returned as
+// they are.
+func Value(v any) any {
+	switch v := v.(type) {
+	case neo4j.Node:
+		return node(v)
+	case neo4j.Relationship:
+		return rel(v)
+	case neo4j.Path:
+		p := neo4j4.Path{Nodes: make([]neo4j4.Node, len(v.Nodes)),
+			Relationships: make([]neo4j4.Relationship, len(v.Relationships))}
+		for i, n := range v.Nodes {
+			p.Nodes[i] = node(n)
+		}
+		for i, r := range v.Relationships {
+			p.Relationships[i] = rel(r)
+		}
+		return p
+	case neo4j.Date:
+		return neo4j4.Date(v)
+	case neo4j.LocalTime:
+		return neo4j4.LocalTime(v)
+	case neo4j.LocalDateTime:
+		return neo4j4.LocalDateTime(v)
+	case neo4j.Time:
+		return neo4j4.OffsetTime(v)
+	case neo4j.Duration:
+		return neo4j4.Duration(v)
+	case neo4j.Point2D:
+		return neo4j4.Point2D(v)
+	case neo4j.Point3D:
+		return neo4j4.Point3D(v)
+	case []any:
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = Value(e)
+		}
+		return l
+	case map[string]any:
+		return props(v)
+	}
+	return v
+}
+
+// node converts a Node of driver v5 into a Node of driver v4.
+func node(n neo4j.Node) neo4j4.Node {
+	return neo4j4.Node{Id: n.Id, Labels: n.Labels, Props: props(n.Props)}
+}
+
+// rel converts a Relationship of driver v5 into a Relationship of driver v4.
+func rel(r neo4j.Relationship) neo4j4.Relationship {
+	return neo4j4.Relationship{Id: r.Id, StartId: r.StartId, EndId: r.EndId,
+		Type: r.Type, Props: props(r.Props)}
+}
+
+// props converts all values of the map.
+func props(m map[string]any) map[string]any {
+	c := make(map[string]any, len(m))
+	for k, v := range m {
+		c[k] = Value(v)
+	}
+	return c
+}
+
+// driverError wraps an error of driver v5, so that graph.QueryError can
+// inspect it like an error of driver v4 e.g., to obtain its Code.
+type driverError struct {
+	err  error
+	nerr *neo4j4.Neo4jError
+	terr *neo4j4.TokenExpiredError
+}
+
+// wrapErr wraps err in a graph.QueryError unless it is nil. Like for driver v4,
+// errors reported by the server are classified e.g., as
+// graph.ConstraintViolationError.
+func wrapErr(query string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var nerr *neo4j.Neo4jError
+	var terr *neo4j.TokenExpiredError
+	if errors.As(err, &terr) {
+		err = &driverError{err: err, terr: &neo4j4.TokenExpiredError{Code: terr.Code, Message: terr.Message}}
+	} else if errors.As(err, &nerr) {
+		err = &driverError{err: err, nerr: &neo4j4.Neo4jError{Code: nerr.Code, Msg: nerr.Msg}}
+	}
+	return &graph.QueryError{Query: query, Err: graph.ClassifyError(err)}
+}
+
+// Error returns the message of the underlying error.
+func (e *driverError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *driverError) Unwrap() error {
+	return e.err
+}
+
+// As assigns the corresponding error of driver v4 to target, if it is one.
+func (e *driverError) As(target any) bool {
+	switch t := target.(type) {
+	case **neo4j4.Neo4jError:
+		if e.nerr != nil {
+			*t = e.nerr
+			return true
+		}
+	case **neo4j4.TokenExpiredError:
+		if e.terr != nil {
+			*t = e.terr
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graph5 provides Conn and Template on top of neo4j-go-driver v5.
+// It mirrors the API of package graph, but all operations accept a context,
+// which is passed to the driver. Mappers written for package graph can be
+// used with Adapt, so that code can be migrated incrementally: first switch
+// the Conn, then rewrite the Mappers one by one.
+package graph5
+
+import (
+	"context"
+
+	"github.com/abc-inc/roland/graph"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/config"
+)
+
+// Conn holds the Driver and the configuration for accessing a database.
+type Conn struct {
+	Driver neo4j.DriverWithContext
+	// DBName is the name of the database. If it is empty, the default
+	// database of the server is used.
+	DBName string
+	// Params are added to every query, unless the query provides a parameter
+	// with the same name.
+	Params map[string]any
+	// Logger receives log messages. If it is nil, nothing is logged.
+	Logger graph.Logger
+}
+
+// NewConn creates a new Driver and verifies the connectivity to the server.
+func NewConn(ctx context.Context, addr string, auth neo4j.AuthToken, dbName string,
+	opts ...func(config *config.Config)) (*Conn, error) {
+
+	d, err := neo4j.NewDriverWithContext(addr, auth, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.VerifyConnectivity(ctx); err != nil {
+		_ = d.Close(ctx)
+		return nil, wrapErr("", err)
+	}
+	return &Conn{Driver: d, DBName: dbName, Params: make(map[string]any)}, nil
+}
+
+// Close closes the Driver and all of its connections.
+func (c *Conn) Close(ctx context.Context) error {
+	return c.Driver.Close(ctx)
+}
+
+// Session creates a new Session with the given access mode.
+// The caller is responsible for closing it.
+func (c *Conn) Session(ctx context.Context, mode neo4j.AccessMode) neo4j.SessionWithContext {
+	return c.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: mode, DatabaseName: c.DBName})
+}
+
+// params merges the given parameters with the Params of the Conn.
+func (c *Conn) params(params map[string]any) map[string]any {
+	if len(c.Params) == 0 {
+		return params
+	}
+	m := make(map[string]any, len(params)+len(c.Params))
+	for k, v := range c.Params {
+		m[k] = v
+	}
+	for k, v := range params {
+		m[k] = v
+	}
+	return m
+}
+
+// logQuery logs the name, the transaction metadata and the query of the
+// Request at debug level.
+func (c *Conn) logQuery(r graph.Request) {
+	if c.Logger != nil {
+		c.Logger.Debugf("query %s %v: %s", r.QueryName(), r.Metadata, graph.Redact(r.Query))
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph5
+
+import (
+	"context"
+
+	"github.com/abc-inc/roland/graph"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Template executes queries via ExecuteQuery of the driver, which manages
+// sessions, transactions and retries. It accepts the same Requests as the
+// Template of package graph.
+// Errors reported by the driver are wrapped in a graph.QueryError.
+type Template[T any] struct {
+	conn *Conn
+	mode neo4j.AccessMode
+}
+
+// NewTemplate creates a new Template with the given connection.
+// By default, queries are routed to writers.
+func NewTemplate[T any](conn *Conn) *Template[T] {
+	return &Template[T]{conn: conn, mode: neo4j.AccessModeWrite}
+}
+
+// WithAccessMode returns a copy of the Template, which routes queries
+// according to the given access mode. Individual Requests can still force
+// write mode.
+func (t Template[T]) WithAccessMode(mode neo4j.AccessMode) *Template[T] {
+	t.mode = mode
+	return &t
+}
+
+// Query executes the Request and maps each Record to a value via a Mapper.
+// The Records are fetched eagerly, before they are mapped.
+func (t Template[T]) Query(ctx context.Context, r graph.Request, m Mapper[T]) (
+	list []T, summary neo4j.ResultSummary, err error) {
+
+	res, err := t.execute(ctx, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer recoverMapping(&err)
+	list = make([]T, 0, len(res.Records))
+	for _, rec := range res.Records {
+		list = append(list, m(rec))
+	}
+	return list, res.Summary, nil
+}
+
+// QuerySingle is like Query, but maps exactly one result record to a value
+// via a Mapper. If the query returns no record, graph.ErrEmpty is returned.
+// If it returns more than one record, graph.ErrMultiple is returned.
+func (t Template[T]) QuerySingle(ctx context.Context,
+	cyp string, params map[string]any, m Mapper[T]) (val T, err error) {
+
+	res, err := t.execute(ctx, graph.Request{Query: cyp, Params: params})
+	if err != nil {
+		return val, err
+	} else if len(res.Records) == 0 {
+		return val, graph.ErrEmpty
+	} else if len(res.Records) > 1 {
+		return val, graph.ErrMultiple
+	}
+
+	defer recoverMapping(&err)
+	return m(res.Records[0]), nil
+}
+
+// execute runs the Request in a managed Transaction.
+func (t Template[T]) execute(ctx context.Context, r graph.Request) (*neo4j.EagerResult, error) {
+	opts := []neo4j.ExecuteQueryConfigurationOption{
+		neo4j.ExecuteQueryWithDatabase(t.conn.DBName),
+		neo4j.ExecuteQueryWithTransactionConfig(txConfig(r.WithContext(ctx))...),
+	}
+	if t.mode == neo4j.AccessModeRead && !r.Write {
+		opts = append(opts, neo4j.ExecuteQueryWithReadersRouting())
+	}
+
+	t.conn.logQuery(r)
+	params, err := graph.EncryptParams(t.conn.params(r.Params))
+	if err != nil {
+		return nil, err
+	}
+	res, err := neo4j.ExecuteQuery(ctx, t.conn.Driver, r.Query, params,
+		neo4j.EagerResultTransformer, opts...)
+	return res, wrapErr(r.Query, err)
+}
+
+// txConfig returns the configuration of Transactions created for the Request.
+func txConfig(r graph.Request) (cfg []func(*neo4j.TransactionConfig)) {
+	if len(r.Metadata) > 0 {
+		cfg = append(cfg, neo4j.WithTxMetadata(r.Metadata))
+	}
+	if r.Timeout > 0 {
+		cfg = append(cfg, neo4j.WithTxTimeout(r.Timeout))
+	}
+	return cfg
+}
+
+// recoverMapping recovers from a MappingError raised by a Mapper and assigns
+// it to err. Other panics are propagated.
+func recoverMapping(err *error) {
+	if p := recover(); p != nil {
+		merr, ok := p.(*graph.MappingError)
+		if !ok {
+			panic(p)
+		}
+		*err = merr
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graphhttp provides HTTP middleware, which executes each request in
+// a Transaction of its own.
+//
+// The Middleware works with all routers accepting net/http middleware, and
+// with echo via echo.WrapMiddleware. For other frameworks, such as gin, Begin
+// and Unit implement the same behavior:
+//
+//	func Tx(conn *graph.Conn) gin.HandlerFunc {
+//		return func(c *gin.Context) {
+//			ctx, u, err := graphhttp.Begin(c.Request.Context(), conn, graphhttp.AccessMode(c.Request))
+//			if err != nil {
+//				_ = c.AbortWithError(http.StatusServiceUnavailable, err)
+//				return
+//			}
+//			defer u.Recover()
+//			c.Request = c.Request.WithContext(ctx)
+//			c.Next()
+//			_ = u.End(c.Writer.Status(), c.Errors.Last())
+//		}
+//	}
+package graphhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/abc-inc/roland/graph"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// connKey is the context key of the Conn of a request.
+type connKey struct{}
+
+// Conn returns the Conn stored in the context by Middleware or Begin, or nil
+// if there is none. Templates using it execute their queries in the
+// Transaction of the request.
+func Conn(ctx context.Context) *graph.Conn {
+	c, _ := ctx.Value(connKey{}).(*graph.Conn)
+	return c
+}
+
+// AccessMode returns the access mode for the request: read for safe methods
+// i.e., GET, HEAD and OPTIONS, and write otherwise.
+func AccessMode(r *http.Request) neo4j.AccessMode {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return neo4j.AccessModeRead
+	}
+	return neo4j.AccessModeWrite
+}
+
+// Unit is the Transaction of a request.
+type Unit struct {
+	conn *graph.Conn
+	done bool
+}
+
+// Begin begins a Transaction with the given access mode in a clone of the
+// Conn and returns a context holding the clone. The Transaction carries the
+// graph.TxMetadata of the context e.g., the request ID.
+func Begin(ctx context.Context, c *graph.Conn, mode neo4j.AccessMode) (context.Context, *Unit, error) {
+	conn := c.Clone()
+	if _, _, err := conn.GetTransactionContext(ctx, mode); err != nil {
+		return ctx, nil, err
+	}
+	return context.WithValue(ctx, connKey{}, conn), &Unit{conn: conn}, nil
+}
+
+// End commits the Transaction, if the status is 2xx and err is nil, and rolls
+// it back otherwise. Subsequent calls do nothing.
+func (u *Unit) End(status int, err error) error {
+	if u.done {
+		return nil
+	}
+	u.done = true
+	if err != nil || status < 200 || status > 299 {
+		_, rerr := u.conn.Rollback()
+		return rerr
+	}
+	_, err = u.conn.Commit()
+	return err
+}
+
+// Recover rolls back the Transaction and re-panics, if the calling goroutine
+// panics. It must be deferred.
+func (u *Unit) Recover() {
+	if p := recover(); p != nil {
+		_ = u.End(http.StatusInternalServerError, errors.New("panic"))
+		panic(p)
+	}
+}
+
+// Option configures the Middleware.
+type Option func(*options)
+
+type options struct {
+	mode    func(*http.Request) neo4j.AccessMode
+	onError func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// WithAccessMode sets the function, which decides the access mode of each
+// request. It defaults to AccessMode.
+func WithAccessMode(fn func(*http.Request) neo4j.AccessMode) Option {
+	return func(o *options) {
+		o.mode = fn
+	}
+}
+
+// WithErrorHandler sets the function, which responds to requests, whose
+// Transaction cannot be begun or committed. By default, the status 503 and
+// 500 is written, respectively.
+func WithErrorHandler(fn func(w http.ResponseWriter, r *http.Request, err error)) Option {
+	return func(o *options) {
+		o.onError = fn
+	}
+}
+
+// fail responds to a request, whose Transaction failed, using the error
+// handler or the given status.
+func (o options) fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if o.onError != nil {
+		o.onError(w, r, err)
+		return
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// Middleware returns net/http middleware, which begins a Transaction for each
+// request and stores the Conn in the request context (see Conn). The value of
+// the header X-Request-Id, if any, is attached to the Transaction as metadata
+// under graph.MetaRequestID.
+//
+// The Transaction is committed just before the handler writes a 2xx status,
+// so that a failed commit can still be reported to the client, instead of
+// a success. It is rolled back, if the handler writes any other status or
+// panics. If the handler does not write a response, it is committed at the
+// end.
+func Middleware(c *graph.Conn, opts ...Option) func(http.Handler) http.Handler {
+	o := options{mode: AccessMode}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if id := r.Header.Get("X-Request-Id"); id != "" {
+				ctx = graph.WithTxMetadata(ctx, map[string]any{graph.MetaRequestID: id})
+			}
+			ctx, u, err := Begin(ctx, c, o.mode(r))
+			if err != nil {
+				o.fail(w, r, http.StatusServiceUnavailable, err)
+				return
+			}
+			defer u.Recover()
+
+			rw := &responseWriter{ResponseWriter: w, u: u, r: r, o: o}
+			next.ServeHTTP(rw, r.WithContext(ctx))
+			if !rw.wrote {
+				rw.WriteHeader(http.StatusOK)
+			}
+		})
+	}
+}
+
+// responseWriter ends the Unit, when the status is written.
+type responseWriter struct {
+	http.ResponseWriter
+	u      *Unit
+	r      *http.Request
+	o      options
+	wrote  bool
+	failed bool
+}
+
+// WriteHeader ends the Unit according to the status, before the status is
+// written. If the commit fails, the error handler responds instead.
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wrote {
+		return
+	}
+	w.wrote = true
+	if err := w.u.End(status, nil); err != nil && status >= 200 && status <= 299 {
+		w.failed = true
+		w.o.fail(w.ResponseWriter, w.r, http.StatusInternalServerError, err)
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes the status 200, if the handler did not write a status yet.
+// After a failed commit, the body of the handler is discarded.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.failed {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Health returns a handler for health checks e.g., /healthz, which responds
+// with 200, if the database of the Conn is available, and 503 otherwise. The
+// check is limited by the context of the request.
+func Health(c *graph.Conn) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := c.Ping(r.Context()); err != nil {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
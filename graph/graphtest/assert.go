@@ -0,0 +1,51 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graphtest provides utilities for testing code, which uses Roland.
+package graphtest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abc-inc/roland/graph"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// AssertCounters reports an error, if the counters of the ResultSummary differ
+// from the expected Counters. All counters are compared i.e., counters, which
+// are not set in want, are expected to be zero.
+func AssertCounters(t testing.TB, summary neo4j.ResultSummary, want graph.Counters) {
+	t.Helper()
+	var got graph.Counters
+	got.Add(summary)
+	if diff := diffCounters(got, want); diff != "" {
+		t.Errorf("unexpected counters:\n%s", diff)
+	}
+}
+
+// diffCounters returns one line per counter, which differs.
+func diffCounters(got, want graph.Counters) string {
+	sb := strings.Builder{}
+	g, w := reflect.ValueOf(got), reflect.ValueOf(want)
+	for i := 0; i < g.NumField(); i++ {
+		if g.Field(i).Int() != w.Field(i).Int() {
+			_, _ = fmt.Fprintf(&sb, "  %s: got %d, want %d\n",
+				g.Type().Field(i).Name, g.Field(i).Int(), w.Field(i).Int())
+		}
+	}
+	return sb.String()
+}
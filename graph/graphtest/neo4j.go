@@ -0,0 +1,275 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abc-inc/roland/graph"
+	"github.com/abc-inc/roland/graph/fixtures"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Environment variables, which point StartNeo4j to an existing database
+// instead of starting a container. The user and password default to "neo4j".
+const (
+	EnvURI      = "NEO4J_TEST_URI"
+	EnvUser     = "NEO4J_TEST_USER"
+	EnvPassword = "NEO4J_TEST_PASSWORD"
+)
+
+// Image is the Docker image started by StartNeo4j.
+var Image = "neo4j:4.4"
+
+// StartTimeout is the maximum time to wait for the container to accept
+// connections.
+var StartTimeout = 2 * time.Minute
+
+// password is the password of the user "neo4j" in the container.
+const password = "graphtest"
+
+// container holds the address of the container shared by all tests of the
+// test binary.
+var container struct {
+	once sync.Once
+	id   string
+	uri  string
+	err  error
+}
+
+// separator matches the semicolon at the end of a line, which terminates a
+// statement in a Cypher fixture.
+var separator = regexp.MustCompile(`;[ \t]*(\r?\n|$)`)
+
+// StartNeo4j returns a Conn to an empty Neo4j database for integration tests
+// and closes it when the test finishes.
+//
+// If NEO4J_TEST_URI is set, it connects to that database. Otherwise, a
+// container is started from Image using the docker command, which is shared
+// by all tests of the test binary, and removed by Main. The test is skipped,
+// if docker is not available. In either case, all nodes and relationships are
+// deleted before the Conn is returned, so tests must not run in parallel.
+func StartNeo4j(t testing.TB) *graph.Conn {
+	t.Helper()
+	uri, user, pass := os.Getenv(EnvURI), envOr(EnvUser, "neo4j"), envOr(EnvPassword, "neo4j")
+	if uri == "" {
+		if _, err := exec.LookPath("docker"); err != nil {
+			t.Skip("docker is not available and " + EnvURI + " is not set")
+		}
+		container.once.Do(func() {
+			container.id, container.uri, container.err = startContainer()
+		})
+		if container.err != nil {
+			t.Fatalf("cannot start Neo4j container: %v", container.err)
+		}
+		uri, user, pass = container.uri, "neo4j", password
+	}
+
+	c, err := connect(uri, user, pass)
+	if err != nil {
+		t.Fatalf("cannot connect to %s: %v", uri, err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	Truncate(t, c)
+	return c
+}
+
+// Main runs the tests and removes the container started by StartNeo4j, if
+// any. It is meant to be called from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		graphtest.Main(m)
+//	}
+func Main(m *testing.M) {
+	code := m.Run()
+	if container.id != "" {
+		_ = exec.Command("docker", "rm", "-f", container.id).Run()
+	}
+	os.Exit(code)
+}
+
+// startContainer starts a Neo4j container, whose Bolt port is published on a
+// random port of the loopback interface, and returns its ID and URI.
+func startContainer() (id, uri string, err error) {
+	out, err := docker("run", "-d", "--rm", "-p", "127.0.0.1::7687",
+		"-e", "NEO4J_AUTH=neo4j/"+password, Image)
+	if err != nil {
+		return "", "", err
+	}
+	id = out
+	addr, err := docker("port", id, "7687/tcp")
+	if err != nil {
+		_, _ = docker("rm", "-f", id)
+		return "", "", err
+	}
+	addr, _, _ = strings.Cut(addr, "\n")
+	return id, "bolt://" + addr, nil
+}
+
+// docker runs the docker command and returns its trimmed output.
+func docker(args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("docker %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// connect creates a Conn, retrying until the database accepts connections or
+// StartTimeout elapses.
+func connect(uri, user, pass string) (c *graph.Conn, err error) {
+	deadline := time.Now().Add(StartTimeout)
+	for {
+		if c, err = graph.NewConn(uri, user, neo4j.BasicAuth(user, pass, ""), ""); err == nil {
+			return c, nil
+		} else if c != nil {
+			_ = c.Close()
+		}
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// envOr returns the value of the environment variable or the default value,
+// if it is not set.
+func envOr(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+// Truncate deletes all nodes and relationships of the database. Indexes and
+// constraints are kept.
+func Truncate(t testing.TB, c *graph.Conn) {
+	t.Helper()
+	run(t, c, "MATCH (n) DETACH DELETE n", nil)
+}
+
+// LoadFixtures loads the files of the file system, which match the patterns,
+// in lexical order. Files with the extension .cypher contain statements, each
+// terminated by a semicolon at the end of a line. Files with the extension
+// .csv contain nodes, whose label is the base name of the file e.g.,
+// Person.csv, and whose property keys are given by the header. Values are
+// stored as integers, floats or booleans if possible, and as strings
+// otherwise; empty values are omitted. Files with an extension registered in
+// fixtures.Unmarshal e.g., .json, are loaded by fixtures.LoadFS; relationships
+// must refer to nodes of the same file.
+func LoadFixtures(t testing.TB, c *graph.Conn, fsys fs.FS, patterns ...string) {
+	t.Helper()
+	var files []string
+	for _, p := range patterns {
+		ms, err := fs.Glob(fsys, p)
+		if err != nil {
+			t.Fatalf("invalid pattern %q: %v", p, err)
+		}
+		files = append(files, ms...)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no fixtures match %v", patterns)
+	}
+
+	for _, f := range files {
+		b, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			t.Fatalf("cannot read fixture: %v", err)
+		}
+		switch path.Ext(f) {
+		case ".cypher":
+			for _, stmt := range separator.Split(string(b), -1) {
+				if stmt = strings.TrimSpace(stmt); stmt != "" {
+					run(t, c, stmt, nil)
+				}
+			}
+		case ".csv":
+			rows, err := parseCSV(b)
+			if err != nil {
+				t.Fatalf("fixture %s: %v", f, err)
+			}
+			label := strings.TrimSuffix(path.Base(f), ".csv")
+			run(t, c, "UNWIND $rows AS row CREATE (n:"+graph.Quote(label)+") SET n = row",
+				map[string]any{"rows": rows})
+		default:
+			if _, ok := fixtures.Unmarshal[path.Ext(f)]; !ok {
+				t.Fatalf("fixture %s: unsupported file type", f)
+			} else if _, err = fixtures.LoadFS(context.Background(), c, fsys, f); err != nil {
+				t.Fatalf("fixture %s: %v", f, err)
+			}
+		}
+	}
+}
+
+// parseCSV returns a map of properties per row.
+func parseCSV(b []byte) ([]any, error) {
+	recs, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+	if err != nil {
+		return nil, err
+	} else if len(recs) == 0 {
+		return nil, errors.New("missing header")
+	}
+
+	rows := make([]any, len(recs)-1)
+	for i, rec := range recs[1:] {
+		ps := make(map[string]any, len(rec))
+		for j, v := range rec {
+			if v != "" {
+				ps[recs[0][j]] = csvValue(v)
+			}
+		}
+		rows[i] = ps
+	}
+	return rows, nil
+}
+
+// csvValue converts a value to an integer, float or boolean ("true" or
+// "false"), if possible.
+func csvValue(v string) any {
+	if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return i
+	} else if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	} else if v == "true" || v == "false" {
+		return v == "true"
+	}
+	return v
+}
+
+// run executes the write statement and fails the test on error.
+func run(t testing.TB, c *graph.Conn, cyp string, params map[string]any) {
+	t.Helper()
+	r := graph.Request{Query: cyp, Params: params, Write: true}
+	if _, _, err := graph.NewTemplate[any](c).Query(r, func(*neo4j.Record) any { return nil }); err != nil {
+		t.Fatalf("%v: %s", err, cyp)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Instrumentation observes the execution of queries e.g., to record traces
+// and metrics. See package otelgraph for an implementation using
+// OpenTelemetry.
+type Instrumentation interface {
+	// Start is called before the query of the Request is run against the
+	// given database. The context is the one passed to the Template, if any,
+	// so that spans can be linked to their parent. The returned function is
+	// called once the query completed, with the number of Records received,
+	// the ResultSummary (nil on failure) and the error, if any.
+	Start(ctx context.Context, db string, r Request) (finish func(records int, sum neo4j.ResultSummary, err error))
+}
+
+// instrument starts observing the query of the Request.
+func (c *Conn) instrument(ctx context.Context, r Request) func(int, neo4j.ResultSummary, error) {
+	if c.Instrumentation == nil {
+		return func(int, neo4j.ResultSummary, error) {}
+	}
+	return c.Instrumentation.Start(ctx, c.DBName, r)
+}
+
+// countingResult counts the Records received from a Result.
+type countingResult struct {
+	neo4j.Result
+	n int
+}
+
+// Next advances to the next Record and counts it.
+func (r *countingResult) Next() bool {
+	ok := r.Result.Next()
+	if ok {
+		r.n++
+	}
+	return ok
+}
+
+// NextRecord advances to the next Record, assigns it to rec and counts it.
+func (r *countingResult) NextRecord(rec **neo4j.Record) bool {
+	ok := r.Result.NextRecord(rec)
+	if ok {
+		r.n++
+	}
+	return ok
+}
+
+// Collect receives and counts all remaining Records.
+func (r *countingResult) Collect() ([]*neo4j.Record, error) {
+	recs, err := r.Result.Collect()
+	r.n += len(recs)
+	return recs, err
+}
+
+// Single receives and counts exactly one Record.
+func (r *countingResult) Single() (*neo4j.Record, error) {
+	rec, err := r.Result.Single()
+	if err == nil {
+		r.n++
+	}
+	return rec, err
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"sync"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Runner runs the query of the Request with its Params and returns the Result.
+type Runner func(ctx context.Context, r Request) (neo4j.Result, error)
+
+// Interceptor wraps a Runner e.g., to redact parameters in audit logs, inject
+// a tenant ID into the Params, or record metrics. It may modify the Request
+// before calling next, or skip next and return an error instead:
+//
+//	func Tenant(id string) graph.Interceptor {
+//		return func(next graph.Runner) graph.Runner {
+//			return func(ctx context.Context, r graph.Request) (neo4j.Result, error) {
+//				r.Params = maps.Clone(r.Params)
+//				r.Params["tenant"] = id
+//				return next(ctx, r)
+//			}
+//		}
+//	}
+//
+// The Query of the Request is the one sent to the server i.e., including the
+// changes of the Template e.g., EXPLAIN in dry-run mode. The Params include
+// the default Params of the Conn. See OnSummary for observing the summary.
+type Interceptor func(next Runner) Runner
+
+// Use appends the Interceptors to the Interceptors of the Conn. It returns the
+// Conn for convenience.
+func (c *Conn) Use(is ...Interceptor) *Conn {
+	c.Interceptors = append(c.Interceptors, is...)
+	return c
+}
+
+// run encrypts the values of encrypted fields in the parameters, runs the
+// Request through the Interceptors of the Conn, the first one being the
+// outermost, and finally executes it with exec.
+func (c *Conn) run(ctx context.Context, r Request,
+	exec func(cypher string, params map[string]any) (neo4j.Result, error)) (neo4j.Result, error) {
+
+	ps, err := EncryptParams(r.Params)
+	if err != nil {
+		return nil, err
+	}
+	r.Params = ps
+	next := Runner(func(_ context.Context, r Request) (neo4j.Result, error) {
+		return exec(r.Query, r.Params)
+	})
+	for i := len(c.Interceptors) - 1; i >= 0; i-- {
+		next = c.Interceptors[i](next)
+	}
+	return c.metrics.query(next(ctx, r))
+}
+
+// OnSummary returns a Result, which calls fn with the ResultSummary or the
+// error, once it is consumed. Templates consume every Result, after the
+// Records have been received.
+func OnSummary(res neo4j.Result, fn func(sum neo4j.ResultSummary, err error)) neo4j.Result {
+	return &summaryResult{Result: res, fn: fn}
+}
+
+// summaryResult calls fn when the Result is consumed.
+type summaryResult struct {
+	neo4j.Result
+	fn   func(neo4j.ResultSummary, error)
+	once sync.Once
+}
+
+// Consume discards the remaining Records and passes the summary to fn.
+func (r *summaryResult) Consume() (neo4j.ResultSummary, error) {
+	sum, err := r.Result.Consume()
+	r.once.Do(func() { r.fn(sum, err) })
+	return sum, err
+}
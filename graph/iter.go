@@ -0,0 +1,127 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "github.com/neo4j/neo4j-go-driver/v4/neo4j"
+
+// iter holds the state of an iterator returned by QueryIter.
+type iter[T any] struct {
+	t    Template[T]
+	r    Request
+	m    Mapper[T]
+	id   string
+	sess neo4j.Session
+	tx   neo4j.Transaction
+	res  neo4j.Result
+	sum  neo4j.ResultSummary
+	err  error
+	done bool
+	n    int
+	fin  func(int, neo4j.ResultSummary, error)
+}
+
+// QueryIter executes the given Request in a separate Session and returns an
+// iterator, which maps one Record per call of next, without collecting them.
+// Unlike Stream, Records are pulled from the server by the calling goroutine,
+// in batches of the FetchSize of the Conn.
+//
+// next returns false after the last Record, when the result has been consumed
+// and the Transaction has been committed, or if an error occurred. stop
+// releases the Session and returns the ResultSummary and the error, if any.
+// It must always be called e.g., deferred; if next has not returned false
+// yet, the Transaction is rolled back. The RetryPolicy is not applied, since
+// Records may already have been processed.
+func (t Template[T]) QueryIter(r Request, m Mapper[T]) (
+	next func() (T, bool, error), stop func() (neo4j.ResultSummary, error)) {
+
+	it := &iter[T]{t: t, r: r, m: m}
+	it.err = it.open()
+	return it.next, it.stop
+}
+
+// open begins the Transaction and runs the query.
+func (it *iter[T]) open() (err error) {
+	c := it.t.conn
+	if err = c.checkReadOnly(it.r.Query); err != nil {
+		return err
+	}
+	it.sess = c.SessionMode(it.t.accessMode(it.r))
+	it.r.Metadata, it.id = correlate(it.r.Metadata)
+	if it.tx, err = it.sess.BeginTransaction(c.txConfig(it.r)...); err != nil {
+		return wrapErr(it.r.Query, err)
+	}
+	c.logQuery(it.r)
+	it.fin = c.instrument(it.t.context(), it.r)
+	rr := it.r
+	rr.Query, rr.Params = c.cypher(it.r.Query), it.t.params(it.r.Params)
+	if it.res, err = c.run(it.t.context(), rr, it.tx.Run); err != nil {
+		return wrapErr(it.r.Query, err)
+	}
+	return nil
+}
+
+// next maps the next Record or finishes the query after the last one.
+func (it *iter[T]) next() (val T, ok bool, err error) {
+	if it.err != nil || it.done {
+		return val, false, it.err
+	}
+	defer func() { it.err = err }()
+	defer recoverMapping(&err)
+	if it.res.Next() {
+		it.n++
+		return it.m(it.res.Record()), true, nil
+	}
+
+	it.done = true
+	sum, err := it.res.Consume()
+	if err != nil {
+		return val, false, wrapErr(it.r.Query, err)
+	}
+	it.t.conn.logSlow(it.r, sum)
+	if err = it.t.conn.checkNotifications(it.r.Query, sum); err != nil {
+		return val, false, err
+	} else if err = it.tx.Commit(); err != nil {
+		return val, false, wrapErr(it.r.Query, err)
+	}
+	it.t.conn.setBookmark(it.sess)
+	it.sum = correlated(sum, it.id)
+	it.finish(sum, nil)
+	return val, false, nil
+}
+
+// stop rolls back an unfinished Transaction and closes the Session.
+func (it *iter[T]) stop() (neo4j.ResultSummary, error) {
+	if it.tx != nil {
+		_ = it.tx.Close()
+		it.tx = nil
+	}
+	if it.sess != nil {
+		_ = it.sess.Close()
+		it.sess = nil
+	}
+	it.finish(nil, it.err)
+	if it.err != nil || !it.done {
+		return nil, it.err
+	}
+	return it.sum, nil
+}
+
+// finish reports the completion of the query to the Instrumentation once.
+func (it *iter[T]) finish(sum neo4j.ResultSummary, err error) {
+	if it.fin != nil {
+		it.fin(it.n, sum, err)
+		it.fin = nil
+	}
+}
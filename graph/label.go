@@ -0,0 +1,103 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"reflect"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// Labeler is implemented by entity types, whose labels differ from the ones
+// derived from their names e.g., to map onto an existing schema. The first
+// label is the primary one. Labels is called on the zero value of the type,
+// or on a pointer to it, if only the pointer type implements Labeler.
+//
+// Alternatively, a blank field declares the labels e.g.,
+//
+//	type Actor struct {
+//		_    struct{} `neo4j:"labels=Person:Actor"`
+//		Name string
+//	}
+type Labeler interface {
+	Labels() []string
+}
+
+// TitleCase is the NamingStrategy, which derives labels from type names by
+// default. It converts the first letter to upper case e.g., "person" to
+// "Person".
+func TitleCase(name string) string {
+	return cases.Title(language.Und, cases.NoLower).String(name)
+}
+
+// typeLabels returns the labels of the entity type. They are taken from
+//
+//   - the Labels method, if the type implements Labeler, or
+//   - the "labels" option of a blank field e.g.,
+//     _ struct{} `neo4j:"labels=Person:Actor"`, or
+//   - the name of the type converted by the NamingStrategy, or by TitleCase,
+//     if it is nil e.g., SnakeCase converts MovieGenre to "movie_genre".
+//
+// Pointer types have the labels of their element type.
+func typeLabels(typ reflect.Type, naming NamingStrategy) []string {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if ls := labelerLabels(typ); len(ls) > 0 {
+		return ls
+	}
+
+	if typ.Kind() == reflect.Struct {
+		for i := 0; i < typ.NumField(); i++ {
+			if f := typ.Field(i); f.Name == "_" {
+				if ls := optValue(strings.Split(f.Tag.Get("neo4j"), ","), "labels"); ls != "" {
+					return strings.Split(ls, ":")
+				}
+			}
+		}
+	}
+
+	if naming == nil {
+		naming = TitleCase
+	}
+	return []string{naming(typ.Name())}
+}
+
+var labelerType = reflect.TypeOf((*Labeler)(nil)).Elem()
+
+// labelerLabels returns the labels of the type, if it or its pointer type
+// implements Labeler.
+func labelerLabels(typ reflect.Type) []string {
+	switch {
+	case typ.Kind() == reflect.Interface:
+		return nil
+	case typ.Implements(labelerType):
+		return reflect.Zero(typ).Interface().(Labeler).Labels()
+	case reflect.PointerTo(typ).Implements(labelerType):
+		return reflect.New(typ).Interface().(Labeler).Labels()
+	}
+	return nil
+}
+
+// labelExpr returns the quoted labels separated by colons e.g., `A`:`B`.
+func labelExpr(labels []string) string {
+	qs := make([]string, len(labels))
+	for i, l := range labels {
+		qs[i] = Quote(l)
+	}
+	return strings.Join(qs, ":")
+}
@@ -0,0 +1,121 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// ErrTooManyRows indicates that a query returned more Records than the
+// maximum number of rows of the Template.
+var ErrTooManyRows = errors.New("too many rows")
+
+var (
+	trailingReturn = regexp.MustCompile(`(?is)\bRETURN\b[^}]*$`)
+	limitClause    = regexp.MustCompile(`(?i)\bLIMIT\b`)
+	unionClause    = regexp.MustCompile(`(?i)\bUNION\b`)
+)
+
+// WithMaxRows returns a copy of the Template, which rejects queries returning
+// more than n Records with ErrTooManyRows, before any Record is mapped.
+// If the query ends with a RETURN clause without LIMIT, a LIMIT of n+1 is
+// appended, so that the server stops producing Records as soon as the bound
+// is exceeded. Otherwise, at most n+1 Records are pulled and the remaining
+// ones are discarded. A value of zero disables the check.
+func (t Template[T]) WithMaxRows(n int) *Template[T] {
+	t.max = n
+	return &t
+}
+
+// limitQuery appends a LIMIT clause to the query, if it is safe to do so.
+func limitQuery(query string, n int) string {
+	q := strings.TrimRight(strings.TrimSpace(query), ";")
+	tail := trailingReturn.FindString(q)
+	if tail == "" || limitClause.MatchString(tail) || unionClause.MatchString(q) {
+		return query
+	}
+	return q + " LIMIT " + strconv.Itoa(n)
+}
+
+// limitResult pulls at most n+1 Records from the Result and returns a Result
+// replaying them, or ErrTooManyRows if there are more than n Records.
+func limitResult(query string, res neo4j.Result, n int) (neo4j.Result, error) {
+	var recs []*neo4j.Record
+	for len(recs) <= n && res.Next() {
+		recs = append(recs, res.Record())
+	}
+	if err := res.Err(); err != nil {
+		return nil, wrapErr(query, err)
+	} else if len(recs) > n {
+		return nil, ErrTooManyRows
+	}
+	return &bufferedResult{Result: res, recs: recs}, nil
+}
+
+// bufferedResult is a Result, whose Records have been pulled in advance.
+type bufferedResult struct {
+	neo4j.Result
+	recs []*neo4j.Record
+	rec  *neo4j.Record
+}
+
+func (r *bufferedResult) Next() bool {
+	return r.NextRecord(nil)
+}
+
+func (r *bufferedResult) NextRecord(out **neo4j.Record) bool {
+	r.rec = nil
+	if len(r.recs) > 0 {
+		r.rec, r.recs = r.recs[0], r.recs[1:]
+	}
+	if out != nil {
+		*out = r.rec
+	}
+	return r.rec != nil
+}
+
+func (r *bufferedResult) Record() *neo4j.Record {
+	return r.rec
+}
+
+func (r *bufferedResult) Collect() ([]*neo4j.Record, error) {
+	recs := r.recs
+	r.recs, r.rec = nil, nil
+	return recs, nil
+}
+
+func (r *bufferedResult) Single() (*neo4j.Record, error) {
+	if len(r.recs) != 1 {
+		return nil, errors.New("result does not contain exactly one record")
+	}
+	r.Next()
+	return r.rec, nil
+}
+
+// QueryAtMost is like Query, but returns ErrTooManyRows if the query returns
+// more than n Records. Unlike WithMaxRows, the bound applies to a single
+// query, which is expected to be naturally bounded.
+func (t Template[T]) QueryAtMost(r Request, n int, m Mapper[T]) ([]T, error) {
+	if n <= 0 {
+		return nil, errors.New("n must be positive")
+	}
+	list, _, err := t.WithMaxRows(n).Query(r, m)
+	return list, err
+}
@@ -0,0 +1,370 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package load imports nodes from CSV and JSON Lines streams without server
+// side file access, which LOAD CSV requires. Hence, it works with files,
+// which are only available to the client e.g., in containerized deployments.
+//
+// A Spec declares the label of the nodes and how the columns of the input are
+// mapped to their properties. The rows are written in batches using UNWIND,
+// and each batch is committed in its own Transaction, unless the Conn has an
+// active Transaction. After each batch, the Progress is reported. An aborted
+// import can be resumed by skipping the rows of the last committed Progress:
+//
+//	s := load.Spec{Label: "Person", Keys: []string{"id"},
+//		Columns: []load.Column{{Name: "id", Type: load.Int}, {Name: "name"}, {Name: "born", Type: load.Date}},
+//		Skip:    checkpoint(),
+//		Progress: func(p load.Progress) {
+//			if p.Committed {
+//				saveCheckpoint(p.Rows)
+//			}
+//		}}
+//	p, err := load.CSV(ctx, c, f, s)
+//
+// With Keys, nodes are merged, so that rows written by an aborted batch are
+// not duplicated when resuming.
+package load
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abc-inc/roland/graph"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Type is the type, to which the value of a Column is converted.
+type Type int
+
+const (
+	// Auto keeps JSON values as they are and converts CSV values to integers,
+	// finite floats or booleans, if possible, and strings otherwise. Numbers
+	// with leading zeros e.g., "007" are kept as strings, since they are
+	// usually codes rather than quantities.
+	Auto Type = iota
+	String
+	Int
+	Float
+	Bool
+	// Date parses values like "2006-01-02" and stores them as Date.
+	Date
+	// DateTime parses values in RFC 3339 format and stores them as DateTime.
+	DateTime
+)
+
+// String returns the name of the Type.
+func (t Type) String() string {
+	if t < Auto || t > DateTime {
+		return "Type(" + strconv.Itoa(int(t)) + ")"
+	}
+	return [...]string{"Auto", "String", "Int", "Float", "Bool", "Date", "DateTime"}[t]
+}
+
+// Column maps a column of the input to a property.
+type Column struct {
+	// Name is the name of the column in the CSV header or the key in JSON.
+	Name string
+	// Property is the property key. It defaults to Name.
+	Property string
+	Type     Type
+	// Required fails the import, if the value is missing or empty.
+	Required bool
+}
+
+// Spec declares how rows are imported.
+type Spec struct {
+	// Label is the label of the nodes.
+	Label string
+	// Keys are the properties, on which nodes are merged. Without keys, a node
+	// is created for every row.
+	Keys []string
+	// Columns lists the columns to import. If it is empty, all columns are
+	// imported as properties with the same names and type Auto.
+	Columns []Column
+	// BatchSize is the number of rows per Transaction. It defaults to the
+	// BatchSize of the Conn or graph.DefaultBatchSize.
+	BatchSize int
+	// Skip is the number of rows to skip e.g., the Rows of the last Progress
+	// of an aborted import.
+	Skip int64
+	// Progress is called after each written batch.
+	Progress func(p Progress)
+}
+
+// Progress is the state of an import.
+type Progress struct {
+	// Rows is the number of rows read so far, including skipped rows. All of
+	// them have been written.
+	Rows int64
+	// Committed reports whether the written rows have been committed. It is
+	// false, if the Conn has an active Transaction, because the rows are lost,
+	// if that Transaction is rolled back.
+	Committed bool
+	// Batches is the number of batches written so far.
+	Batches int
+	// Counters are the aggregated Counters of all batches.
+	Counters graph.Counters
+}
+
+// CSV imports the rows of a CSV stream, whose first line is the header.
+// Empty values are treated as missing.
+func CSV(ctx context.Context, c *graph.Conn, r io.Reader, s Spec) (Progress, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return Progress{}, fmt.Errorf("cannot read header: %w", err)
+	}
+	return run(ctx, c, s, func() (map[string]any, error) {
+		rec, err := cr.Read()
+		if err != nil {
+			return nil, err
+		}
+		row := make(map[string]any, len(header))
+		for i, k := range header {
+			if i < len(rec) && rec[i] != "" {
+				row[k] = rec[i]
+			}
+		}
+		return row, nil
+	})
+}
+
+// JSONLines imports a stream of JSON objects, usually one per line. Numbers
+// are imported as integers, if possible, and floats otherwise.
+func JSONLines(ctx context.Context, c *graph.Conn, r io.Reader, s Spec) (Progress, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return run(ctx, c, s, func() (map[string]any, error) {
+		var row map[string]any
+		if err := dec.Decode(&row); err != nil {
+			return nil, err
+		}
+		for k, v := range row {
+			row[k] = jsonValue(v)
+		}
+		return row, nil
+	})
+}
+
+// run reads the rows with next until io.EOF and writes them in batches.
+func run(ctx context.Context, c *graph.Conn, s Spec, next func() (map[string]any, error)) (p Progress, err error) {
+	if s.Label == "" {
+		return p, errors.New("label must not be empty")
+	}
+	size := s.BatchSize
+	if size <= 0 {
+		size = c.BatchSize
+	}
+	if size <= 0 {
+		size = graph.DefaultBatchSize
+	}
+
+	p.Committed = c.Tx == nil
+	r := graph.Request{Query: query(s), Write: true}
+	t := graph.NewTemplate[struct{}](c)
+	var rows []any
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		r.Params = map[string]any{"rows": rows}
+		_, sum, err := t.QueryContext(ctx, r, func(*neo4j.Record) struct{} { return struct{}{} })
+		if err != nil {
+			return fmt.Errorf("batch %d: %w", p.Batches+1, err)
+		}
+		p.Rows += int64(len(rows))
+		p.Batches++
+		p.Counters.Add(sum)
+		if s.Progress != nil {
+			s.Progress(p)
+		}
+		rows = make([]any, 0, size)
+		return nil
+	}
+
+	for line := int64(0); ; line++ {
+		row, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return p, graph.RowError{Index: int(line), Err: err}
+		} else if line < s.Skip {
+			p.Rows++
+			continue
+		}
+		props, err := convertRow(s, row)
+		if err != nil {
+			return p, graph.RowError{Index: int(line), Err: err}
+		}
+		if rows = append(rows, props); len(rows) == size {
+			if err = flush(); err != nil {
+				return p, err
+			}
+		}
+	}
+	return p, flush()
+}
+
+// query returns the UNWIND statement, which writes the $rows.
+func query(s Spec) string {
+	if len(s.Keys) == 0 {
+		return "UNWIND $rows AS row CREATE (n:" + graph.Quote(s.Label) + ") SET n = row"
+	}
+	conds := make([]string, len(s.Keys))
+	for i, k := range s.Keys {
+		conds[i] = graph.Quote(k) + ": row." + graph.Quote(k)
+	}
+	return fmt.Sprintf("UNWIND $rows AS row MERGE (n:%s {%s}) SET n += row",
+		graph.Quote(s.Label), strings.Join(conds, ", "))
+}
+
+// convertRow maps the values of the row to properties according to the Spec.
+func convertRow(s Spec, row map[string]any) (map[string]any, error) {
+	props := make(map[string]any, len(row))
+	if len(s.Columns) == 0 {
+		for k, v := range row {
+			if props[k], _ = convert(v, Auto); props[k] == nil {
+				delete(props, k)
+			}
+		}
+	}
+	for _, col := range s.Columns {
+		key := col.Property
+		if key == "" {
+			key = col.Name
+		}
+		v, ok := row[col.Name]
+		if !ok || v == nil {
+			if col.Required {
+				return nil, fmt.Errorf("column %q is missing", col.Name)
+			}
+			continue
+		}
+		val, err := convert(v, col.Type)
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %w", col.Name, err)
+		}
+		props[key] = val
+	}
+	for _, k := range s.Keys {
+		if props[k] == nil {
+			return nil, fmt.Errorf("key %q is not set", k)
+		}
+	}
+	return props, nil
+}
+
+// convert converts a value to the given Type. Strings are parsed, whereas
+// other values must already have the Type e.g., JSON numbers for Int.
+func convert(v any, typ Type) (any, error) {
+	s, isStr := v.(string)
+	switch typ {
+	case String:
+		if isStr {
+			return s, nil
+		}
+		return fmt.Sprint(v), nil
+	case Int:
+		if isStr {
+			return strconv.ParseInt(s, 10, 64)
+		} else if f, ok := v.(float64); ok && f == float64(int64(f)) {
+			return int64(f), nil
+		}
+	case Float:
+		if isStr {
+			return strconv.ParseFloat(s, 64)
+		} else if i, ok := v.(int64); ok {
+			return float64(i), nil
+		}
+	case Bool:
+		if isStr {
+			return strconv.ParseBool(s)
+		}
+	case Date:
+		if isStr {
+			t, err := time.Parse("2006-01-02", s)
+			return neo4j.DateOf(t), err
+		}
+	case DateTime:
+		if isStr {
+			return time.Parse(time.RFC3339Nano, s)
+		}
+	default:
+		if isStr {
+			return autoValue(s), nil
+		}
+		return v, nil
+	}
+
+	switch v.(type) {
+	case int64:
+		if typ == Int {
+			return v, nil
+		}
+	case float64:
+		if typ == Float {
+			return v, nil
+		}
+	case bool:
+		if typ == Bool {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot convert %T to %v", v, typ)
+}
+
+// autoValue converts a string to an integer, finite float or boolean, if
+// possible. Numbers with leading zeros are kept as strings.
+func autoValue(s string) any {
+	if d := strings.TrimLeft(s, "+-"); len(d) > 1 && d[0] == '0' && !strings.ContainsRune(".eE", rune(d[1])) {
+		return s
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	} else if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f
+	} else if s == "true" || s == "false" {
+		return s == "true"
+	}
+	return s
+}
+
+// jsonValue converts json.Numbers to int64 or float64, recursively.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []any:
+		for i, e := range v {
+			v[i] = jsonValue(e)
+		}
+	case map[string]any:
+		for k, e := range v {
+			v[k] = jsonValue(e)
+		}
+	}
+	return v
+}
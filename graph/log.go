@@ -0,0 +1,124 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Logger receives log messages about the operations performed by a Conn.
+// Loggers of popular libraries, such as *zap.SugaredLogger and logrus, satisfy
+// it directly. Others can be adapted with LogFuncs, and the standard library
+// logger with StdLogger.
+type Logger interface {
+	Debugf(format string, args ...any)
+	Warnf(format string, args ...any)
+}
+
+// LogFuncs adapts functions, which log a message at debug and warn level, to
+// a Logger e.g., for structured loggers like slog or zerolog. A nil function
+// discards the messages of its level.
+type LogFuncs struct {
+	Debug func(msg string)
+	Warn  func(msg string)
+}
+
+// Debugf formats the message and passes it to Debug.
+func (f LogFuncs) Debugf(format string, args ...any) {
+	if f.Debug != nil {
+		f.Debug(fmt.Sprintf(format, args...))
+	}
+}
+
+// Warnf formats the message and passes it to Warn.
+func (f LogFuncs) Warnf(format string, args ...any) {
+	if f.Warn != nil {
+		f.Warn(fmt.Sprintf(format, args...))
+	}
+}
+
+// StdLogger adapts a logger of the standard library to a Logger. Messages are
+// prefixed with their level. If debug is false, debug messages are discarded.
+func StdLogger(l *log.Logger, debug bool) Logger {
+	f := LogFuncs{Warn: func(msg string) { l.Print("WARN " + msg) }}
+	if debug {
+		f.Debug = func(msg string) { l.Print("DEBUG " + msg) }
+	}
+	return f
+}
+
+// logQuery logs the name, the transaction metadata and the query of the
+// Request at debug level.
+func (c *Conn) logQuery(r Request) {
+	if c.Logger != nil {
+		c.Logger.Debugf("query %s %v: %s", r.QueryName(), r.Metadata, Redact(r.Query))
+	}
+}
+
+// logSlow logs the Request at warn level, if the server took longer than the
+// SlowQueryThreshold to produce and consume the result. Only the names of the
+// parameters are logged, since their values may be sensitive.
+func (c *Conn) logSlow(r Request, sum neo4j.ResultSummary) {
+	if c.Logger == nil || c.SlowQueryThreshold <= 0 || sum == nil {
+		return
+	}
+	d := sum.ResultAvailableAfter() + sum.ResultConsumedAfter()
+	if d > c.SlowQueryThreshold {
+		names := make([]string, 0, len(r.Params))
+		for k := range r.Params {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		c.Logger.Warnf("slow query %s %v (%s) %v: %s", r.QueryName(), r.Metadata, d, names, Redact(r.Query))
+	}
+}
+
+// Redact replaces all string literals in the Cypher query with '***', so that
+// it can be logged without revealing sensitive values. Quoted identifiers are
+// preserved. Parameters are not affected, since they are not part of the query.
+func Redact(query string) string {
+	sb := strings.Builder{}
+	var quote rune
+	esc := false
+	for _, c := range query {
+		switch {
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+			sb.WriteString("'***'")
+		case quote == 0 && c == '`':
+			quote = c
+			sb.WriteRune(c)
+		case quote == '`':
+			if c == quote {
+				quote = 0
+			}
+			sb.WriteRune(c)
+		case quote == 0:
+			sb.WriteRune(c)
+		case esc:
+			esc = false
+		case c == '\\':
+			esc = true
+		case c == quote:
+			quote = 0
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// ErrDuplicateKey indicates that two Records have the same key.
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// DuplicatePolicy controls how QueryMapBy handles Records with the same key.
+type DuplicatePolicy int
+
+const (
+	// FailOnDuplicate returns ErrDuplicateKey. This is the default.
+	FailOnDuplicate DuplicatePolicy = iota
+	// LastWins keeps the value mapped from the last Record with the key.
+	LastWins
+)
+
+// QueryMapBy is like Template.Query, but returns the mapped Records in a map,
+// whose keys are extracted from each Record by keyFn e.g., the ID of a node.
+// Since methods cannot have type parameters, the Template is an argument.
+func QueryMapBy[K comparable, T any](t *Template[T], r Request, keyFn func(rec *neo4j.Record) K,
+	m Mapper[T], dups DuplicatePolicy) (vals map[K]T, err error) {
+
+	_, err = t.execute(r, func(res neo4j.Result) error {
+		vals = make(map[K]T)
+		for res.Next() {
+			k := keyFn(res.Record())
+			if _, ok := vals[k]; ok && dups == FailOnDuplicate {
+				return fmt.Errorf("%w: %v", ErrDuplicateKey, k)
+			}
+			vals[k] = m(res.Record())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vals, nil
+}
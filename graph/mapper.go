@@ -15,13 +15,17 @@
 package graph
 
 import (
+	"fmt"
+	"reflect"
+
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
 )
 
 // Mapper is used by Template for mapping results on a per-record basis.
 // Implementations of this type perform the actual work of mapping each Record
 // to a type, but don't need to worry about error handling. Errors will be
-// handled by the calling Template.
+// handled by the calling Template. A Mapper may panic with a MappingError to
+// report a value, which cannot be mapped. It is returned by the Template.
 type Mapper[T any] func(rec *neo4j.Record) T
 
 // NewSingleValueMapper creates a new Mapper that converts a single column into
@@ -34,6 +38,46 @@ func NewSingleValueMapper[T any](idx int) Mapper[T] {
 	}
 }
 
+// NewStructMapper creates a new Mapper that assigns the values of each Record
+// to the fields of a struct, whose property keys match the record keys.
+// The property key of a field is taken from its "neo4j" tag or derived from
+// its name using the DefaultNaming strategy.
+// Numbers and lists are converted to the type of the field. If a value cannot
+// be assigned, a MappingError is raised. A field of type map[string]any tagged
+// `neo4j:",remainder"` receives all values, which are not mapped to a field.
+func NewStructMapper[T any]() Mapper[T] {
+	return NewStructMapperWith[T](Decoder{})
+}
+
+// NewStructMapperWith is like NewStructMapper, but uses the given Decoder
+// e.g., to report all fields, which cannot be mapped, at once.
+func NewStructMapperWith[T any](d Decoder) Mapper[T] {
+	fs := fields(reflect.TypeOf(new(T)))
+	return func(rec *neo4j.Record) (t T) {
+		if err := d.decode(rec, reflect.ValueOf(&t).Elem(), fs); err != nil {
+			panic(err)
+		}
+		return t
+	}
+}
+
+// NewNodePropsMapper creates a new Mapper that extracts the properties of the
+// Node in the column with the given key. If the column is missing or does not
+// contain a Node, a MappingError is raised.
+func NewNodePropsMapper(key string) Mapper[map[string]any] {
+	return func(rec *neo4j.Record) map[string]any {
+		v, ok := rec.Get(key)
+		if !ok {
+			panic(&MappingError{Key: key, Err: errNoColumn})
+		}
+		n, ok := v.(neo4j.Node)
+		if !ok {
+			panic(&MappingError{Key: key, Err: fmt.Errorf("expected a node, got %T", v)})
+		}
+		return n.Props
+	}
+}
+
 // NewResultMapper creates a new Mapper that converts Records to Results.
 // For each Node and Relationship, its properties are extracted into a map.
 // Additionally, IDs, labels and types are added so that specific modifications
@@ -0,0 +1,334 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package migrate applies versioned Cypher migrations to a database.
+//
+// Migrations are files named <version>_<name>.up.cypher and, optionally,
+// <version>_<name>.down.cypher e.g., 0001_create_person_index.up.cypher.
+// A file may contain several statements, each terminated by a semicolon at
+// the end of a line. Every statement is executed in its own Transaction,
+// since schema and data changes must not be mixed in one Transaction.
+//
+// Each applied migration is recorded as a :__Migration node. A lease on a
+// :__MigrationLock node, which is unique by a constraint and renewed while
+// migrating, prevents concurrent instances of an application from applying
+// migrations at the same time.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abc-inc/roland/graph"
+	"github.com/abc-inc/roland/graph/schema"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// ErrLocked indicates that another Migrator holds the lock.
+var ErrLocked = errors.New("migrations are locked by another instance")
+
+// ErrNoDown indicates that a migration cannot be reverted, because it has no
+// down script.
+var ErrNoDown = errors.New("migration has no down script")
+
+var (
+	// fileName matches the names of migration files.
+	fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.cypher$`)
+	// separator matches the end of a statement.
+	separator = regexp.MustCompile(`;[ \t]*(\r?\n|$)`)
+)
+
+// Migration is a versioned change of the database.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load reads all migrations from the directory of the file system e.g., an
+// embed.FS or os.DirFS. Other files are ignored. The migrations are sorted by
+// version.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	es, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVer := make(map[int64]*Migration)
+	for _, e := range es {
+		m := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		ver, _ := strconv.ParseInt(m[1], 10, 64)
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVer[ver]
+		if !ok {
+			mig = &Migration{Version: ver, Name: m[2]}
+			byVer[ver] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("version %d is used by %q and %q", ver, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(b)
+		} else {
+			mig.Down = string(b)
+		}
+	}
+
+	ms := make([]Migration, 0, len(byVer))
+	for _, m := range byVer {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		ms = append(ms, *m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return ms, nil
+}
+
+// Migrator applies and reverts Migrations.
+type Migrator struct {
+	conn  *graph.Conn
+	ms    []Migration
+	owner string
+	// DryRun reports the migrations, which would be applied or reverted,
+	// without executing them or acquiring the lock.
+	DryRun bool
+	// LockTTL is the duration of the lease on the lock. If an instance
+	// crashes while holding the lock, others can acquire it after that time.
+	// The lease is renewed while migrating, if it is at least three seconds.
+	LockTTL time.Duration
+}
+
+// New creates a new Migrator for the given migrations.
+func New(conn *graph.Conn, ms []Migration) *Migrator {
+	ms = append([]Migration(nil), ms...)
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	owner := strconv.FormatInt(time.Now().UnixNano(), 36)
+	return &Migrator{conn: conn, ms: ms, owner: owner, LockTTL: 10 * time.Minute}
+}
+
+// Applied returns the versions of all applied migrations in ascending order.
+func (m *Migrator) Applied() ([]int64, error) {
+	r := graph.Request{Query: "MATCH (m:__Migration) RETURN m.version ORDER BY m.version"}
+	vs, _, err := graph.NewTemplate[int64](m.conn).Query(r, graph.NewSingleValueMapper[int64](0))
+	return vs, err
+}
+
+// Pending returns the migrations, which have not been applied yet.
+func (m *Migrator) Pending() ([]Migration, error) {
+	vs, err := m.Applied()
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]bool, len(vs))
+	for _, v := range vs {
+		applied[v] = true
+	}
+	var ms []Migration
+	for _, mig := range m.ms {
+		if !applied[mig.Version] {
+			ms = append(ms, mig)
+		}
+	}
+	return ms, nil
+}
+
+// Up applies all pending migrations in ascending order and returns them.
+// If a statement fails, the migrations applied before are kept, and the
+// failing migration is not recorded; its statements, which succeeded, are not
+// reverted.
+func (m *Migrator) Up() (done []Migration, err error) {
+	err = m.locked(func() error {
+		ms, err := m.Pending()
+		if err != nil || m.DryRun {
+			done = ms
+			return err
+		}
+		for _, mig := range ms {
+			if err = m.run(mig, mig.Up); err != nil {
+				return err
+			}
+			if err = m.exec("MERGE (m:__Migration {version: $version}) "+
+				"SET m.name = $name, m.appliedAt = datetime()", mig); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the given number of most recently applied migrations in
+// descending order and returns them. If one of them has no down script,
+// ErrNoDown is returned before anything is reverted.
+func (m *Migrator) Down(steps int) (done []Migration, err error) {
+	err = m.locked(func() error {
+		vs, err := m.Applied()
+		if err != nil {
+			return err
+		}
+		var ms []Migration
+		for i := len(vs) - 1; i >= 0 && len(ms) < steps; i-- {
+			mig, ok := m.find(vs[i])
+			if !ok {
+				return fmt.Errorf("applied migration %d is unknown", vs[i])
+			} else if mig.Down == "" {
+				return fmt.Errorf("%w: %d_%s", ErrNoDown, mig.Version, mig.Name)
+			}
+			ms = append(ms, mig)
+		}
+		if m.DryRun {
+			done = ms
+			return nil
+		}
+
+		for _, mig := range ms {
+			if err = m.run(mig, mig.Down); err != nil {
+				return err
+			}
+			if err = m.exec("MATCH (m:__Migration {version: $version}) DELETE m", mig); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// find returns the migration with the given version.
+func (m *Migrator) find(ver int64) (Migration, bool) {
+	for _, mig := range m.ms {
+		if mig.Version == ver {
+			return mig, true
+		}
+	}
+	return Migration{}, false
+}
+
+// run executes the statements of the script one by one.
+func (m *Migrator) run(mig Migration, script string) error {
+	for _, stmt := range separator.Split(script, -1) {
+		if stmt = strings.TrimSpace(stmt); stmt == "" {
+			continue
+		}
+		r := graph.Request{Query: stmt, Write: true, Idempotency: graph.NotIdempotent}
+		if _, _, err := graph.NewTemplate[any](m.conn).Query(r, discard); err != nil {
+			return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+	}
+	return nil
+}
+
+// exec executes a bookkeeping query for the migration.
+func (m *Migrator) exec(cyp string, mig Migration) error {
+	params := map[string]any{"version": mig.Version, "name": mig.Name}
+	_, _, err := graph.NewTemplate[any](m.conn).Query(graph.Request{Query: cyp, Params: params, Write: true}, discard)
+	return err
+}
+
+// lockConstraint ensures that there is a single lock node, even if several
+// instances try to acquire the lock for the first time concurrently.
+var lockConstraint = schema.UniqueConstraint{Name: "__migration_lock_id", Label: "__MigrationLock", Properties: []string{"id"}}
+
+// locked acquires the lock, calls fn and releases the lock. While fn is
+// running, the lease is renewed every third of the LockTTL. If it could not
+// be renewed, because another instance took over, ErrLocked is returned
+// after fn returns. In dry-run mode, fn is called without locking.
+func (m *Migrator) locked(fn func() error) error {
+	if m.DryRun {
+		return fn()
+	}
+	if _, err := schema.EnsureSchema(m.conn, lockConstraint); err != nil {
+		return err
+	}
+
+	const cypLock = "MERGE (l:__MigrationLock {id: 0}) " +
+		"WITH l WHERE l.owner IS NULL OR l.owner = $owner OR l.expiresAt < datetime() " +
+		"SET l.owner = $owner, l.expiresAt = datetime() + duration({seconds: $ttl}) " +
+		"RETURN count(l)"
+	const cypUnlock = "MATCH (l:__MigrationLock {id: 0}) WHERE l.owner = $owner " +
+		"REMOVE l.owner, l.expiresAt"
+
+	params := map[string]any{"owner": m.owner, "ttl": int64(m.LockTTL / time.Second)}
+	n, err := graph.NewTemplate[int64](m.conn).QuerySingle(cypLock, params, graph.NewSingleValueMapper[int64](0))
+	if err != nil {
+		return err
+	} else if n == 0 && !m.conn.DryRun {
+		return ErrLocked
+	}
+
+	stop, lost := m.renew(params)
+	err = fn()
+	stop()
+	_, _, uerr := graph.NewTemplate[any](m.conn).Query(graph.Request{Query: cypUnlock, Params: params, Write: true}, discard)
+	if err == nil && <-lost {
+		err = fmt.Errorf("%w: the lease expired during the migration", ErrLocked)
+	} else if err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// renew extends the lease periodically in a clone of the Conn, until stop is
+// called. Afterwards, lost receives whether the lease could not be renewed.
+func (m *Migrator) renew(params map[string]any) (stop func(), lost <-chan bool) {
+	const cypRenew = "MATCH (l:__MigrationLock {id: 0}) WHERE l.owner = $owner " +
+		"SET l.expiresAt = datetime() + duration({seconds: $ttl}) RETURN count(l)"
+
+	done, res := make(chan struct{}), make(chan bool, 1)
+	if m.LockTTL < 3*time.Second {
+		res <- false
+		return func() {}, res
+	}
+	go func() {
+		c, failed := m.conn.Clone(), false
+		defer func() { res <- failed }()
+		t := time.NewTicker(m.LockTTL / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				n, err := graph.NewTemplate[int64](c).QuerySingle(cypRenew, params, graph.NewSingleValueMapper[int64](0))
+				if err == nil && n == 0 && !c.DryRun {
+					failed = true
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }, res
+}
+
+// discard ignores a Record.
+func discard(*neo4j.Record) any {
+	return nil
+}
@@ -0,0 +1,322 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mock provides a fake Neo4j driver for unit tests, which returns
+// canned Records for expected queries instead of connecting to a database.
+//
+//	d := mock.New()
+//	d.Expect("MATCH (p:Person) RETURN p.name").WillReturn([]string{"p.name"}, []any{"Alice"})
+//	names, _, err := graph.NewTemplate[string](d.Conn()).Query(r, graph.NewSingleValueMapper[string](0))
+//	err = d.ExpectationsWereMet()
+package mock
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/abc-inc/roland/graph"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Query is a query executed by the Driver.
+type Query struct {
+	Cypher string
+	Params map[string]any
+}
+
+// Expectation describes an expected query and its outcome.
+type Expectation struct {
+	cypher string
+	re     *regexp.Regexp
+	params map[string]any
+	keys   []string
+	rows   [][]any
+	cnt    graph.Counters
+	notes  []graph.Notification
+	err    error
+	repeat bool
+	calls  int
+}
+
+// WithParams restricts the Expectation to queries, which have the given
+// parameters. Other parameters of the query are ignored.
+func (e *Expectation) WithParams(params map[string]any) *Expectation {
+	e.params = params
+	return e
+}
+
+// WillReturn sets the keys and the values of the Records returned by the
+// query. Each row holds the values of one Record in the order of the keys.
+func (e *Expectation) WillReturn(keys []string, rows ...[]any) *Expectation {
+	e.keys, e.rows = keys, rows
+	return e
+}
+
+// WillAffect sets the Counters of the ResultSummary returned by the query.
+func (e *Expectation) WillAffect(cnt graph.Counters) *Expectation {
+	e.cnt = cnt
+	return e
+}
+
+// WillNotify sets the Notifications of the ResultSummary returned by the
+// query e.g., to test Conn.FailOn. The categories are derived from the codes.
+func (e *Expectation) WillNotify(ns ...graph.Notification) *Expectation {
+	e.notes = ns
+	return e
+}
+
+// WillFail lets the query fail with the given error e.g., a *neo4j.Neo4jError
+// with a certain Code to test the error handling.
+func (e *Expectation) WillFail(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Repeatedly lets the Expectation match any number of queries. By default,
+// it matches a single query.
+func (e *Expectation) Repeatedly() *Expectation {
+	e.repeat = true
+	return e
+}
+
+// matches returns whether the Expectation matches the query.
+func (e *Expectation) matches(cypher string, params map[string]any) bool {
+	if !e.repeat && e.calls > 0 {
+		return false
+	} else if e.re != nil && !e.re.MatchString(cypher) {
+		return false
+	} else if e.re == nil && normalize(e.cypher) != normalize(cypher) {
+		return false
+	}
+	for k, v := range e.params {
+		if pv, ok := params[k]; !ok || !reflect.DeepEqual(pv, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the expected query.
+func (e *Expectation) String() string {
+	if e.re != nil {
+		return "/" + e.re.String() + "/"
+	}
+	return e.cypher
+}
+
+// normalize collapses all whitespace of the query.
+func normalize(cypher string) string {
+	return strings.Join(strings.Fields(cypher), " ")
+}
+
+// Driver is a fake neo4j.Driver, which answers queries according to its
+// Expectations. Queries, which do not match any Expectation, fail. It is safe
+// for concurrent use.
+type Driver struct {
+	mu        sync.Mutex
+	exps      []*Expectation
+	queries   []Query
+	commits   int
+	rollbacks int
+}
+
+// New creates a new Driver without Expectations.
+func New() *Driver {
+	return &Driver{}
+}
+
+// Conn returns a Conn, which uses the Driver.
+func (d *Driver) Conn() *graph.Conn {
+	return &graph.Conn{Driver: d, Params: make(map[string]any)}
+}
+
+// Expect adds an Expectation for the query, which matches if the query equals
+// the given one, ignoring differences in whitespace.
+func (d *Driver) Expect(cypher string) *Expectation {
+	return d.add(&Expectation{cypher: cypher})
+}
+
+// ExpectRegexp adds an Expectation for all queries matching the pattern.
+// It panics, if the pattern is invalid.
+func (d *Driver) ExpectRegexp(pattern string) *Expectation {
+	return d.add(&Expectation{re: regexp.MustCompile(pattern)})
+}
+
+// add adds the Expectation.
+func (d *Driver) add(e *Expectation) *Expectation {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.exps = append(d.exps, e)
+	return e
+}
+
+// ExpectationsWereMet returns an error, if an Expectation did not match any
+// query.
+func (d *Driver) ExpectationsWereMet() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var missing []string
+	for _, e := range d.exps {
+		if e.calls == 0 {
+			missing = append(missing, e.String())
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("mock: expected queries were not executed:\n  %s", strings.Join(missing, "\n  "))
+	}
+	return nil
+}
+
+// Queries returns all queries executed so far, including unexpected ones.
+func (d *Driver) Queries() []Query {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Query(nil), d.queries...)
+}
+
+// Commits returns the number of committed explicit Transactions.
+func (d *Driver) Commits() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.commits
+}
+
+// Rollbacks returns the number of Transactions, which were rolled back.
+func (d *Driver) Rollbacks() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rollbacks
+}
+
+// run answers a query with the first matching Expectation.
+func (d *Driver) run(cypher string, params map[string]any) (neo4j.Result, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries = append(d.queries, Query{Cypher: cypher, Params: params})
+	for _, e := range d.exps {
+		if !e.matches(cypher, params) {
+			continue
+		}
+		e.calls++
+		if e.err != nil {
+			return nil, e.err
+		}
+		return newResult(e, cypher, params), nil
+	}
+	return nil, fmt.Errorf("mock: unexpected query: %s", cypher)
+}
+
+// Target returns a fake URI.
+func (d *Driver) Target() url.URL {
+	return url.URL{Scheme: "bolt", Host: "mock:7687"}
+}
+
+// NewSession creates a new Session.
+func (d *Driver) NewSession(neo4j.SessionConfig) neo4j.Session {
+	return &session{d: d}
+}
+
+// Session creates a new Session.
+func (d *Driver) Session(neo4j.AccessMode, ...string) (neo4j.Session, error) {
+	return &session{d: d}, nil
+}
+
+// VerifyConnectivity always succeeds.
+func (d *Driver) VerifyConnectivity() error {
+	return nil
+}
+
+// Close does nothing.
+func (d *Driver) Close() error {
+	return nil
+}
+
+// session is a fake neo4j.Session.
+type session struct {
+	d *Driver
+}
+
+func (s *session) LastBookmark() string {
+	return ""
+}
+
+func (s *session) BeginTransaction(...func(*neo4j.TransactionConfig)) (neo4j.Transaction, error) {
+	return &transaction{d: s.d}, nil
+}
+
+func (s *session) ReadTransaction(work neo4j.TransactionWork, _ ...func(*neo4j.TransactionConfig)) (any, error) {
+	return s.transaction(work)
+}
+
+func (s *session) WriteTransaction(work neo4j.TransactionWork, _ ...func(*neo4j.TransactionConfig)) (any, error) {
+	return s.transaction(work)
+}
+
+// transaction executes the work in a managed Transaction, which is committed
+// if the work succeeds and rolled back otherwise.
+func (s *session) transaction(work neo4j.TransactionWork) (any, error) {
+	tx := &transaction{d: s.d}
+	v, err := work(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	return v, tx.Commit()
+}
+
+func (s *session) Run(cypher string, params map[string]any, _ ...func(*neo4j.TransactionConfig)) (neo4j.Result, error) {
+	return s.d.run(cypher, params)
+}
+
+func (s *session) Close() error {
+	return nil
+}
+
+// transaction is a fake neo4j.Transaction.
+type transaction struct {
+	d    *Driver
+	done bool
+}
+
+func (tx *transaction) Run(cypher string, params map[string]any) (neo4j.Result, error) {
+	return tx.d.run(cypher, params)
+}
+
+func (tx *transaction) Commit() error {
+	return tx.finish(&tx.d.commits)
+}
+
+func (tx *transaction) Rollback() error {
+	return tx.finish(&tx.d.rollbacks)
+}
+
+// finish increments the counter, unless the Transaction is already
+// finished.
+func (tx *transaction) finish(n *int) error {
+	tx.d.mu.Lock()
+	defer tx.d.mu.Unlock()
+	if !tx.done {
+		tx.done = true
+		*n++
+	}
+	return nil
+}
+
+func (tx *transaction) Close() error {
+	return tx.Rollback()
+}
@@ -0,0 +1,299 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mock
+
+import (
+	"time"
+
+	"github.com/abc-inc/roland/graph"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j/db"
+)
+
+// result is a fake neo4j.Result holding the Records of an Expectation.
+type result struct {
+	keys []string
+	recs []*neo4j.Record
+	idx  int
+	sum  *summary
+}
+
+// newResult creates a result for the query.
+func newResult(e *Expectation, cypher string, params map[string]any) *result {
+	recs := make([]*neo4j.Record, len(e.rows))
+	for i, row := range e.rows {
+		recs[i] = &neo4j.Record{Keys: e.keys, Values: row}
+	}
+	return &result{keys: e.keys, recs: recs, idx: -1,
+		sum: &summary{query: query{cypher, params}, cnt: counters{e.cnt}, notes: e.notes}}
+}
+
+func (r *result) Keys() ([]string, error) {
+	return r.keys, nil
+}
+
+func (r *result) Next() bool {
+	if r.idx < len(r.recs) {
+		r.idx++
+	}
+	return r.idx < len(r.recs)
+}
+
+func (r *result) NextRecord(rec **neo4j.Record) bool {
+	ok := r.Next()
+	*rec = r.Record()
+	return ok
+}
+
+func (r *result) Err() error {
+	return nil
+}
+
+func (r *result) Record() *neo4j.Record {
+	if r.idx < 0 || r.idx >= len(r.recs) {
+		return nil
+	}
+	return r.recs[r.idx]
+}
+
+func (r *result) Collect() ([]*neo4j.Record, error) {
+	var recs []*neo4j.Record
+	for r.Next() {
+		recs = append(recs, r.Record())
+	}
+	return recs, nil
+}
+
+func (r *result) Single() (*neo4j.Record, error) {
+	if !r.Next() {
+		return nil, &neo4j.UsageError{Message: "Result contains no more records"}
+	}
+	rec := r.Record()
+	if r.idx < len(r.recs)-1 {
+		r.idx = len(r.recs)
+		return nil, &neo4j.UsageError{Message: "Result contains more than one record"}
+	}
+	return rec, nil
+}
+
+func (r *result) Consume() (neo4j.ResultSummary, error) {
+	r.idx = len(r.recs)
+	return r.sum, nil
+}
+
+// summary is a fake neo4j.ResultSummary.
+type summary struct {
+	query query
+	cnt   counters
+	notes []graph.Notification
+}
+
+func (s *summary) Server() neo4j.ServerInfo {
+	return server{}
+}
+
+func (s *summary) Statement() neo4j.Statement {
+	return s.query
+}
+
+func (s *summary) Query() neo4j.Query {
+	return s.query
+}
+
+func (s *summary) StatementType() neo4j.StatementType {
+	return neo4j.StatementTypeUnknown
+}
+
+func (s *summary) Counters() neo4j.Counters {
+	return s.cnt
+}
+
+func (s *summary) Plan() neo4j.Plan {
+	return nil
+}
+
+func (s *summary) Profile() neo4j.ProfiledPlan {
+	return nil
+}
+
+func (s *summary) Notifications() []neo4j.Notification {
+	ns := make([]neo4j.Notification, len(s.notes))
+	for i, n := range s.notes {
+		ns[i] = notification{n}
+	}
+	return ns
+}
+
+func (s *summary) ResultAvailableAfter() time.Duration {
+	return 0
+}
+
+func (s *summary) ResultConsumedAfter() time.Duration {
+	return 0
+}
+
+func (s *summary) Database() neo4j.DatabaseInfo {
+	return database{}
+}
+
+// query is a fake neo4j.Query.
+type query struct {
+	cypher string
+	params map[string]any
+}
+
+func (q query) Text() string {
+	return q.cypher
+}
+
+func (q query) Params() map[string]any {
+	return q.params
+}
+
+func (q query) Parameters() map[string]any {
+	return q.params
+}
+
+// server is a fake neo4j.ServerInfo.
+type server struct{}
+
+func (server) Address() string {
+	return "mock:7687"
+}
+
+func (server) Version() string {
+	return "Neo4j/4.4.0"
+}
+
+func (server) Agent() string {
+	return "Neo4j/4.4.0"
+}
+
+func (server) ProtocolVersion() db.ProtocolVersion {
+	return db.ProtocolVersion{Major: 4, Minor: 4}
+}
+
+// database is a fake neo4j.DatabaseInfo.
+type database struct{}
+
+func (database) Name() string {
+	return "neo4j"
+}
+
+// counters is a fake neo4j.Counters.
+type counters struct {
+	c graph.Counters
+}
+
+func (c counters) ContainsUpdates() bool {
+	return c.c != graph.Counters{}
+}
+
+func (c counters) NodesCreated() int {
+	return c.c.NodesCreated
+}
+
+func (c counters) NodesDeleted() int {
+	return c.c.NodesDeleted
+}
+
+func (c counters) RelationshipsCreated() int {
+	return c.c.RelationshipsCreated
+}
+
+func (c counters) RelationshipsDeleted() int {
+	return c.c.RelationshipsDeleted
+}
+
+func (c counters) PropertiesSet() int {
+	return c.c.PropertiesSet
+}
+
+func (c counters) LabelsAdded() int {
+	return c.c.LabelsAdded
+}
+
+func (c counters) LabelsRemoved() int {
+	return c.c.LabelsRemoved
+}
+
+func (c counters) IndexesAdded() int {
+	return c.c.IndexesAdded
+}
+
+func (c counters) IndexesRemoved() int {
+	return c.c.IndexesRemoved
+}
+
+func (c counters) ConstraintsAdded() int {
+	return c.c.ConstraintsAdded
+}
+
+func (c counters) ConstraintsRemoved() int {
+	return c.c.ConstraintsRemoved
+}
+
+func (c counters) SystemUpdates() int {
+	return 0
+}
+
+func (c counters) ContainsSystemUpdates() bool {
+	return false
+}
+
+// notification is a fake neo4j.Notification.
+type notification struct {
+	n graph.Notification
+}
+
+func (n notification) Code() string {
+	return n.n.Code
+}
+
+func (n notification) Title() string {
+	return n.n.Title
+}
+
+func (n notification) Description() string {
+	return n.n.Description
+}
+
+func (n notification) Position() neo4j.InputPosition {
+	if n.n.Line == 0 {
+		return nil
+	}
+	return position{n.n}
+}
+
+func (n notification) Severity() string {
+	return n.n.Severity
+}
+
+// position is a fake neo4j.InputPosition.
+type position struct {
+	n graph.Notification
+}
+
+func (p position) Offset() int {
+	return 0
+}
+
+func (p position) Line() int {
+	return p.n.Line
+}
+
+func (p position) Column() int {
+	return p.n.Column
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NamingStrategy derives a property key from the name of a struct field.
+type NamingStrategy func(field string) string
+
+// DefaultNaming is the NamingStrategy used to derive property keys from struct
+// fields, which have no name in their "neo4j" tag. It applies to both, reading
+// (mapping Records) and writing (building parameters), so that both use the
+// same keys. It should only be set during initialization.
+var DefaultNaming NamingStrategy = AsIs
+
+// AsIs uses the field name as property key e.g., "CreatedAt".
+func AsIs(field string) string {
+	return field
+}
+
+// CamelCase converts the field name to lower camel case e.g., "createdAt".
+func CamelCase(field string) string {
+	ws := words(field)
+	if len(ws) == 0 {
+		return field
+	}
+	ws[0] = strings.ToLower(ws[0])
+	for i := 1; i < len(ws); i++ {
+		rs := []rune(ws[i])
+		rs[0] = unicode.ToUpper(rs[0])
+		ws[i] = string(rs)
+	}
+	return strings.Join(ws, "")
+}
+
+// SnakeCase converts the field name to snake case e.g., "created_at".
+func SnakeCase(field string) string {
+	ws := words(field)
+	for i, w := range ws {
+		ws[i] = strings.ToLower(w)
+	}
+	return strings.Join(ws, "_")
+}
+
+// words splits an identifier into words at case changes, treating a sequence
+// of upper case letters as acronym e.g., "HTTPServerID" as "HTTP", "Server",
+// "ID".
+func words(s string) (ws []string) {
+	rs := []rune(s)
+	start := 0
+	for i := 1; i < len(rs); i++ {
+		lowerToUpper := !unicode.IsUpper(rs[i-1]) && unicode.IsUpper(rs[i])
+		acronymEnd := unicode.IsUpper(rs[i-1]) && unicode.IsUpper(rs[i]) &&
+			i+1 < len(rs) && unicode.IsLower(rs[i+1])
+		if rs[i] == '_' {
+			if i > start {
+				ws = append(ws, string(rs[start:i]))
+			}
+			start = i + 1
+		} else if (lowerToUpper || acronymEnd) && i > start {
+			ws = append(ws, string(rs[start:i]))
+			start = i
+		}
+	}
+	if start < len(rs) {
+		ws = append(ws, string(rs[start:]))
+	}
+	return ws
+}
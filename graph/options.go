@@ -0,0 +1,69 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// WithPoolSize sets the maximum number of connections per server.
+// It is passed to NewConn to configure the driver.
+func WithPoolSize(n int) func(config *neo4j.Config) {
+	return func(config *neo4j.Config) {
+		config.MaxConnectionPoolSize = n
+	}
+}
+
+// WithAcquisitionTimeout sets the maximum time to wait for a connection from
+// the pool. If it elapses, the query fails with ErrPoolExhausted instead of
+// blocking. A timeout of 0 fails immediately, if no connection is available,
+// whereas a negative timeout waits indefinitely.
+// It is passed to NewConn to configure the driver.
+func WithAcquisitionTimeout(d time.Duration) func(config *neo4j.Config) {
+	return func(config *neo4j.Config) {
+		config.ConnectionAcquisitionTimeout = d
+	}
+}
+
+// WithSocketConfig sets the timeout for establishing TCP connections and
+// whether TCP keep-alive is enabled. It is passed to NewConn to configure the
+// driver.
+//
+// The driver dials connections itself and does not accept a custom dialer, so
+// proxies must be transparent to it e.g., a local TCP tunnel, whose address is
+// used in the URI. With TLS (+s schemes), the certificate is verified against
+// the host of the URI, which is the tunnel in that case; use +ssc schemes or a
+// certificate valid for the tunnel.
+func WithSocketConfig(connectTimeout time.Duration, keepAlive bool) func(config *neo4j.Config) {
+	return func(config *neo4j.Config) {
+		config.SocketConnectTimeout = connectTimeout
+		config.SocketKeepalive = keepAlive
+	}
+}
+
+// WithConnectionLifetime sets the maximum age of pooled connections. Older
+// connections are closed instead of being reused. This mitigates failures of
+// the first query after an idle period, if firewalls or load balancers drop
+// idle connections silently: choose a lifetime below their idle timeout.
+// The driver does not validate idle connections before reuse, so this is the
+// only way to avoid stale connections. It is passed to NewConn to configure
+// the driver.
+func WithConnectionLifetime(d time.Duration) func(config *neo4j.Config) {
+	return func(config *neo4j.Config) {
+		config.MaxConnectionLifetime = d
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otelgraph instruments Conns with OpenTelemetry. It creates a span
+// per query and records the duration of queries in a histogram.
+//
+//	inst, err := otelgraph.New(otelgraph.WithTracer(tp.Tracer("roland")),
+//		otelgraph.WithMeter(mp.Meter("roland")))
+//	conn.Instrumentation = inst
+package otelgraph
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/abc-inc/roland/graph"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+	"go.opentelemetry.io/otel/metric/unit"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// paramsKey holds the names of the parameters of a query. Their values
+	// are never recorded, since they may be sensitive.
+	paramsKey = attribute.Key("db.neo4j.params")
+	// recordsKey holds the number of Records received.
+	recordsKey = attribute.Key("db.neo4j.records")
+)
+
+// Option configures the Instrumentation.
+type Option func(*inst)
+
+// WithTracer creates a span for each query using the Tracer.
+func WithTracer(t trace.Tracer) Option {
+	return func(i *inst) {
+		i.tracer = t
+	}
+}
+
+// WithMeter records the duration of each query in the histogram
+// db.client.duration (in seconds) using the Meter.
+func WithMeter(m metric.Meter) Option {
+	return func(i *inst) {
+		i.meter = m
+	}
+}
+
+// inst implements graph.Instrumentation.
+type inst struct {
+	tracer trace.Tracer
+	meter  metric.Meter
+	hist   syncfloat64.Histogram
+}
+
+// New creates a new graph.Instrumentation. Without options, it does nothing.
+func New(opts ...Option) (graph.Instrumentation, error) {
+	i := &inst{}
+	for _, opt := range opts {
+		opt(i)
+	}
+	if i.meter != nil {
+		h, err := i.meter.SyncFloat64().Histogram("db.client.duration",
+			instrument.WithUnit(unit.Unit("s")),
+			instrument.WithDescription("Duration of Neo4j queries"))
+		if err != nil {
+			return nil, err
+		}
+		i.hist = h
+	}
+	return i, nil
+}
+
+// Start implements graph.Instrumentation. The query is recorded with string
+// literals redacted, and only the names of the parameters are recorded.
+func (i *inst) Start(ctx context.Context, db string, r graph.Request) func(int, neo4j.ResultSummary, error) {
+	names := make([]string, 0, len(r.Params))
+	for k := range r.Params {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemNeo4j,
+		semconv.DBNameKey.String(db),
+		semconv.DBStatementKey.String(graph.Redact(r.Query)),
+		paramsKey.StringSlice(names),
+	}
+
+	var span trace.Span
+	if i.tracer != nil {
+		ctx, span = i.tracer.Start(ctx, r.QueryName(),
+			trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	}
+	start := time.Now()
+
+	return func(records int, _ neo4j.ResultSummary, err error) {
+		if i.hist != nil {
+			i.hist.Record(ctx, time.Since(start).Seconds(), semconv.DBSystemNeo4j, semconv.DBNameKey.String(db))
+		}
+		if span == nil {
+			return
+		}
+		span.SetAttributes(recordsKey.Int(records))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// OutboxEvent is a message, which is stored as a node labeled "OutboxEvent"
+// in the same Transaction as the business data it relates to. A separate
+// relay publishes pending events and marks them as published afterwards.
+// Thus, a message is published if, and only if, the Transaction committed,
+// although it may be published more than once if the relay fails in between.
+type OutboxEvent struct {
+	ID        string    `neo4j:"id"`
+	Type      string    `neo4j:"type"`
+	Payload   string    `neo4j:"payload"`
+	CreatedAt time.Time `neo4j:"createdAt"`
+}
+
+// AddOutboxEvent creates an OutboxEvent of the given type with the payload
+// encoded as JSON in the given Transaction, and returns the ID of the event
+// e.g., within WriteTx or the current Transaction of a Conn:
+//
+//	_, err := graph.WriteTx(c, func(tx neo4j.Transaction) (any, error) {
+//		// business write
+//		return graph.AddOutboxEvent(tx, "OrderPlaced", order)
+//	})
+func AddOutboxEvent(tx neo4j.Transaction, typ string, payload any) (id string, err error) {
+	p, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	id = newTxID()
+	cyp := "CREATE (:OutboxEvent {id: $id, type: $type, payload: $payload, createdAt: datetime()})"
+	res, err := tx.Run(cyp, map[string]any{"id": id, "type": typ, "payload": string(p)})
+	if err == nil {
+		_, err = res.Consume()
+	}
+	if err != nil {
+		return "", wrapErr(cyp, err)
+	}
+	return id, nil
+}
+
+// PendingOutboxEvents returns up to limit OutboxEvents, which have not been
+// published yet, in the order they were created.
+func (c *Conn) PendingOutboxEvents(limit int) ([]OutboxEvent, error) {
+	r := Request{
+		Query: "MATCH (e:OutboxEvent) WHERE e.publishedAt IS NULL " +
+			"RETURN e.id AS id, e.type AS type, e.payload AS payload, e.createdAt AS createdAt " +
+			"ORDER BY e.createdAt LIMIT $limit",
+		Params: map[string]any{"limit": limit},
+	}
+	list, _, err := NewTemplate[OutboxEvent](c).Query(r, NewStructMapper[OutboxEvent]())
+	return list, err
+}
+
+// MarkOutboxPublished marks the OutboxEvents with the given IDs as published,
+// so that they are not returned by PendingOutboxEvents anymore.
+func (c *Conn) MarkOutboxPublished(ids ...string) error {
+	r := Request{
+		Query:  "MATCH (e:OutboxEvent) WHERE e.id IN $ids SET e.publishedAt = datetime()",
+		Params: map[string]any{"ids": ids},
+		Write:  true,
+	}
+	_, err := NewTemplate[any](c).execute(r, discard)
+	return err
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Pageable requests a page of a result. Page is zero-based.
+type Pageable struct {
+	Page int
+	Size int
+	Sort SortSpec
+}
+
+// Page is a page of a result, along with the total number of elements.
+type Page[T any] struct {
+	Content       []T   `json:"content" yaml:"content"`
+	Number        int   `json:"number" yaml:"number"`
+	Size          int   `json:"size" yaml:"size"`
+	TotalElements int64 `json:"totalElements" yaml:"totalElements"`
+	TotalPages    int   `json:"totalPages" yaml:"totalPages"`
+}
+
+// QueryPage executes the given Request for the requested page. The sort
+// criteria of the Pageable are appended as ORDER BY clause, followed by SKIP
+// and LIMIT, whose values are passed as parameters. Hence, the query must end
+// with a RETURN clause without ORDER BY, SKIP and LIMIT.
+//
+// The total number of elements is counted by running the query as subquery
+// i.e., CALL { query } RETURN count(*), in the same Transaction, so that the
+// count is consistent with the content. Unless the Conn has an active
+// Transaction, both queries are retried together according to the RetryPolicy.
+func (t Template[T]) QueryPage(r Request, p Pageable, m Mapper[T]) (page Page[T], err error) {
+	if p.Page < 0 || p.Size <= 0 {
+		return page, errors.New("page must not be negative and size must be positive")
+	}
+
+	cnt := r
+	cnt.Query = "CALL { " + r.Query + " } RETURN count(*)"
+	data := r.WithSort(p.Sort)
+	data.Query += " SKIP $__skip LIMIT $__limit"
+	data.Params = mergeParams(map[string]any{"__skip": int64(p.Page) * int64(p.Size), "__limit": int64(p.Size)}, r.Params)
+
+	err = t.conn.inTx(r, t.accessMode(r), func() error {
+		var total int64
+		_, err := t.execute(cnt, func(res neo4j.Result) error {
+			if t.conn.DryRun {
+				return nil
+			} else if !res.Next() {
+				return ErrEmpty
+			}
+			total, _ = res.Record().Values[0].(int64)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		list, _, err := t.Query(data, m)
+		if err != nil {
+			return err
+		}
+
+		page = Page[T]{Content: list, Number: p.Page, Size: p.Size, TotalElements: total,
+			TotalPages: int((total + int64(p.Size) - 1) / int64(p.Size))}
+		return nil
+	})
+	return page, err
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// DefaultWorkers is the number of Requests executed at the same time by
+// QueryConcurrent, if no positive number is given.
+const DefaultWorkers = 4
+
+// QueryConcurrent executes independent read Requests concurrently, using up to
+// the given number of workers, each of which opens its own read Sessions. The
+// results are returned in the order of the Requests. Since they run in
+// separate Transactions, the results need not be consistent with each other.
+// The current Transaction of the Conn, if any, is not used.
+//
+// All Requests are executed, even if some fail; the errors are joined, each
+// prefixed with the index of its Request, and the results of the failed
+// Requests are nil. When the context is done, running queries are stopped like
+// in QueryContext and pending Requests fail with the error of the context.
+func (t Template[T]) QueryConcurrent(ctx context.Context, rs []Request, m Mapper[T], workers int) ([][]T, error) {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	t.mode = neo4j.AccessModeRead
+
+	res := make([][]T, len(rs))
+	errs := make([]error, len(rs))
+	idxs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(rs)); w++ {
+		wg.Add(1)
+		// A Conn holds the Transaction of the running query, so each worker
+		// needs a Conn of its own.
+		wt := t
+		wt.conn = t.conn.Clone()
+		go func() {
+			defer wg.Done()
+			for i := range idxs {
+				if errs[i] = ctx.Err(); errs[i] == nil {
+					res[i], _, errs[i] = wt.QueryContext(ctx, rs[i], m)
+				}
+			}
+		}()
+	}
+	for i := range rs {
+		idxs <- i
+	}
+	close(idxs)
+	wg.Wait()
+
+	var failed []error
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Errorf("request %d: %w", i, err))
+		}
+	}
+	return res, joinErrs(failed)
+}
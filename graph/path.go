@@ -0,0 +1,61 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Step is a single hop along a Path. From and To follow the traversal order of
+// the Path, regardless of the direction of the Relationship.
+type Step struct {
+	From neo4j.Node
+	Rel  neo4j.Relationship
+	To   neo4j.Node
+	// Forward is true if the Relationship points from From to To, and false if
+	// it was traversed against its direction i.e., its StartId equals To.Id.
+	Forward bool
+}
+
+// Steps splits the Path into its hops in traversal order. In contrast to the
+// Relationships of the Path, whose StartId and EndId reflect the direction
+// stored in the database, each Step normalizes the endpoints to from→to.
+func Steps(p neo4j.Path) []Step {
+	steps := make([]Step, len(p.Relationships))
+	for i, r := range p.Relationships {
+		from, to := p.Nodes[i], p.Nodes[i+1]
+		steps[i] = Step{From: from, Rel: r, To: to, Forward: r.StartId == from.Id}
+	}
+	return steps
+}
+
+// NewPathMapper creates a new Mapper that converts the Path in the column with
+// the given key into Steps. If the column is missing or does not contain a
+// Path, a MappingError is raised.
+func NewPathMapper(key string) Mapper[[]Step] {
+	return func(rec *neo4j.Record) []Step {
+		v, ok := rec.Get(key)
+		if !ok {
+			panic(&MappingError{Key: key, Err: errNoColumn})
+		}
+		p, ok := v.(neo4j.Path)
+		if !ok {
+			panic(&MappingError{Key: key, Err: fmt.Errorf("expected a path, got %T", v)})
+		}
+		return Steps(p)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// warnCartesian plans the query using EXPLAIN in the given Transaction and
+// logs a warning, if the plan contains a CartesianProduct operator. Errors
+// are ignored, because they are reported when the query is executed.
+func (c *Conn) warnCartesian(tx neo4j.Transaction, r Request, params map[string]any) {
+	if !c.CheckCartesian || c.Logger == nil || c.DryRun {
+		return
+	}
+	params, err := EncryptParams(params)
+	if err != nil {
+		return
+	}
+	res, err := tx.Run("EXPLAIN "+r.Query, params)
+	if err != nil {
+		return
+	}
+	sum, err := res.Consume()
+	if err != nil || sum.Plan() == nil {
+		return
+	}
+	if hasOperator(sum.Plan(), "CartesianProduct") {
+		c.Logger.Warnf("cartesian product in query %s: %s", r.QueryName(), Redact(r.Query))
+	}
+}
+
+// hasOperator returns whether the plan or any of its children uses the
+// operator. Suffixes denoting the runtime e.g., "@neo4j", are ignored.
+func hasOperator(p neo4j.Plan, op string) bool {
+	if name, _, _ := strings.Cut(p.Operator(), "@"); name == op {
+		return true
+	}
+	for _, ch := range p.Children() {
+		if hasOperator(ch, op) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CallProcedure creates a Request, which calls the procedure with the given
+// arguments and yields the given columns e.g.,
+//
+//	CallProcedure("gds.pageRank.stream", []any{"g"}, "nodeId", "score")
+//
+// results in "CALL `gds`.`pageRank`.`stream`($p0) YIELD `nodeId`, `score`".
+// The arguments are passed as parameters and the yielded columns are declared
+// as the Keys of the Request. If no columns are given, all columns are yielded.
+// A column can be renamed with "AS" e.g., "nodeId AS id", in which case the
+// alias is the key. Combined with NewStructMapper, each row can be mapped to a
+// struct.
+//
+// Procedures, whose names indicate that they write e.g., "gds.pageRank.write"
+// or "apoc.create.node", are executed in a write Transaction. Other procedures
+// use the access mode of the Template, unless Write is set explicitly.
+func CallProcedure(name string, args []any, yields ...string) Request {
+	sb := strings.Builder{}
+	sb.WriteString("CALL ")
+	for i, n := range strings.Split(name, ".") {
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(Quote(n))
+	}
+
+	params := make(map[string]any, len(args))
+	sb.WriteByte('(')
+	for i, a := range args {
+		p := "p" + strconv.Itoa(i)
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("$" + p)
+		params[p] = a
+	}
+	sb.WriteByte(')')
+
+	keys := make([]string, len(yields))
+	for i, y := range yields {
+		if i == 0 {
+			sb.WriteString(" YIELD ")
+		} else {
+			sb.WriteString(", ")
+		}
+		col, alias, ok := cutAlias(y)
+		sb.WriteString(Quote(col))
+		if ok {
+			sb.WriteString(" AS " + Quote(alias))
+			col = alias
+		}
+		keys[i] = col
+	}
+
+	r := Request{Query: sb.String(), Params: params, Keys: keys}
+	r.Write = writeProcedure.MatchString("CALL " + name)
+	return r
+}
+
+// Call calls the procedure like CallProcedure and maps each row to a struct
+// of type T using NewStructMapper.
+func (t Template[T]) Call(name string, args []any, yields ...string) ([]T, error) {
+	list, _, err := t.Query(CallProcedure(name, args, yields...), NewStructMapper[T]())
+	return list, err
+}
+
+// cutAlias splits "column AS alias" into its parts.
+func cutAlias(yield string) (col, alias string, ok bool) {
+	fs := strings.Fields(yield)
+	if len(fs) == 3 && strings.EqualFold(fs[1], "AS") {
+		return fs[0], fs[2], true
+	}
+	return yield, "", false
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// ErrNoTransaction is returned by WithinTxPropagation with Mandatory, if the
+// Conn has no active Transaction.
+var ErrNoTransaction = errors.New("no active transaction")
+
+// ErrRollbackOnly is returned by WithinTx and Commit, if the work succeeded,
+// but the Transaction was rolled back, because nested work, which joined it,
+// failed.
+var ErrRollbackOnly = errors.New("transaction rolled back, because it was marked as rollback-only")
+
+// Propagation decides whether WithinTxPropagation joins the current
+// Transaction of the Conn or begins a new one.
+type Propagation int
+
+const (
+	// Required joins the current Transaction, or begins a new one, if there
+	// is none.
+	Required Propagation = iota
+	// RequiresNew always begins a new Transaction in a Session of its own,
+	// which is committed independently of the current one. Since the current
+	// Transaction is still active, the work must not modify the same nodes:
+	// the new Transaction would wait for locks held by the current one, until
+	// it times out.
+	RequiresNew
+	// Mandatory joins the current Transaction and fails with ErrNoTransaction,
+	// if there is none.
+	Mandatory
+	// Supports joins the current Transaction, if any, and executes the work
+	// without a Transaction otherwise i.e., each query in a Transaction of
+	// its own.
+	Supports
+)
+
+// WithinTx executes the work in a Transaction with the propagation Required.
+// See WithinTxPropagation.
+func (c *Conn) WithinTx(ctx context.Context, work func(tx *Conn) error) error {
+	return c.WithinTxPropagation(ctx, Required, work)
+}
+
+// WithinTxPropagation executes the work in a Transaction according to the
+// Propagation. The work receives the Conn to use for its queries e.g., for
+// NewTemplate or NewRepository, and for nested calls of WithinTx, so that
+// service methods compose: the outermost call, which began the Transaction,
+// commits it, if the work succeeds, and rolls it back, if the work fails or
+// panics. The panic is propagated. A new Transaction is begun in a copy of c,
+// so c remains unchanged, and times out, when the deadline of the context
+// expires.
+//
+// Neo4j does not support savepoints. Hence, if nested work, which joined the
+// Transaction, fails or panics, the Transaction is marked as rollback-only:
+// it is rolled back at the end, even if the outer work handles the error, and
+// WithinTx returns ErrRollbackOnly instead of committing partial changes.
+func (c *Conn) WithinTxPropagation(ctx context.Context, p Propagation, work func(tx *Conn) error) (err error) {
+	switch {
+	case c.Tx != nil && p != RequiresNew:
+		return c.joinTx(work)
+	case p == Mandatory:
+		return ErrNoTransaction
+	case p == Supports:
+		return work(c)
+	}
+
+	tx := c.derive()
+	if _, _, err = tx.GetTransactionContext(ctx, neo4j.AccessModeWrite); err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			_, _ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err = work(tx); err != nil {
+		_, _ = tx.Rollback()
+		return err
+	}
+	_, err = tx.CommitContext(ctx)
+	return err
+}
+
+// joinTx executes the work in the current Transaction, which is marked as
+// rollback-only, if the work fails or panics.
+func (c *Conn) joinTx(work func(tx *Conn) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.rollbackOnly = true
+			panic(r)
+		}
+	}()
+	if err = work(c); err != nil {
+		c.rollbackOnly = true
+	}
+	return err
+}
@@ -0,0 +1,153 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"google.golang.org/protobuf/proto"
+)
+
+// protoField describes a field of a generated protobuf message struct.
+type protoField struct {
+	name  string
+	json  string
+	index []int
+}
+
+// protoFields returns the fields of a generated protobuf message struct, which
+// are identified by their "protobuf" tag. Fields of oneofs are not included.
+func protoFields(typ reflect.Type) (fs []protoField) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag, ok := f.Tag.Lookup("protobuf")
+		if !ok || !f.IsExported() {
+			continue
+		}
+		pf := protoField{index: f.Index}
+		for _, opt := range strings.Split(tag, ",") {
+			if k, v, ok := strings.Cut(opt, "="); ok && k == "name" {
+				pf.name = v
+			} else if ok && k == "json" {
+				pf.json = v
+			}
+		}
+		if pf.json == "" {
+			pf.json = pf.name
+		}
+		fs = append(fs, pf)
+	}
+	return fs
+}
+
+// isProto returns whether typ is a pointer to a generated protobuf message
+// struct.
+func isProto(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Pointer || typ.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	_, ok := typ.Elem().FieldByName("state")
+	return ok || len(protoFields(typ.Elem())) > 0
+}
+
+// ProtoMapper creates a new Mapper that populates a generated protobuf
+// message from each Record. T is the pointer type of the message e.g.,
+// *pb.User. The columns are matched by the proto field name or its JSON name
+// e.g., user_id or userId.
+//
+// Values are converted like in NewStructMapper. Additionally, temporal values
+// are assigned to google.protobuf.Timestamp fields, and Nodes, Relationships
+// and maps are assigned to nested messages. Enums are assigned from integers.
+// Only the fields of generated message structs are populated, hence, dynamic
+// messages remain empty.
+func ProtoMapper[T proto.Message]() Mapper[T] {
+	typ := reflect.TypeOf(new(T)).Elem()
+	fs := protoFields(typ.Elem())
+	return func(rec *neo4j.Record) T {
+		v := reflect.New(typ.Elem())
+		if err := decodeProto(rec.Get, v.Elem(), fs); err != nil {
+			panic(err)
+		}
+		return v.Interface().(T)
+	}
+}
+
+// decodeProto assigns the values returned by get to the fields of message v.
+func decodeProto(get func(key string) (any, bool), v reflect.Value, fs []protoField) error {
+	for _, f := range fs {
+		val, ok := get(f.name)
+		if !ok {
+			val, ok = get(f.json)
+		}
+		if !ok {
+			continue
+		}
+		if err := setProtoValue(v.FieldByIndex(f.index), val); err != nil {
+			return &MappingError{Key: f.name, Err: err}
+		}
+	}
+	return nil
+}
+
+// setProtoValue assigns val to the message field dst.
+func setProtoValue(dst reflect.Value, val any) error {
+	if val == nil || !isProto(dst.Type()) {
+		return Decoder{}.setValue(dst, val)
+	}
+
+	msg := reflect.New(dst.Type().Elem())
+	if t, ok := protoTime(val); ok && isTimestamp(dst.Type()) {
+		msg.Elem().FieldByName("Seconds").SetInt(t.Unix())
+		msg.Elem().FieldByName("Nanos").SetInt(int64(t.Nanosecond()))
+	} else if isEntity(val) {
+		props := entityProps(val)
+		get := func(key string) (any, bool) {
+			v, ok := props[key]
+			return v, ok
+		}
+		if err := decodeProto(get, msg.Elem(), protoFields(dst.Type().Elem())); err != nil {
+			return err
+		}
+	} else {
+		return &ConversionError{Value: val, Type: dst.Type()}
+	}
+	dst.Set(msg)
+	return nil
+}
+
+// isTimestamp returns whether typ is a pointer to a message struct with the
+// fields of google.protobuf.Timestamp.
+func isTimestamp(typ reflect.Type) bool {
+	s, ok := typ.Elem().FieldByName("Seconds")
+	n, ok2 := typ.Elem().FieldByName("Nanos")
+	return ok && ok2 && s.Type.Kind() == reflect.Int64 && n.Type.Kind() == reflect.Int32
+}
+
+// protoTime returns the instant of a temporal value. Local date times are
+// interpreted in UTC.
+func protoTime(val any) (time.Time, bool) {
+	switch v := val.(type) {
+	case time.Time:
+		return v, true
+	case neo4j.LocalDateTime:
+		return v.Time(), true
+	case neo4j.Date:
+		return v.Time(), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package queries loads named Cypher queries from files, so that they need
+// not be embedded in Go string literals.
+//
+// Each file with the extension .cypher contains one or more queries, each of
+// which is preceded by a line naming it:
+//
+//	-- name: findUserByEmail
+//	MATCH (u:User {email: $email}) RETURN u
+//
+// The prefix "//" may be used instead of "--". Queries are typically embedded
+// with embed.FS and validated at startup i.e., before they are needed:
+//
+//	//go:embed cypher
+//	var files embed.FS
+//
+//	reg, err := queries.Load(files)
+//	err = reg.Validate("findUserByEmail", "deleteUser")
+package queries
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/abc-inc/roland/graph"
+)
+
+// ErrUnknownQuery indicates that there is no query with a certain name.
+var ErrUnknownQuery = errors.New("unknown query")
+
+// header matches the line, which names a query.
+var header = regexp.MustCompile(`^\s*(?:--|//)\s*name:\s*(\S+)\s*$`)
+
+// Registry holds named queries.
+type Registry struct {
+	queries map[string]string
+	files   map[string]string
+}
+
+// Load reads all .cypher files of the file system recursively. A name must
+// be unique across all files.
+func Load(fsys fs.FS) (*Registry, error) {
+	reg := &Registry{queries: make(map[string]string), files: make(map[string]string)}
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != ".cypher" {
+			return err
+		}
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		return reg.parse(p, string(b))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+// parse adds the queries of a file.
+func (reg *Registry) parse(file, content string) error {
+	name, n := "", 0
+	var sb strings.Builder
+	add := func() error {
+		q := strings.TrimSuffix(strings.TrimSpace(sb.String()), ";")
+		if name == "" {
+			if q != "" {
+				return fmt.Errorf("%s:%d: query without name", file, n)
+			}
+			return nil
+		} else if q == "" {
+			return fmt.Errorf("%s: query %q is empty", file, name)
+		} else if other, ok := reg.files[name]; ok {
+			return fmt.Errorf("%s: query %q is already defined in %s", file, name, other)
+		}
+		reg.queries[name], reg.files[name] = strings.TrimSpace(q), file
+		sb.Reset()
+		return nil
+	}
+
+	sc := bufio.NewScanner(strings.NewReader(content))
+	for sc.Scan() {
+		n++
+		line := sc.Text()
+		if m := header.FindStringSubmatch(line); m != nil {
+			if err := add(); err != nil {
+				return err
+			}
+			name = m[1]
+			continue
+		} else if name == "" && strings.HasPrefix(strings.TrimSpace(line), "//") {
+			continue
+		}
+		sb.WriteString(line + "\n")
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return add()
+}
+
+// Names returns the names of all queries in ascending order.
+func (reg *Registry) Names() []string {
+	ns := make([]string, 0, len(reg.queries))
+	for n := range reg.queries {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	return ns
+}
+
+// Query returns the query with the given name.
+func (reg *Registry) Query(name string) (string, bool) {
+	q, ok := reg.queries[name]
+	return q, ok
+}
+
+// Request returns a Request for the query with the given name and the
+// parameters. The Name of the Request is the name of the query, which
+// identifies it in log messages. If there is no such query, ErrUnknownQuery
+// is returned.
+func (reg *Registry) Request(name string, params map[string]any) (graph.Request, error) {
+	q, ok := reg.queries[name]
+	if !ok {
+		return graph.Request{}, fmt.Errorf("%w: %q", ErrUnknownQuery, name)
+	}
+	return graph.Request{Query: q, Params: params, Name: name}, nil
+}
+
+// MustRequest is like Request, but panics if there is no such query. It is
+// meant for names, which were checked by Validate.
+func (reg *Registry) MustRequest(name string, params map[string]any) graph.Request {
+	r, err := reg.Request(name, params)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Validate returns ErrUnknownQuery, listing all names, for which there is no
+// query.
+func (reg *Registry) Validate(names ...string) error {
+	var missing []string
+	for _, n := range names {
+		if _, ok := reg.queries[n]; !ok {
+			missing = append(missing, n)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownQuery, strings.Join(missing, ", "))
+	}
+	return nil
+}
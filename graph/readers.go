@@ -0,0 +1,115 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Read returns a copy of the Template, which executes queries in read
+// Transactions e.g., to route them to read replicas in a cluster. It is a
+// shorthand for WithAccessMode(neo4j.AccessModeRead).
+func (t Template[T]) Read() *Template[T] {
+	return t.WithAccessMode(neo4j.AccessModeRead)
+}
+
+// Write returns a copy of the Template, which executes queries in write
+// Transactions. This is the default.
+func (t Template[T]) Write() *Template[T] {
+	return t.WithAccessMode(neo4j.AccessModeWrite)
+}
+
+// ReaderPolicy selects one of several readers for a read Session.
+type ReaderPolicy int
+
+const (
+	// RoundRobin selects the readers in turn.
+	RoundRobin ReaderPolicy = iota
+	// LeastPending selects the reader with the fewest open Sessions.
+	LeastPending
+)
+
+// readers are the drivers of the reader URIs of a Conn and the number of
+// their open Sessions.
+type readers struct {
+	policy  ReaderPolicy
+	drivers []neo4j.Driver
+	pending []int64
+	next    atomic.Uint64
+}
+
+// pick returns the index of the reader for the next Session.
+func (rs *readers) pick() int {
+	if rs.policy == LeastPending {
+		best := 0
+		for i := range rs.pending {
+			if atomic.LoadInt64(&rs.pending[i]) < atomic.LoadInt64(&rs.pending[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	return int((rs.next.Add(1) - 1) % uint64(len(rs.drivers)))
+}
+
+// session creates a new Session on the selected reader.
+func (rs *readers) session(cfg neo4j.SessionConfig) neo4j.Session {
+	i := rs.pick()
+	atomic.AddInt64(&rs.pending[i], 1)
+	return &countingSession{Session: rs.drivers[i].NewSession(cfg), fn: func() { atomic.AddInt64(&rs.pending[i], -1) }}
+}
+
+// close closes the drivers of all readers.
+func (rs *readers) close() error {
+	var errs []error
+	for _, d := range rs.drivers {
+		if err := d.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrs(errs)
+}
+
+// WithReaders returns a Conn, which opens read Sessions on the servers with
+// the given URIs e.g., the read replicas of a self-managed cluster, which is
+// accessed via bolt:// URIs without routing. The policy selects the server
+// for each Session. Write Sessions are still opened on the driver of c. For
+// neo4j:// URIs, the driver routes read Sessions by itself.
+//
+// The returned Conn shares the driver of c like Conns derived by WithDatabase.
+// Closing it closes the drivers of the readers as well as the driver of c, so
+// it should be closed instead of c. If a reader cannot be created, the others
+// are closed again.
+func (c *Conn) WithReaders(policy ReaderPolicy, uris ...string) (*Conn, error) {
+	if len(uris) == 0 {
+		return nil, errors.New("at least one reader URI is required")
+	}
+	rs := &readers{policy: policy, pending: make([]int64, len(uris))}
+	for _, u := range uris {
+		d, err := neo4j.NewDriver(u, c.auth, c.opts...)
+		if err != nil {
+			_ = rs.close()
+			return nil, err
+		}
+		rs.drivers = append(rs.drivers, d)
+	}
+
+	conn := c.derive()
+	conn.readers = rs
+	return conn, nil
+}
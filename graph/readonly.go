@@ -0,0 +1,49 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ErrReadOnly indicates that a query was rejected, because it might modify
+// data, but the Conn is in read-only mode.
+var ErrReadOnly = errors.New("read-only mode")
+
+var (
+	// writeClause matches clauses, which modify data or the schema.
+	writeClause = regexp.MustCompile(`(?i)\b(CREATE|MERGE|SET|DELETE|REMOVE|DROP|FOREACH|LOAD\s+CSV|TERMINATE)\b`)
+	// writeProcedure matches calls of procedures, which are known to write.
+	writeProcedure = regexp.MustCompile(`(?i)\bCALL\s+[\w.]*\.(create|merge|delete|refactor|write|mutate|set|remove|drop|kill|periodic)\w*\b`)
+	// identifier matches quoted identifiers, which may contain keywords.
+	identifier = regexp.MustCompile("`[^`]*`")
+)
+
+// checkReadOnly returns ErrReadOnly, if the Conn is in read-only mode and the
+// query contains a write clause or calls a procedure, which writes.
+func (c *Conn) checkReadOnly(query string) error {
+	if !c.ReadOnly {
+		return nil
+	}
+	q := identifier.ReplaceAllString(Redact(query), "``")
+	if m := writeClause.FindString(q); m != "" {
+		return wrapErr(query, fmt.Errorf("%w: %s is not allowed", ErrReadOnly, m))
+	} else if m := writeProcedure.FindString(q); m != "" {
+		return wrapErr(query, fmt.Errorf("%w: %s is not allowed", ErrReadOnly, m))
+	}
+	return nil
+}
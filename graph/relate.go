@@ -0,0 +1,257 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// NodeKey identifies a node by its label and the value of a key property.
+type NodeKey struct {
+	Label string
+	Key   string
+	Value any
+}
+
+// RelateRow describes a relationship between two nodes, which are identified
+// by their NodeKeys.
+type RelateRow struct {
+	From  NodeKey
+	To    NodeKey
+	Props map[string]any
+}
+
+// relateGroup is the combination of labels and keys, which can be processed
+// by a single statement.
+type relateGroup struct {
+	fromLabel, fromKey string
+	toLabel, toKey     string
+}
+
+// RelateBatch merges relationships of the given type between the nodes
+// described by each row. Rows are grouped by labels and keys and written in
+// chunks of BatchSize rows using UNWIND. The Counters of all statements are
+// aggregated. Rows, of which at least one endpoint could not be found, are
+// returned so that the caller can reconcile them.
+//
+// Depending on the BatchMode of the Conn, the first failing chunk aborts the
+// whole operation, or failing rows are reported in a BatchError after all
+// other rows have been written. The latter is not possible within an explicit
+// Transaction, because a failed statement invalidates the Transaction. When
+// aborting, nothing is written, because all chunks are written in a single
+// Transaction, which is rolled back as a whole.
+func (c *Conn) RelateBatch(rows []RelateRow, relType string) (
+	cnt Counters, missing []RelateRow, err error) {
+
+	if relType == "" {
+		return cnt, nil, errors.New("relationship type must not be empty")
+	}
+
+	var groups []relateGroup
+	idxs := make(map[relateGroup][]int)
+	for i, row := range rows {
+		g := relateGroup{row.From.Label, row.From.Key, row.To.Label, row.To.Key}
+		if _, ok := idxs[g]; !ok {
+			groups = append(groups, g)
+		}
+		idxs[g] = append(idxs[g], i)
+	}
+
+	mode := c.BatchMode
+	if c.Tx != nil {
+		mode = FailFast
+	}
+
+	var errs BatchError
+	write := func() error {
+		cnt, missing, errs = Counters{}, nil, nil
+		for _, g := range groups {
+			cyp := relateQuery(g, relType)
+			err := runBatch(idxs[g], c.batchSize(), mode, func(chunk []int) error {
+				params := make([]any, len(chunk))
+				for j, i := range chunk {
+					props := rows[i].Props
+					if props == nil {
+						props = map[string]any{}
+					}
+					params[j] = map[string]any{
+						"idx":   int64(i),
+						"from":  rows[i].From.Value,
+						"to":    rows[i].To.Value,
+						"props": props,
+					}
+				}
+
+				r := Request{Query: cyp, Params: map[string]any{"rows": params}}
+				found, sum, err := NewTemplate[int64](c).Query(r, NewSingleValueMapper[int64](0))
+				if err != nil {
+					return err
+				}
+				cnt.Add(sum)
+
+				ok := make(map[int64]bool, len(found))
+				for _, i := range found {
+					ok[i] = true
+				}
+				for _, i := range chunk {
+					if !ok[int64(i)] {
+						missing = append(missing, rows[i])
+					}
+				}
+				return nil
+			})
+
+			var berr BatchError
+			if errors.As(err, &berr) {
+				errs = append(errs, berr...)
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if mode != FailFast {
+		err = write()
+	} else if len(groups) > 0 {
+		// All chunks are written in one Transaction, which is rolled back as a
+		// whole, if a chunk fails.
+		if err = c.inTx(Request{Query: relateQuery(groups[0], relType), Write: true},
+			neo4j.AccessModeWrite, write); err != nil {
+			return Counters{}, nil, err
+		}
+	}
+	if err != nil {
+		return cnt, missing, err
+	} else if len(errs) > 0 {
+		return cnt, missing, errs
+	}
+	return cnt, missing, nil
+}
+
+// relateQuery returns the statement, which merges the relationships of the
+// rows of the group.
+func relateQuery(g relateGroup, relType string) string {
+	return fmt.Sprintf("UNWIND $rows AS row "+
+		"MATCH (a:%s {%s: row.from}) "+
+		"MATCH (b:%s {%s: row.to}) "+
+		"MERGE (a)-[r:%s]->(b) "+
+		"SET r += row.props "+
+		"RETURN DISTINCT row.idx",
+		Quote(g.fromLabel), Quote(g.fromKey), Quote(g.toLabel), Quote(g.toKey), Quote(relType))
+}
+
+// RelateByID merges a relationship of the given type between the nodes with
+// the given IDs and sets its properties. Matching by ID avoids a lookup by key
+// if the IDs were obtained by a previous query. Integer IDs are matched with
+// id(), and string IDs are element IDs, which are matched with elementId()
+// (Neo4j 5 or later). If either node does not exist, ErrEmpty is returned.
+func (c *Conn) RelateByID(fromID, toID any, relType string, props map[string]any) (
+	cnt Counters, err error) {
+
+	if relType == "" {
+		return cnt, errors.New("relationship type must not be empty")
+	}
+	if props == nil {
+		props = map[string]any{}
+	}
+	fromFn, fromID, err := idFunc(fromID)
+	if err != nil {
+		return cnt, err
+	}
+	toFn, toID, err := idFunc(toID)
+	if err != nil {
+		return cnt, err
+	}
+
+	cyp := fmt.Sprintf("MATCH (a) WHERE %s(a) = $from "+
+		"MATCH (b) WHERE %s(b) = $to "+
+		"MERGE (a)-[r:%s]->(b) SET r += $props RETURN id(r)", fromFn, toFn, Quote(relType))
+	params := map[string]any{"from": fromID, "to": toID, "props": props}
+
+	found := false
+	sum, err := NewTemplate[any](c).execute(Request{Query: cyp, Params: params, Write: true},
+		func(res neo4j.Result) error {
+			found = res.Next()
+			return nil
+		})
+	if err != nil {
+		return cnt, err
+	} else if !found {
+		return cnt, ErrEmpty
+	}
+	cnt.Add(sum)
+	return cnt, nil
+}
+
+// idFunc returns the function, which returns the ID of a node of the given
+// type, and the ID converted to the type of its parameter.
+func idFunc(id any) (string, any, error) {
+	switch v := id.(type) {
+	case string:
+		return "elementId", v, nil
+	case int:
+		return "id", int64(v), nil
+	case int32:
+		return "id", int64(v), nil
+	case int64:
+		return "id", v, nil
+	}
+	return "", nil, fmt.Errorf("unsupported ID type %T: expected an integer or an element ID", id)
+}
+
+// RelateUpsert merges a relationship of the given type between the nodes
+// identified by from and to. The onCreate properties are only set if the
+// relationship is created, whereas the onMatch properties are set every time,
+// including creation e.g., firstSeen and lastSeen timestamps, respectively.
+// If either node does not exist, ErrEmpty is returned.
+func (c *Conn) RelateUpsert(from, to NodeKey, relType string, onCreate, onMatch map[string]any) (
+	cnt Counters, err error) {
+
+	if relType == "" {
+		return cnt, errors.New("relationship type must not be empty")
+	}
+	if onCreate == nil {
+		onCreate = map[string]any{}
+	}
+	if onMatch == nil {
+		onMatch = map[string]any{}
+	}
+
+	cyp := fmt.Sprintf("MATCH (a:%s {%s: $from}) "+
+		"MATCH (b:%s {%s: $to}) "+
+		"MERGE (a)-[r:%s]->(b) "+
+		"ON CREATE SET r += $onCreate, r += $onMatch "+
+		"ON MATCH SET r += $onMatch "+
+		"RETURN id(r)",
+		Quote(from.Label), Quote(from.Key), Quote(to.Label), Quote(to.Key), Quote(relType))
+	params := map[string]any{"from": from.Value, "to": to.Value, "onCreate": onCreate, "onMatch": onMatch}
+
+	found := false
+	sum, err := NewTemplate[any](c).execute(Request{Query: cyp, Params: params, Write: true},
+		func(res neo4j.Result) error {
+			found = res.Next()
+			return nil
+		})
+	if err != nil {
+		return cnt, err
+	} else if !found {
+		return cnt, ErrEmpty
+	}
+	cnt.Add(sum)
+	return cnt, nil
+}
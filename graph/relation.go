@@ -0,0 +1,94 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// relation describes a field holding related entities, which is tagged with
+// the relationship type and optionally its direction e.g.,
+// `neo4j:"rel=OWNS,direction=outgoing"`. The direction is "outgoing" (the
+// default), "incoming" or "both". The field is either a slice of structs or
+// pointers to structs, or a single struct or pointer to a struct.
+type relation struct {
+	typ  string
+	dir  string
+	elem reflect.Type
+	many bool
+}
+
+// parseRel returns the relation described by the options of a field, or nil
+// if the field is not a relationship field.
+func parseRel(opts []string, typ reflect.Type) *relation {
+	rel := &relation{typ: optValue(opts, "rel"), dir: optValue(opts, "direction")}
+	if rel.dir == "" {
+		rel.dir = "outgoing"
+	}
+	if rel.typ == "" || rel.dir != "outgoing" && rel.dir != "incoming" && rel.dir != "both" {
+		return nil
+	}
+
+	if typ.Kind() == reflect.Slice {
+		rel.many, typ = true, typ.Elem()
+	}
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+	rel.elem = typ
+	return rel
+}
+
+// pattern returns the pattern of the relationship from a to b.
+func (r relation) pattern(a, b string) string {
+	t := "[:" + Quote(r.typ) + "]"
+	switch r.dir {
+	case "incoming":
+		return "(" + a + ")<-" + t + "-(" + b + ")"
+	case "both":
+		return "(" + a + ")-" + t + "-(" + b + ")"
+	}
+	return "(" + a + ")-" + t + "->(" + b + ")"
+}
+
+// projection returns a map projection of the node bound to the variable v,
+// which contains all properties, the internal ID for the id field and the
+// related entities for relationship fields of the struct type. Related
+// entities are collected by pattern comprehensions up to the given depth; at
+// depth 0, relationship fields are not populated. The labels of related
+// entities are derived using the NamingStrategy.
+func projection(v string, typ reflect.Type, depth int, naming NamingStrategy) string {
+	items := []string{".*"}
+	for i, f := range fields(typ) {
+		switch {
+		case f.id:
+			items = append(items, Quote(f.name)+": id("+v+")")
+		case f.rel != nil && depth > 0:
+			m := v + "_" + strconv.Itoa(i)
+			c := "[" + f.rel.pattern(v, m+":"+labelExpr(typeLabels(f.rel.elem, naming))) + " | " +
+				projection(m, f.rel.elem, depth-1, naming) + "]"
+			if !f.rel.many {
+				c = "head(" + c + ")"
+			}
+			items = append(items, Quote(f.name)+": "+c)
+		}
+	}
+	return v + " {" + strings.Join(items, ", ") + "}"
+}
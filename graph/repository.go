@@ -0,0 +1,551 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Repository provides CRUD operations for entities of type T, which are
+// stored as nodes with the label of the underlying Template. The properties
+// are derived from the fields of T like in Template.Update, and nodes are
+// identified by their internal IDs. A field of type int64 tagged
+// `neo4j:",id"` receives the internal ID.
+//
+// Fields tagged with a relationship type e.g.,
+// `neo4j:"rel=OWNS,direction=outgoing"`, hold related entities, whose label
+// is derived from their type. They are populated by FindByID and FindAll up
+// to the fetch depth (1 by default), and written by Save up to the cascade
+// depth (0 by default).
+//
+// If T has a field with the "softDelete" option e.g.,
+// `neo4j:"deletedAt,softDelete"`, DeleteByID marks nodes as deleted like
+// Template.SoftDeleteByID instead of removing them. The property of the field
+// replaces DeletedAt for the Template and the Repository alike, hence, the
+// finders exclude such nodes, unless the Repository is Unscoped. Save and
+// Merge keep the mark, even with WriteAll.
+//
+// After writing, the results of Template.CachedQuery for the labels of the
+// written nodes are removed from the ResultCache of the Conn. Within an
+// explicit Transaction, this happens before it is committed.
+//
+// Entities implementing BeforeSaver, AfterLoader or BeforeDeleter are passed
+// to their hooks, and audit fields e.g., `neo4j:"createdAt,audit=created"`,
+// are populated when writing them (see AuditCreated).
+type Repository[T any] struct {
+	t       *Template[T]
+	fetch   int
+	cascade int
+	ctx     context.Context
+	tenant  string
+}
+
+// NewRepository creates a new Repository with the given connection.
+func NewRepository[T any](conn *Conn) *Repository[T] {
+	return &Repository[T]{t: NewTemplate[T](conn), fetch: 1}
+}
+
+// NewRepositoryWith creates a new Repository, which uses the given Template
+// e.g., to apply its scope or NullPolicy.
+func NewRepositoryWith[T any](t *Template[T]) *Repository[T] {
+	return &Repository[T]{t: t, fetch: 1}
+}
+
+// Template returns the Template used by the Repository.
+func (r *Repository[T]) Template() *Template[T] {
+	return r.t
+}
+
+// WithFetchDepth returns a copy of the Repository, which populates
+// relationship fields up to the given depth e.g., 2 loads the related
+// entities of related entities. A depth of 0 disables it.
+func (r Repository[T]) WithFetchDepth(depth int) *Repository[T] {
+	r.fetch = depth
+	return &r
+}
+
+// WithCascade returns a copy of the Repository, whose Save also saves the
+// entities in relationship fields up to the given depth and merges the
+// relationships to them.
+func (r Repository[T]) WithCascade(depth int) *Repository[T] {
+	r.cascade = depth
+	return &r
+}
+
+// WithContext returns a copy of the Repository, which passes the given
+// context to the hooks of the entities and takes the Principal from it. If
+// the Conn has a Tenancy, the Repository is restricted to the Tenant of the
+// context.
+func (r Repository[T]) WithContext(ctx context.Context) *Repository[T] {
+	r.ctx = ctx
+	if tn := r.t.conn.Tenancy; tn != nil && Tenant(ctx) != "" {
+		r.applyTenant(tn, Tenant(ctx))
+	}
+	return &r
+}
+
+// context returns the context of the Repository or the background context.
+func (r *Repository[T]) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// Create creates a new node for the entity and returns its ID.
+func (r *Repository[T]) Create(entity T) (int64, error) {
+	if err := r.guard(); err != nil {
+		return 0, err
+	}
+	fs := fields(reflect.TypeOf(entity))
+	if err := beforeSave(r.context(), reflect.ValueOf(&entity).Elem(), fs, true); err != nil {
+		return 0, err
+	}
+	ps := props(reflect.ValueOf(entity), fs, r.t.nulls)
+	r.tenantProps(ps, nil)
+	cyp := fmt.Sprintf("CREATE (n:%s) SET n = $props RETURN id(n)", labelExpr(r.t.labels))
+	id, err := NewTemplate[int64](r.t.conn).QuerySingle(cyp, map[string]any{"props": ps}, NewSingleValueMapper[int64](0))
+	r.invalidate(err, r.t.label)
+	return id, err
+}
+
+// Merge creates a node for the entity, unless a node with the same values of
+// the given key properties exists, and returns its ID. In either case, the
+// properties are set to the fields of the entity according to the NullPolicy
+// of the Template. Unlike CreateIfNotExists, an existing node is modified.
+// Since it is not known in advance, whether the node exists, audit fields
+// recording the creation are not populated, and they are only written if
+// set. Use Upsert instead to populate them.
+func (r *Repository[T]) Merge(entity T, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, errors.New("at least one key is required")
+	} else if err := r.guard(); err != nil {
+		return 0, err
+	}
+	fs := fields(reflect.TypeOf(entity))
+	v := reflect.ValueOf(&entity).Elem()
+	if err := beforeSave(r.context(), v, fs, false); err != nil {
+		return 0, err
+	}
+	ps, omitted := omitCreated(v, fs, props(v, fs, r.t.nulls))
+	keys = r.tenantProps(ps, keys)
+	conds := make([]string, len(keys))
+	for i, k := range keys {
+		v, ok := ps[k]
+		if !ok || v == nil {
+			return 0, fmt.Errorf("key %q is not set", k)
+		}
+		conds[i] = Quote(k) + ": $props." + Quote(k)
+	}
+
+	cyp := fmt.Sprintf("MERGE (n:%s {%s})%s RETURN id(n)", labelExpr(r.t.labels), strings.Join(conds, ", "),
+		setProps(updateOp(r.t.nulls, omitted), deletedKey(reflect.TypeOf(entity)), ps))
+	id, err := NewTemplate[int64](r.t.conn).QuerySingle(cyp, map[string]any{"props": ps}, NewSingleValueMapper[int64](0))
+	r.invalidate(err, r.t.label)
+	return id, err
+}
+
+// Upsert creates a node for the entity, unless a node with the same values of
+// the given key properties exists, and returns its ID and whether it was
+// created. Like in Merge, the properties are set to the fields of the entity,
+// except for fields with the "oncreate" option e.g., `neo4j:"createdAt,oncreate"`,
+// which are only written when the node is created, and fields with the
+// "onmatch" option, which are only written when it exists. Properties, which
+// are not mapped to a field, are left intact. The version field is not taken
+// into account. Audit fields recording the creation are treated like fields
+// with the "oncreate" option.
+func (r *Repository[T]) Upsert(entity T, keys ...string) (id int64, created bool, err error) {
+	return r.UpsertWith(entity, nil, nil, keys...)
+}
+
+// UpsertWith is like Upsert, but additionally sets the properties onCreate,
+// if the node is created, and onMatch otherwise e.g., timestamps or counters
+// computed by the caller.
+func (r *Repository[T]) UpsertWith(entity T, onCreate, onMatch map[string]any, keys ...string) (
+	id int64, created bool, err error) {
+
+	if len(keys) == 0 {
+		return 0, false, errors.New("at least one key is required")
+	} else if err = r.guard(); err != nil {
+		return 0, false, err
+	}
+	fs := fields(reflect.TypeOf(entity))
+	if err = beforeSave(r.context(), reflect.ValueOf(&entity).Elem(), fs, true); err != nil {
+		return 0, false, err
+	}
+	ps := props(reflect.ValueOf(entity), fs, r.t.nulls)
+	create, match := make(map[string]any, len(ps)), make(map[string]any, len(ps))
+	for _, f := range fs {
+		v, ok := ps[f.name]
+		if !ok {
+			continue
+		}
+		if !slices.Contains(f.opts, "onmatch") {
+			create[f.name] = v
+		}
+		if !slices.Contains(f.opts, "oncreate") && !f.isCreated() {
+			match[f.name] = v
+		}
+	}
+	maps.Copy(create, onCreate)
+	maps.Copy(match, onMatch)
+	keys = r.tenantProps(create, keys)
+
+	conds := make([]string, len(keys))
+	for i, k := range keys {
+		if v, ok := create[k]; !ok || v == nil {
+			return 0, false, fmt.Errorf("key %q is not set", k)
+		}
+		conds[i] = Quote(k) + ": $create." + Quote(k)
+	}
+
+	cyp := fmt.Sprintf("MERGE (n:%s {%s}) ON CREATE SET n += $create ON MATCH SET n += $match RETURN id(n)",
+		labelExpr(r.t.labels), strings.Join(conds, ", "))
+	params := map[string]any{"create": create, "match": match}
+	sum, err := r.t.execute(Request{Query: cyp, Params: params, Write: true}, func(res neo4j.Result) error {
+		if !res.Next() {
+			return ErrEmpty
+		}
+		id = res.Record().Values[0].(int64)
+		return nil
+	})
+	if r.invalidate(err, r.t.label); err != nil {
+		return 0, false, err
+	}
+	return id, sum.Counters().NodesCreated() > 0, nil
+}
+
+// FindByID returns the entity mapped from the node with the given ID.
+// If there is no such node within the scope of the Template, ErrEmpty is
+// returned.
+func (r *Repository[T]) FindByID(id any) (entity T, err error) {
+	list, err := r.find(map[string]any{"id": id}, "id(n) = $id")
+	if err != nil {
+		return entity, err
+	} else if len(list) == 0 {
+		return entity, ErrEmpty
+	}
+	return list[0], nil
+}
+
+// FindAll returns all entities within the scope of the Template, which match
+// all of the given filters e.g., FindAll(Eq("name", name)).
+func (r *Repository[T]) FindAll(fs ...Filter) ([]T, error) {
+	if len(fs) == 0 {
+		return r.find(nil)
+	}
+	params := make(map[string]any)
+	return r.find(params, "("+And(fs...).Cypher("n", filterParams(params, "__f"))+")")
+}
+
+// find returns the entities mapped from the nodes satisfying the conditions,
+// including their related entities up to the fetch depth.
+func (r *Repository[T]) find(params map[string]any, conds ...string) ([]T, error) {
+	typ := reflect.TypeOf(new(T)).Elem()
+	cyp := "MATCH (n:" + labelExpr(r.t.labels) + ")" + r.t.live(conds...) + " RETURN " +
+		projection("n", typ, r.fetch, r.t.conn.LabelNaming)
+	fs := fields(typ)
+
+	var list []T
+	_, err := r.t.execute(Request{Query: cyp, Params: r.t.scoped(params)}, func(res neo4j.Result) error {
+		list = list[:0]
+		for res.Next() {
+			var e T
+			if err := r.t.dec.decodeEntity(res.Record().Values[0], reflect.ValueOf(&e).Elem(), fs); err != nil {
+				return err
+			}
+			if err := afterLoad(r.context(), &e); err != nil {
+				return err
+			}
+			list = append(list, e)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// ExistsByID returns whether a node with the given ID exists within the scope
+// of the Template.
+func (r *Repository[T]) ExistsByID(id any) (bool, error) {
+	cyp := "MATCH (n:" + labelExpr(r.t.labels) + ")" + r.t.live("id(n) = $id") + " RETURN count(n) > 0"
+	return NewTemplate[bool](r.t.conn).QuerySingle(cyp, r.t.scoped(map[string]any{"id": id}), NewSingleValueMapper[bool](0))
+}
+
+// DeleteByID deletes the node with the given ID and all of its relationships.
+// If T has a soft-delete field, the node is only marked as deleted instead,
+// unless it already is. It is not an error, if there is no such node. If T
+// implements BeforeDeleter, the entity is loaded first and passed to the hook.
+func (r *Repository[T]) DeleteByID(id any) error {
+	if err := r.guard(); err != nil {
+		return err
+	}
+	if _, ok := any(new(T)).(BeforeDeleter); ok {
+		e, err := r.FindByID(id)
+		if errors.Is(err, ErrEmpty) {
+			return nil
+		} else if err != nil {
+			return err
+		} else if err = any(&e).(BeforeDeleter).BeforeDelete(r.context()); err != nil {
+			return err
+		}
+	}
+	if _, ok := softDeleteField(reflect.TypeOf(new(T)).Elem()); ok {
+		_, err := r.t.SoftDeleteByID(id)
+		r.invalidate(err, r.t.label)
+		return err
+	}
+	return r.Purge(id)
+}
+
+// Purge deletes the node with the given ID and all of its relationships, even
+// if T has a soft-delete field. It is not an error, if there is no such node.
+// No hooks are called.
+func (r *Repository[T]) Purge(id any) error {
+	if err := r.guard(); err != nil {
+		return err
+	}
+	cyp := "MATCH (n:" + labelExpr(r.t.labels) + ")" + r.t.where("id(n) = $id") + " DETACH DELETE n"
+	_, err := r.t.execute(Request{Query: cyp, Params: r.t.scoped(map[string]any{"id": id}), Write: true}, discard)
+	r.invalidate(err, r.t.label)
+	return err
+}
+
+// RestoreByID removes the soft-delete mark of the node with the given ID e.g.,
+// set by DeleteByID or Template.SoftDeleteByID.
+func (r *Repository[T]) RestoreByID(id any) error {
+	if err := r.guard(); err != nil {
+		return err
+	}
+	key := Quote(deletedKey(reflect.TypeOf(new(T)).Elem()))
+	cyp := fmt.Sprintf("MATCH (n:%s)%s REMOVE n.%s", labelExpr(r.t.labels), r.t.where("id(n) = $id"), key)
+	_, err := r.t.execute(Request{Query: cyp, Params: r.t.scoped(map[string]any{"id": id}), Write: true}, discard)
+	r.invalidate(err, r.t.label)
+	return err
+}
+
+// Unscoped returns a copy of the Repository, whose finders also return
+// soft-deleted entities e.g., for administrative purposes.
+func (r Repository[T]) Unscoped() *Repository[T] {
+	r.t = r.t.IncludeDeleted()
+	return &r
+}
+
+// Save creates a node for the entity, if its id field is 0, and updates the
+// node with that ID otherwise. Then, the ID is assigned to the id field, if
+// any. Properties are written according to the NullPolicy of the Template.
+// If there is no node with the ID within the scope of the Template, ErrEmpty
+// is returned.
+//
+// If the entity has a version field, optimistic locking is applied like in
+// Template.Update: the node is only updated if its version equals the version
+// of the entity, and the version is incremented. Otherwise, an
+// OptimisticLockError is returned. New nodes store the version of the entity.
+//
+// Up to the cascade depth, the entities in relationship fields are saved in
+// the same way and the relationships to them are merged. Hence, they should
+// have an id field, because a new node is created for them otherwise.
+// Relationships to nodes, which are not referenced by the entity, are left
+// intact. If the tenants share a database, related nodes are only matched
+// within the tenant of the Repository, too. All statements are executed in
+// the same Transaction, which is not retried by the RetryPolicy, unless it
+// permits non-idempotent Requests.
+//
+// The BeforeSave hooks are called and the audit fields are populated before
+// the Transaction is begun. Audit fields recording the creation are only
+// populated for new nodes, and only written for existing nodes if set.
+func (r *Repository[T]) Save(entity *T) (id int64, err error) {
+	if err = r.guard(); err != nil {
+		return 0, err
+	} else if err = r.prepare(reflect.ValueOf(entity).Elem(), r.cascade); err != nil {
+		return 0, err
+	}
+	var done []func()
+	// Save creates new nodes and increments versions, so retrying a Transaction,
+	// which committed before the acknowledgement was lost, would apply it twice.
+	r0 := Request{Write: true, Idempotency: NotIdempotent}
+	err = r.t.conn.inTx(r0, neo4j.AccessModeWrite, func() error {
+		done = done[:0]
+		id, err = r.save(reflect.ValueOf(entity).Elem(), r.t.labels, r.cascade, true, &done)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, fn := range done {
+		fn()
+	}
+	return id, nil
+}
+
+// save writes the struct v as a node with the given labels and saves its
+// related entities up to the given depth. The scope of the Template is only
+// applied to the root entity. Since the Transaction may be retried, the ID
+// and version are not assigned immediately, but by the functions appended to
+// done, once the Transaction has been committed.
+func (r *Repository[T]) save(v reflect.Value, labels []string, depth int, root bool, done *[]func()) (int64, error) {
+	fs := fields(v.Type())
+	ps, omitted := omitCreated(v, fs, props(v, fs, r.t.nulls))
+	r.tenantProps(ps, nil)
+	params := map[string]any{"props": ps}
+	var conds []string
+
+	var idv reflect.Value
+	if f, ok := idField(fs); ok {
+		idv = v.FieldByIndex(f.index)
+		if idv.Int() != 0 {
+			params["id"] = idv.Int()
+			conds = append(conds, "id(n) = $id")
+		}
+	}
+	var verv reflect.Value
+	vf, versioned := versionField(fs)
+	if versioned {
+		verv = v.FieldByIndex(vf.index)
+		ps[vf.name] = verv.Int()
+		if len(conds) > 0 {
+			params["expectedVersion"] = verv.Int()
+			ps[vf.name] = verv.Int() + 1
+			conds = append(conds, "n."+Quote(vf.name)+" = $expectedVersion")
+		}
+	}
+
+	var cyp string
+	where := func(conds ...string) string {
+		return " WHERE " + strings.Join(conds, " AND ")
+	}
+	switch {
+	case len(conds) == 0:
+		cyp = fmt.Sprintf("CREATE (n:%s) SET n = $props RETURN id(n)", labelExpr(labels))
+	case root:
+		where = r.t.where
+		params = r.t.scoped(params)
+		fallthrough
+	default:
+		if !root {
+			// The scope of the Template, which restricts the root entity to the
+			// tenant, does not apply to related entities.
+			conds = append(conds, r.tenantConds(params, "n")...)
+		}
+		cyp = fmt.Sprintf("MATCH (n:%s)%s%s RETURN id(n)",
+			labelExpr(labels), where(conds...), setProps(updateOp(r.t.nulls, omitted), deletedKey(v.Type()), ps))
+	}
+
+	id, err := NewTemplate[int64](r.t.conn).QuerySingle(cyp, params, NewSingleValueMapper[int64](0))
+	if errors.Is(err, ErrEmpty) && versioned {
+		return 0, lockError(r.t.conn, labels[0], vf.name, params["id"], verv.Int(), where("id(n) = $id"), params)
+	} else if err != nil {
+		return 0, err
+	}
+	*done = append(*done, func() { r.invalidate(nil, labels[0]) })
+	if idv.IsValid() {
+		*done = append(*done, func() { idv.SetInt(id) })
+	}
+	if versioned {
+		ver := ps[vf.name].(int64)
+		*done = append(*done, func() { verv.SetInt(ver) })
+	}
+
+	if depth <= 0 {
+		return id, nil
+	}
+	for _, f := range fs {
+		if f.rel == nil {
+			continue
+		}
+		for _, e := range related(v.FieldByIndex(f.index)) {
+			to, err := r.save(e, typeLabels(f.rel.elem, r.t.conn.LabelNaming), depth-1, false, done)
+			if err != nil {
+				return 0, err
+			}
+			params := map[string]any{"from": id, "to": to}
+			ac := append([]string{"id(a) = $from"}, r.tenantConds(params, "a")...)
+			bc := append([]string{"id(b) = $to"}, r.tenantConds(params, "b")...)
+			cyp := "MATCH (a) WHERE " + strings.Join(ac, " AND ") + " MATCH (b) WHERE " + strings.Join(bc, " AND ") +
+				" MERGE " + f.rel.pattern("a", "b")
+			_, err = r.t.execute(Request{Query: cyp, Params: params, Write: true}, discard)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	return id, nil
+}
+
+// invalidate removes the cached results of Templates with the given labels
+// from the ResultCache of the Conn, unless the write failed.
+func (r *Repository[T]) invalidate(err error, labels ...string) {
+	if err == nil {
+		for _, l := range labels {
+			r.t.conn.InvalidateCache(l + ":")
+		}
+	}
+}
+
+// prepare calls the BeforeSave hooks and populates the audit fields of the
+// struct v and its related entities up to the given depth.
+func (r *Repository[T]) prepare(v reflect.Value, depth int) error {
+	fs := fields(v.Type())
+	isNew := true
+	if f, ok := idField(fs); ok {
+		isNew = v.FieldByIndex(f.index).Int() == 0
+	}
+	if err := beforeSave(r.context(), v, fs, isNew); err != nil {
+		return err
+	}
+	if depth <= 0 {
+		return nil
+	}
+	for _, f := range fs {
+		if f.rel == nil {
+			continue
+		}
+		for _, e := range related(v.FieldByIndex(f.index)) {
+			if err := r.prepare(e, depth-1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// related returns the addressable structs held by a relationship field,
+// skipping nil pointers.
+func related(v reflect.Value) (es []reflect.Value) {
+	n := 1
+	if v.Kind() == reflect.Slice {
+		n = v.Len()
+	}
+	for i := 0; i < n; i++ {
+		e := v
+		if v.Kind() == reflect.Slice {
+			e = v.Index(i)
+		}
+		for e.Kind() == reflect.Pointer && !e.IsNil() {
+			e = e.Elem()
+		}
+		if e.Kind() == reflect.Struct {
+			es = append(es, e)
+		}
+	}
+	return es
+}
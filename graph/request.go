@@ -14,13 +14,251 @@
 
 package graph
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/maps"
+)
+
 // Request is a Cypher query and bind parameters.
 type Request struct {
 	Query  string
 	Params map[string]any
+	// Keys optionally lists the keys the Mapper expects in each Record.
+	// If the Conn is in strict mode, they are verified against the keys
+	// returned by the query.
+	Keys []string
+	// Write forces a write Transaction for this Request, overriding the access
+	// mode of the Template. This is required for queries, which look like
+	// reads, but modify data e.g., procedures. It has no effect if there is
+	// already an active Transaction.
+	Write bool
+	// Metadata is attached to the Transaction created for this Request. It is
+	// visible in dbms.listTransactions and the query log of the server, and it
+	// is included in the log messages of the Conn. A correlation ID is added
+	// under TxIDKey, unless it is already present (see Summary). It takes
+	// precedence over the Metadata of the Conn and the context (see
+	// WithContext).
+	Metadata map[string]any
+	// Timeout is the timeout of the Transaction created for this Request. If
+	// it is not positive, the default timeout of the Conn applies.
+	Timeout time.Duration
+	// Idempotency declares whether the Request can be retried safely. By
+	// default, it is inferred from the query. See RetryPolicy.
+	Idempotency Idempotency
+	// Name is a stable, low-cardinality identifier of the query e.g., for
+	// labeling log messages and metrics. See QueryName.
+	Name string
+}
+
+// NewRequestFromStruct creates a Request with the given query, whose Params
+// are the fields of the struct params. The parameter names are the property
+// keys of the fields, which are derived like for mapping Records i.e., from
+// the "neo4j" tag or using the DefaultNaming strategy. Hence, a field
+// CreatedAt is bound to $createdAt when using CamelCase, and it is read from
+// the key "createdAt" as well. Encrypted fields are encrypted like in Params.
+// An error is returned, if params is neither a struct nor a pointer to one,
+// or if a field cannot be encrypted.
+func NewRequestFromStruct(query string, params any) (Request, error) {
+	rv := reflect.Indirect(reflect.ValueOf(params))
+	if rv.Kind() != reflect.Struct || isDriverType(rv.Type()) {
+		return Request{}, fmt.Errorf("cannot convert %T to parameters", params)
+	}
+	ps, err := EncryptParams(structParams(rv, WriteAll))
+	if err != nil {
+		return Request{}, err
+	}
+	return Request{Query: query, Params: ps}, nil
+}
+
+// Params converts a struct, or a pointer to it, or a map with string keys to
+// a map of parameters, which the driver accepts. Fields are converted like in
+// NewRequestFromStruct, including nil pointers, which become null. Nested
+// structs, lists of structs and maps are converted recursively, whereas
+// time.Time and the temporal and spatial types of the driver are kept.
+// Points are converted to Point2D or Point3D. Durations are only converted to
+// neo4j.Duration, if their field has the "duration" option, and sent as
+// integer nanoseconds otherwise. The values of encrypted fields are encrypted
+// (see DefaultKeyProvider).
+func Params(v any) (map[string]any, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	switch {
+	case !rv.IsValid() || rv.Kind() == reflect.Pointer:
+		return nil, nil
+	case rv.Kind() == reflect.Struct && !isDriverType(rv.Type()):
+		return EncryptParams(structParams(rv, WriteAll))
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+		ps := make(map[string]any, rv.Len())
+		for it := rv.MapRange(); it.Next(); {
+			ps[it.Key().String()], _ = paramValue(it.Value().Interface())
+		}
+		return EncryptParams(ps)
+	}
+	return nil, fmt.Errorf("cannot convert %T to parameters", v)
+}
+
+// ParamsList converts each element of a slice like Params e.g., to pass a list
+// of entities as $rows to UNWIND.
+func ParamsList(v any) ([]any, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("cannot convert %T to a list of parameters", v)
+	}
+	l := make([]any, rv.Len())
+	for i := range l {
+		ps, err := Params(rv.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("[%d]: %w", i, err)
+		}
+		l[i] = ps
+	}
+	return l, nil
+}
+
+// structParams converts a struct to a map of parameters, whose keys are the
+// property keys of the fields. Unlike props, it includes the version field.
+func structParams(v reflect.Value, p NullPolicy) map[string]any {
+	fs := fields(v.Type())
+	ps := props(v, fs, p)
+	if vf, ok := versionField(fs); ok {
+		ps[vf.name] = reflect.Indirect(v).FieldByIndex(vf.index).Interface()
+	}
+	for k, val := range ps {
+		if nv, ok := paramValue(val); ok {
+			ps[k] = nv
+		}
+	}
+	return ps
+}
+
+// normalizeParams converts struct-valued parameters and lists of structs to
+// maps like NewRequestFromStruct, so that an entity can be passed as e.g.,
+// $props. Nil fields are omitted. The given map is not modified.
+func normalizeParams(params map[string]any) map[string]any {
+	var m map[string]any
+	for k, v := range params {
+		if nv, ok := paramValue(v); ok {
+			if m == nil {
+				m = maps.Clone(params)
+			}
+			m[k] = nv
+		}
+	}
+	if m == nil {
+		return params
+	}
+	return m
+}
+
+// paramValue converts a struct, or a list of structs, to a map or a list of
+// maps, respectively. Points are converted to Point2D or Point3D, and the
+// values of maps are converted recursively. It returns false if the value
+// needs no conversion, in particular for temporal and spatial types, which
+// the driver supports.
+func paramValue(val any) (any, bool) {
+	switch v := val.(type) {
+	case sealed:
+		return v, false
+	case Point:
+		return v.driverValue(), true
+	case *Point:
+		if v != nil {
+			return v.driverValue(), true
+		}
+	}
+	v := reflect.ValueOf(val)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.Struct && !isDriverType(v.Type()):
+		return structParams(v, OmitNil), true
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String && mayContainStructs(v.Type().Elem()):
+		m := make(map[string]any, v.Len())
+		changed := false
+		for it := v.MapRange(); it.Next(); {
+			var ok bool
+			m[it.Key().String()], ok = paramValue(it.Value().Interface())
+			changed = changed || ok
+		}
+		return m, changed
+	case v.Kind() == reflect.Slice && mayContainStructs(v.Type().Elem()):
+		l := make([]any, v.Len())
+		changed := false
+		for i := range l {
+			var ok bool
+			l[i], ok = paramValue(v.Index(i).Interface())
+			changed = changed || ok
+		}
+		return l, changed
+	}
+	return val, false
+}
+
+// mayContainStructs returns whether values of the type may be structs, which
+// need to be converted by paramValue.
+func mayContainStructs(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Struct:
+		return !isDriverType(typ)
+	case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// isDriverType returns whether values of the type are supported by the driver
+// as parameters e.g., time.Time, neo4j.Date or neo4j.Point2D.
+func isDriverType(typ reflect.Type) bool {
+	return typ == reflect.TypeOf(time.Time{}) ||
+		strings.HasPrefix(typ.PkgPath(), "github.com/neo4j/neo4j-go-driver/")
+}
+
+// QueryName returns the Name of the Request. If it is empty, a short id is
+// derived from the hash of the query, which is stable across processes.
+func (r Request) QueryName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	h := sha256.Sum256([]byte(r.Query))
+	return "q" + hex.EncodeToString(h[:4])
+}
+
+// Statement produces a Request e.g., a query builder. Request itself is a
+// Statement, which returns itself.
+type Statement interface {
+	Build() (Request, error)
+}
+
+// Build returns the Request.
+func (r Request) Build() (Request, error) {
+	return r, nil
 }
 
 // String returns the Cypher query.
 func (r Request) String() string {
 	return r.Query
 }
+
+// WithSort returns a copy of the Request with the ORDER BY clause of the
+// SortSpec appended to its query.
+func (r Request) WithSort(s SortSpec) Request {
+	if len(s) > 0 {
+		r.Query += " " + s.String()
+	}
+	return r
+}
+
+// Quote escapes a label, relationship type or property key with backticks so
+// that it can safely be embedded in a Cypher query.
+func Quote(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
@@ -0,0 +1,287 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Idempotency declares whether executing a Request more than once has the
+// same effect as executing it once, which makes it safe to retry.
+type Idempotency int
+
+const (
+	// InferIdempotency treats reads and writes without CREATE clauses e.g.,
+	// MERGE-based upserts, as idempotent. This is the default.
+	InferIdempotency Idempotency = iota
+	// Idempotent marks a Request as safe to retry.
+	Idempotent
+	// NotIdempotent marks a Request as unsafe to retry e.g., a MERGE, which
+	// increments a counter.
+	NotIdempotent
+)
+
+var (
+	// createClause matches CREATE clauses, but not CREATE in ON CREATE SET.
+	createClause = regexp.MustCompile(`(?i)\bCREATE\b`)
+	onCreate     = regexp.MustCompile(`(?i)\bON\s+CREATE\b`)
+)
+
+// RetryPolicy controls, which failed Transactions are retried. Only errors,
+// for which QueryError.Retryable returns true, are retried, unless the policy
+// has its own Classifier, and only if the Transaction was created for the
+// Request i.e., not within the current Transaction of the Conn.
+//
+// A failure may occur after the server committed the Transaction, but before
+// the client received the acknowledgement. Retrying a Request, which is not
+// idempotent, applies its effects twice then. Hence, such Requests are only
+// retried if RetryNonIdempotent is set.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt. If it is
+	// not positive, nothing is retried.
+	MaxRetries int
+	// Backoff is the delay before the first retry, which doubles with every
+	// further retry.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between retries, if it is positive.
+	MaxBackoff time.Duration
+	// Jitter randomly shortens each delay by up to the given fraction e.g.,
+	// 0.5 for a delay between 50% and 100% of the backoff, so that clients,
+	// which failed at the same time, do not retry at the same time.
+	Jitter float64
+	// Classifier decides, which errors are transient and hence retried, and
+	// counted as failures by the Breaker. If it is nil, QueryError.Retryable
+	// classifies them.
+	Classifier func(err error) bool
+	// RetryNonIdempotent retries all Requests, regardless of their Idempotency.
+	RetryNonIdempotent bool
+	// Budget caps the rate of retries across all goroutines, if it is not nil.
+	// When it is exhausted, errors are returned without retrying.
+	Budget *RetryBudget
+	// Breaker stops executing Transactions, if it is not nil and too many
+	// consecutive ones failed with transient errors. See CircuitBreaker.
+	Breaker *CircuitBreaker
+}
+
+// RetryBudget is a token bucket, which limits the aggregate rate of retries.
+// When a database is degraded, uncoordinated retries multiply its load; the
+// budget makes clients fail fast instead. It is safe for concurrent use and
+// can be shared by several Conns.
+type RetryBudget struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRetryBudget creates a RetryBudget, which permits rate retries per second
+// on average and up to burst retries at once.
+func NewRetryBudget(rate float64, burst int) *RetryBudget {
+	return &RetryBudget{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// take consumes a token and returns whether one was available.
+func (b *RetryBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// ErrCircuitOpen indicates that a Transaction was not executed, because the
+// CircuitBreaker of the RetryPolicy is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed executes all Transactions.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects all Transactions with ErrCircuitOpen.
+	BreakerOpen
+	// BreakerHalfOpen executes a single Transaction to probe, whether the
+	// database recovered, and rejects the others.
+	BreakerHalfOpen
+)
+
+// CircuitBreaker opens after a number of consecutive Transactions failed with
+// transient errors, so that clients fail fast while the database is
+// unavailable. After the cooldown, it lets a single Transaction through:
+// if it succeeds, the breaker closes, otherwise it opens again. Errors, which
+// are not transient e.g., constraint violations, count as success. It is safe
+// for concurrent use and can be shared by several Conns.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     BreakerState
+	opened    time.Time
+}
+
+// NewCircuitBreaker creates a CircuitBreaker, which opens after threshold
+// consecutive failures and probes the database after the cooldown.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// State returns the current state of the CircuitBreaker.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow returns whether a Transaction may be executed.
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.opened) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		return true
+	case BreakerHalfOpen:
+		return false
+	}
+	return true
+}
+
+// record records the outcome of an allowed Transaction.
+func (b *CircuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.failures, b.state = 0, BreakerClosed
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state, b.opened = BreakerOpen, time.Now()
+	}
+}
+
+// idempotent returns whether the Request can be retried safely.
+func (r Request) idempotent() bool {
+	switch r.Idempotency {
+	case Idempotent:
+		return true
+	case NotIdempotent:
+		return false
+	}
+	q := identifier.ReplaceAllString(Redact(r.Query), "``")
+	return !createClause.MatchString(onCreate.ReplaceAllString(q, "")) &&
+		!writeProcedure.MatchString(q)
+}
+
+// retry calls fn until it succeeds or the RetryPolicy of the Conn does not
+// permit another attempt.
+func (c *Conn) retry(ctx context.Context, r Request, fn func() error) error {
+	return c.Retry.do(ctx, r, fn)
+}
+
+// do calls fn until it succeeds, the RetryPolicy does not permit another
+// attempt, or the context is done. In the latter case, the error of the
+// context is returned.
+func (p RetryPolicy) do(ctx context.Context, r Request, fn func() error) error {
+	err := p.attempt(fn)
+	for i := 0; i < p.MaxRetries && err != nil; i++ {
+		if errors.Is(err, ErrCircuitOpen) || !p.retryable(err) || !p.RetryNonIdempotent && !r.idempotent() {
+			return err
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		} else if p.Budget != nil && !p.Budget.take() {
+			return err
+		}
+		t := time.NewTimer(p.backoff(i))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+		err = p.attempt(fn)
+	}
+	return err
+}
+
+// attempt calls fn, unless the Breaker is open, and records the outcome.
+func (p RetryPolicy) attempt(fn func() error) error {
+	if p.Breaker == nil {
+		return fn()
+	} else if !p.Breaker.allow() {
+		return ErrCircuitOpen
+	}
+	err := fn()
+	p.Breaker.record(err != nil && p.retryable(err))
+	return err
+}
+
+// retryable classifies the error using the Classifier, if any.
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Classifier != nil {
+		return p.Classifier(err)
+	}
+	return retryable(err)
+}
+
+// backoff returns the delay before the retry with the given zero-based index.
+// Without MaxBackoff, the doubled delay saturates at the maximum Duration
+// instead of overflowing.
+func (p RetryPolicy) backoff(i int) time.Duration {
+	if p.Backoff <= 0 {
+		return 0
+	}
+	d := time.Duration(math.MaxInt64)
+	if i < 63 && p.Backoff <= d>>i {
+		d = p.Backoff << i
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// retryable returns whether the error is retryable. Errors of the driver,
+// which are not wrapped in a QueryError, are classified like QueryErrors.
+func retryable(err error) bool {
+	var qerr *QueryError
+	if !errors.As(err, &qerr) {
+		qerr = &QueryError{Err: err}
+	}
+	return qerr.Retryable()
+}
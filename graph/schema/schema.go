@@ -0,0 +1,289 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schema declares indexes and constraints and creates them, if they
+// do not exist yet. The Cypher syntax is chosen according to the version of
+// the server, so that the same declarations work with Neo4j 4.x and 5.x.
+// Neo4j 4.3 or later is required.
+package schema
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abc-inc/roland/graph"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"golang.org/x/exp/slices"
+)
+
+// Def is a declaration of an index or constraint.
+type Def interface {
+	// Describe returns the name, the type as reported by SHOW INDEXES or
+	// SHOW CONSTRAINTS, the labels and the properties.
+	Describe() (name, kind string, labels, props []string)
+	// Cypher returns the statement, which creates the index or constraint on
+	// a server with the given version.
+	Cypher(major, minor int) string
+}
+
+// UniqueConstraint requires the values of the properties to be unique among
+// all nodes with the label.
+type UniqueConstraint struct {
+	Name       string
+	Label      string
+	Properties []string
+}
+
+// NodeKey requires the properties to exist and their values to be unique
+// among all nodes with the label (Enterprise Edition).
+type NodeKey struct {
+	Name       string
+	Label      string
+	Properties []string
+}
+
+// RangeIndex is the default index for equality and range predicates.
+// On Neo4j 4.x, a BTREE index is created.
+type RangeIndex struct {
+	Name       string
+	Label      string
+	Properties []string
+}
+
+// FullTextIndex is a Lucene-backed index for full-text search across one or
+// more labels.
+type FullTextIndex struct {
+	Name       string
+	Labels     []string
+	Properties []string
+}
+
+// VectorIndex is an index for approximate nearest neighbor search on
+// embeddings, which are stored as lists of floats (Neo4j 5.11 or later).
+// Similarity is "cosine" or "euclidean", defaulting to "cosine".
+type VectorIndex struct {
+	Name       string
+	Label      string
+	Property   string
+	Dimensions int
+	Similarity string
+}
+
+// Describe implements Def.
+func (d UniqueConstraint) Describe() (string, string, []string, []string) {
+	return d.Name, "UNIQUENESS", []string{d.Label}, d.Properties
+}
+
+// Cypher implements Def.
+func (d UniqueConstraint) Cypher(major, minor int) string {
+	return constraint(major, minor, d.Name, d.Label, d.Properties, "UNIQUE")
+}
+
+// Describe implements Def.
+func (d NodeKey) Describe() (string, string, []string, []string) {
+	return d.Name, "NODE_KEY", []string{d.Label}, d.Properties
+}
+
+// Cypher implements Def.
+func (d NodeKey) Cypher(major, minor int) string {
+	return constraint(major, minor, d.Name, d.Label, d.Properties, "NODE KEY")
+}
+
+// Describe implements Def.
+func (d RangeIndex) Describe() (string, string, []string, []string) {
+	return d.Name, "RANGE", []string{d.Label}, d.Properties
+}
+
+// Cypher implements Def.
+func (d RangeIndex) Cypher(int, int) string {
+	return fmt.Sprintf("CREATE INDEX %s IF NOT EXISTS FOR (n:%s) ON (%s)",
+		name(d.Name), graph.Quote(d.Label), props(d.Properties))
+}
+
+// Describe implements Def.
+func (d FullTextIndex) Describe() (string, string, []string, []string) {
+	return d.Name, "FULLTEXT", d.Labels, d.Properties
+}
+
+// Cypher implements Def.
+func (d FullTextIndex) Cypher(int, int) string {
+	ls := make([]string, len(d.Labels))
+	for i, l := range d.Labels {
+		ls[i] = graph.Quote(l)
+	}
+	return fmt.Sprintf("CREATE FULLTEXT INDEX %s IF NOT EXISTS FOR (n:%s) ON EACH [%s]",
+		name(d.Name), strings.Join(ls, "|"), props(d.Properties))
+}
+
+// Describe implements Def.
+func (d VectorIndex) Describe() (string, string, []string, []string) {
+	return d.Name, "VECTOR", []string{d.Label}, []string{d.Property}
+}
+
+// Cypher implements Def. Neo4j 5.13 introduced CREATE VECTOR INDEX, which
+// replaced the procedure db.index.vector.createNodeIndex. The procedure
+// requires a name.
+func (d VectorIndex) Cypher(major, minor int) string {
+	sim := d.Similarity
+	if sim == "" {
+		sim = "cosine"
+	}
+	if major == 5 && minor < 13 {
+		return fmt.Sprintf("CALL db.index.vector.createNodeIndex(%s, %s, %s, %d, %s)",
+			literal(d.Name), literal(d.Label), literal(d.Property), d.Dimensions, literal(sim))
+	}
+	return fmt.Sprintf("CREATE VECTOR INDEX %s IF NOT EXISTS FOR (n:%s) ON (n.%s) "+
+		"OPTIONS {indexConfig: {`vector.dimensions`: %d, `vector.similarity_function`: %s}}",
+		name(d.Name), graph.Quote(d.Label), graph.Quote(d.Property), d.Dimensions, literal(sim))
+}
+
+// Existing describes an index or constraint of the database.
+type Existing struct {
+	Name   string
+	Type   string
+	Labels []string
+	Props  []string
+}
+
+// EnsureSchema creates the indexes and constraints, which do not exist yet,
+// and returns the created ones. A declaration exists, if there is an index or
+// constraint with its name, or, if it has no name, with its type, labels and
+// properties. Existing indexes and constraints are neither modified nor
+// dropped, even if their definition differs.
+func EnsureSchema(c *graph.Conn, defs ...Def) (created []Def, err error) {
+	major, minor, err := c.ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+	ex, err := List(c)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range defs {
+		if exists(ex, d) {
+			continue
+		}
+		r := graph.Request{Query: d.Cypher(major, minor), Write: true}
+		if _, _, err = graph.NewTemplate[any](c).Query(r, discard); err != nil {
+			return created, err
+		}
+		created = append(created, d)
+	}
+	return created, nil
+}
+
+// List returns all indexes and constraints of the database. Indexes, which
+// back a constraint, are reported as the constraint. Constraint types are
+// normalized to UNIQUENESS and NODE_KEY, and BTREE indexes are reported as
+// RANGE, so that they can be compared across versions.
+func List(c *graph.Conn) ([]Existing, error) {
+	const cypIdx = "SHOW INDEXES YIELD name, type, labelsOrTypes, properties, owningConstraint " +
+		"WHERE owningConstraint IS NULL RETURN name, type, labelsOrTypes, properties"
+	const cypCons = "SHOW CONSTRAINTS YIELD name, type, labelsOrTypes, properties " +
+		"RETURN name, type, labelsOrTypes, properties"
+
+	m := func(rec *neo4j.Record) Existing {
+		e := Existing{Name: rec.Values[0].(string), Type: normalize(rec.Values[1].(string))}
+		e.Labels, e.Props = strs(rec.Values[2]), strs(rec.Values[3])
+		return e
+	}
+	var ex []Existing
+	for _, cyp := range []string{cypIdx, cypCons} {
+		es, _, err := graph.NewTemplate[Existing](c).Query(graph.Request{Query: cyp}, m)
+		if err != nil {
+			return nil, err
+		}
+		ex = append(ex, es...)
+	}
+	return ex, nil
+}
+
+// exists returns whether the declaration is among the existing ones.
+func exists(ex []Existing, d Def) bool {
+	n, kind, labels, props := d.Describe()
+	return slices.IndexFunc(ex, func(e Existing) bool {
+		if n != "" {
+			return e.Name == n
+		}
+		return e.Type == kind && slices.Equal(e.Labels, labels) && slices.Equal(e.Props, props)
+	}) >= 0
+}
+
+// normalize maps the index and constraint types of different versions
+// to the types used by Describe.
+func normalize(kind string) string {
+	switch kind {
+	case "BTREE":
+		return "RANGE"
+	case "NODE_PROPERTY_UNIQUENESS":
+		return "UNIQUENESS"
+	case "NODE_KEY", "NODE_KEY_CONSTRAINT":
+		return "NODE_KEY"
+	}
+	return kind
+}
+
+// constraint returns the statement, which creates a constraint. Neo4j 4.4
+// introduced FOR ... REQUIRE, which replaced ON ... ASSERT in 5.0.
+func constraint(major, minor int, n, label string, ps []string, pred string) string {
+	p := props(ps)
+	if len(ps) > 1 {
+		p = "(" + p + ")"
+	}
+	if major > 4 || major == 4 && minor >= 4 {
+		return fmt.Sprintf("CREATE CONSTRAINT %s IF NOT EXISTS FOR (n:%s) REQUIRE %s IS %s",
+			name(n), graph.Quote(label), p, pred)
+	}
+	return fmt.Sprintf("CREATE CONSTRAINT %s IF NOT EXISTS ON (n:%s) ASSERT %s IS %s",
+		name(n), graph.Quote(label), p, pred)
+}
+
+// name quotes the name of an index or constraint, unless it is empty.
+func name(n string) string {
+	if n == "" {
+		return ""
+	}
+	return graph.Quote(n)
+}
+
+// literal returns the string as Cypher string literal.
+func literal(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// props returns the comma-separated properties of n.
+func props(ps []string) string {
+	qs := make([]string, len(ps))
+	for i, p := range ps {
+		qs[i] = "n." + graph.Quote(p)
+	}
+	return strings.Join(qs, ", ")
+}
+
+// strs converts a list of strings returned by the driver.
+func strs(v any) []string {
+	l, _ := v.([]any)
+	ss := make([]string, 0, len(l))
+	for _, e := range l {
+		s, _ := e.(string)
+		ss = append(ss, s)
+	}
+	return ss
+}
+
+// discard ignores a Record.
+func discard(*neo4j.Record) any {
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Scored is a result of a search along with its relevance score. Higher
+// scores denote better matches.
+type Scored[T any] struct {
+	Value T
+	Score float64
+}
+
+// SearchFullText queries the full-text index with the given name using
+// db.index.fulltext.queryNodes and returns up to limit matching nodes, ordered
+// by their score. The query uses the Lucene syntax e.g., "name:ali*". Each
+// Record has the columns "n" and "score", and is mapped to T by m e.g.,
+// BindMapper[Person]() for the properties of the node or NewNodeMapper("n").
+// The scope of the Template applies, and soft-deleted nodes are excluded,
+// unless the Template includes them.
+//
+// See schema.FullTextIndex for creating the index.
+func (t Template[T]) SearchFullText(index, query string, limit int, m Mapper[T]) ([]Scored[T], error) {
+	cyp := "CALL db.index.fulltext.queryNodes($__index, $__query) YIELD node AS n, score"
+	return t.search(cyp, limit, map[string]any{"__index": index, "__query": query}, m)
+}
+
+// SearchVector queries the vector index with the given name using
+// db.index.vector.queryNodes and returns the k nodes, whose embeddings are
+// nearest to the given one, ordered by their score. Records are mapped like
+// in SearchFullText. Since the scope and the exclusion of soft-deleted nodes
+// are applied to the k nearest neighbors, fewer nodes may be returned.
+// It requires Neo4j 5.11 or later.
+//
+// See schema.VectorIndex for creating the index.
+func (t Template[T]) SearchVector(index string, embedding []float64, k int, m Mapper[T]) ([]Scored[T], error) {
+	cyp := "CALL db.index.vector.queryNodes($__index, $__limit, $__embedding) YIELD node AS n, score"
+	return t.search(cyp, k, map[string]any{"__index": index, "__embedding": embedding}, m)
+}
+
+// search executes the procedure call, which yields n and score, and maps the
+// best matches to Scored results.
+func (t Template[T]) search(call string, limit int, params map[string]any, m Mapper[T]) ([]Scored[T], error) {
+	if limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+	params["__limit"] = int64(limit)
+	r := Request{Query: call + t.live() + " RETURN n, score ORDER BY score DESC LIMIT $__limit",
+		Params: t.scoped(params)}
+
+	var list []Scored[T]
+	_, err := t.execute(r, func(res neo4j.Result) error {
+		list = list[:0]
+		for res.Next() {
+			rec := res.Record()
+			score, _ := rec.Get("score")
+			s := Scored[T]{Value: m(rec)}
+			s.Score, _ = score.(float64)
+			list = append(list, s)
+		}
+		return nil
+	})
+	return list, err
+}
@@ -0,0 +1,104 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// DeletedAt is the property, which marks a node as soft-deleted, unless T has
+// a field with the "softDelete" option (see Repository).
+const DeletedAt = "deletedAt"
+
+// IncludeDeleted returns a copy of the Template, whose Find, FindAll, Count
+// and GroupCount also consider soft-deleted nodes.
+func (t Template[T]) IncludeDeleted() *Template[T] {
+	t.deleted = true
+	return &t
+}
+
+// live is like where, but excludes soft-deleted nodes, unless the Template
+// includes them.
+func (t Template[T]) live(conds ...string) string {
+	if !t.deleted {
+		conds = append(conds, "n."+Quote(deletedKey(reflect.TypeOf(new(T)).Elem()))+" IS NULL")
+	}
+	return t.where(conds...)
+}
+
+// SoftDeleteByID marks the node with the given ID as deleted by setting its
+// soft-delete property to the current time instead of removing it. Nodes,
+// which are already soft-deleted, keep their original timestamp.
+func (t Template[T]) SoftDeleteByID(id any) (neo4j.ResultSummary, error) {
+	key := Quote(deletedKey(reflect.TypeOf(new(T)).Elem()))
+	cyp := fmt.Sprintf("MATCH (n:%s)%s SET n.%s = datetime()", labelExpr(t.labels),
+		t.where("id(n) = $id", "n."+key+" IS NULL"), key)
+	params := map[string]any{"id": id}
+	return t.execute(Request{Query: cyp, Params: t.scoped(params), Write: true}, discard)
+}
+
+// softDeleteField returns the name of the field of typ with the "softDelete"
+// option, if any.
+func softDeleteField(typ reflect.Type) (string, bool) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return "", false
+	}
+	for _, f := range fields(typ) {
+		if f.softDelete() {
+			return f.name, true
+		}
+	}
+	return "", false
+}
+
+// deletedKey returns the property, which marks nodes of typ as soft-deleted
+// i.e., the soft-delete field or DeletedAt.
+func deletedKey(typ reflect.Type) string {
+	if key, ok := softDeleteField(typ); ok {
+		return key
+	}
+	return DeletedAt
+}
+
+// setProps returns the clause for writing the properties ps as $props to the
+// existing node n with the given operator. Replacing the properties keeps the
+// soft-delete mark, unless ps contains it, so that saving a soft-deleted
+// entity does not restore it.
+func setProps(op, key string, ps map[string]any) string {
+	if _, ok := ps[key]; ok || op != "=" {
+		return " SET n " + op + " $props"
+	}
+	key = Quote(key)
+	return " WITH n, n." + key + " AS __deleted SET n = $props, n." + key + " = __deleted"
+}
+
+// FindAll returns all nodes with the label of the Template within its scope.
+// Soft-deleted nodes are excluded, unless the Template includes them.
+func (t Template[T]) FindAll() ([]T, error) {
+	return t.Find(struct{}{})
+}
+
+// Count returns the number of nodes with the label of the Template within its
+// scope. Soft-deleted nodes are excluded, unless the Template includes them.
+func (t Template[T]) Count() (int64, error) {
+	cyp := "MATCH (n:" + labelExpr(t.labels) + ")" + t.live() + " RETURN count(n)"
+	return NewTemplate[int64](t.conn).QuerySingle(cyp, t.scoped(nil), NewSingleValueMapper[int64](0))
+}
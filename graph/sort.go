@@ -0,0 +1,86 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidSort indicates that a sort specification refers to a column,
+// which is not allowed, or contains an invalid direction.
+var ErrInvalidSort = errors.New("invalid sort")
+
+// Order is a single sort criterion of an ORDER BY clause.
+type Order struct {
+	Expr string
+	Desc bool
+}
+
+// SortSpec is a validated list of sort criteria. Since ORDER BY cannot be
+// parameterized, it ensures that only allowed expressions end up in a query.
+type SortSpec []Order
+
+// ParseSort parses a comma-separated list of sort criteria provided by a user
+// e.g., "name,-age" or "name:asc,age:desc". A leading "-" or the suffix
+// ":desc" sorts in descending order. Each name must be a key of the allowlist,
+// which maps it to the Cypher expression to sort by e.g., "age" to "n.age".
+// Names, which are not allowed, result in ErrInvalidSort.
+func ParseSort(input string, allowed map[string]string) (SortSpec, error) {
+	var s SortSpec
+	for _, c := range strings.Split(input, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+
+		desc := strings.HasPrefix(c, "-")
+		c = strings.TrimPrefix(c, "-")
+		if name, dir, ok := strings.Cut(c, ":"); ok {
+			switch strings.ToLower(dir) {
+			case "asc":
+			case "desc":
+				desc = true
+			default:
+				return nil, fmt.Errorf("%w: direction %q", ErrInvalidSort, dir)
+			}
+			c = name
+		}
+
+		expr, ok := allowed[c]
+		if !ok {
+			return nil, fmt.Errorf("%w: column %q", ErrInvalidSort, c)
+		}
+		s = append(s, Order{Expr: expr, Desc: desc})
+	}
+	return s, nil
+}
+
+// String returns the ORDER BY clause or an empty string, if there are no
+// sort criteria.
+func (s SortSpec) String() string {
+	if len(s) == 0 {
+		return ""
+	}
+	os := make([]string, len(s))
+	for i, o := range s {
+		os[i] = o.Expr
+		if o.Desc {
+			os[i] += " DESC"
+		}
+	}
+	return "ORDER BY " + strings.Join(os, ", ")
+}
@@ -0,0 +1,185 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Stats is a snapshot of the state of a Conn for diagnostic purposes.
+type Stats struct {
+	Address  string `json:"address" yaml:"address"`
+	Version  string `json:"version" yaml:"version"`
+	Edition  string `json:"edition" yaml:"edition"`
+	Database string `json:"database" yaml:"database"`
+	Username string `json:"username" yaml:"username"`
+	// PoolSize is the configured maximum number of connections per server.
+	// The driver does not expose the number of connections in use.
+	PoolSize int `json:"poolSize" yaml:"poolSize"`
+	// InTransaction indicates whether the Conn has a current Transaction.
+	InTransaction bool    `json:"inTransaction" yaml:"inTransaction"`
+	Bookmark      string  `json:"bookmark" yaml:"bookmark"`
+	Metrics       Metrics `json:"metrics" yaml:"metrics"`
+}
+
+// Metrics are the lifetime counters of a Conn and all Conns derived from it,
+// which are cheap to read e.g., for Prometheus collectors. Conns created
+// without NewConn e.g., by package mock, do not count.
+type Metrics struct {
+	// OpenSessions is the number of Sessions, which are not closed yet. The
+	// driver does not expose the number of idle connections in its pool.
+	OpenSessions int64 `json:"openSessions" yaml:"openSessions"`
+	// Sessions is the number of Sessions opened so far.
+	Sessions int64 `json:"sessions" yaml:"sessions"`
+	// Queries is the number of queries run by Templates so far.
+	Queries int64 `json:"queries" yaml:"queries"`
+	// FailedQueries is the number of queries, which failed to run or whose
+	// Result failed.
+	FailedQueries int64 `json:"failedQueries" yaml:"failedQueries"`
+}
+
+// metrics holds the Metrics, which are updated atomically.
+type metrics struct {
+	open, sessions, queries, failed int64
+}
+
+// Metrics returns a snapshot of the Metrics of the Conn.
+func (c *Conn) Metrics() Metrics {
+	if c.metrics == nil {
+		return Metrics{}
+	}
+	return Metrics{OpenSessions: atomic.LoadInt64(&c.metrics.open), Sessions: atomic.LoadInt64(&c.metrics.sessions),
+		Queries: atomic.LoadInt64(&c.metrics.queries), FailedQueries: atomic.LoadInt64(&c.metrics.failed)}
+}
+
+// session counts the Session as open until it is closed.
+func (m *metrics) session(sess neo4j.Session) neo4j.Session {
+	if m == nil {
+		return sess
+	}
+	atomic.AddInt64(&m.open, 1)
+	atomic.AddInt64(&m.sessions, 1)
+	return &countingSession{Session: sess, fn: func() { atomic.AddInt64(&m.open, -1) }}
+}
+
+// query counts a query and its failure, if it fails to run or its Result
+// fails when it is consumed.
+func (m *metrics) query(res neo4j.Result, err error) (neo4j.Result, error) {
+	if m == nil {
+		return res, err
+	}
+	atomic.AddInt64(&m.queries, 1)
+	if err != nil {
+		atomic.AddInt64(&m.failed, 1)
+		return res, err
+	}
+	return OnSummary(res, func(_ neo4j.ResultSummary, err error) {
+		if err != nil {
+			atomic.AddInt64(&m.failed, 1)
+		}
+	}), nil
+}
+
+// countingSession calls fn, when it is closed for the first time.
+type countingSession struct {
+	neo4j.Session
+	fn   func()
+	once sync.Once
+}
+
+// Close closes the Session.
+func (s *countingSession) Close() error {
+	s.once.Do(s.fn)
+	return s.Session.Close()
+}
+
+// Ping checks, whether the database of the Conn is available by running a
+// trivial query. The deadline of the context limits the Transaction.
+func (c *Conn) Ping(ctx context.Context) error {
+	const cyp = "CALL db.ping()"
+	if err := ctx.Err(); err != nil {
+		return ctxErr(cyp, err)
+	}
+	sess := c.SessionMode(neo4j.AccessModeRead)
+	defer func() { _ = sess.Close() }()
+	res, err := sess.Run(cyp, nil, c.txConfig(Request{}.WithContext(ctx))...)
+	if err == nil {
+		_, err = res.Consume()
+	}
+	if cerr := ctx.Err(); cerr != nil && err != nil {
+		return ctxErr(cyp, cerr)
+	}
+	return wrapErr(cyp, err)
+}
+
+// VerifyConnectivity checks, whether the driver and the drivers of the
+// readers, if any, can connect to their servers. Unlike Ping, it does not
+// check the availability of the database.
+func (c *Conn) VerifyConnectivity() error {
+	if err := c.Driver.VerifyConnectivity(); err != nil {
+		return err
+	}
+	if c.readers != nil {
+		for _, d := range c.readers.drivers {
+			if err := d.VerifyConnectivity(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the server information, the configuration and
+// the state of the Conn. It queries the server for its version and edition;
+// use Metrics to read the counters only.
+func (c *Conn) Stats(ctx context.Context) (s Stats, err error) {
+	if err = ctx.Err(); err != nil {
+		return s, err
+	}
+
+	const cyp = "CALL dbms.components() YIELD versions, edition RETURN versions[0], edition"
+	sess := c.SessionMode(neo4j.AccessModeRead)
+	defer func() { _ = sess.Close() }()
+	res, err := sess.Run(cyp, nil)
+	if err != nil {
+		return s, wrapErr(cyp, err)
+	}
+	rec, err := res.Single()
+	if err != nil {
+		return s, wrapErr(cyp, err)
+	}
+	s.Version, _ = rec.Values[0].(string)
+	s.Edition, _ = rec.Values[1].(string)
+
+	u := c.Driver.Target()
+	cfg := neo4j.Config{MaxConnectionPoolSize: 100}
+	for _, opt := range c.opts {
+		opt(&cfg)
+	}
+	s.Address = u.Host
+	s.Database = c.DBName
+	s.Username = c.Username()
+	s.PoolSize = cfg.MaxConnectionPoolSize
+	s.InTransaction = c.Tx != nil
+	s.Metrics = c.Metrics()
+	if bms := c.lastBookmarks(); len(bms) > 0 {
+		s.Bookmark = bms[0]
+	}
+	return s, nil
+}
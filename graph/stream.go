@@ -0,0 +1,219 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"sync"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Stream delivers mapped Records through a bounded channel.
+// The producer stops pulling Records from the server while the buffer is
+// full, so the speed of the consumer limits the memory consumption.
+//
+// The channel can be received from by many goroutines, which is the simplest
+// way to distribute the Records to workers. ForEach does this and propagates
+// errors in both directions.
+type Stream[T any] struct {
+	ch     chan T
+	cancel context.CancelFunc
+	cur    T
+	sum    neo4j.ResultSummary
+	err    error
+}
+
+// Stream executes the given Request in a separate Session and sends each
+// mapped Record to the returned Stream, which buffers up to size values.
+// Records are pulled from the server in batches of the FetchSize of the Conn.
+//
+// The Stream is closed when all Records have been received, an error occurs,
+// or the context is cancelled. Consumers, which stop receiving early, must
+// cancel the context or call Cancel to release the Session. Cancellation also
+// attempts to terminate the Transaction server-side, so that a long-running
+// statement does not keep consuming resources.
+func (t Template[T]) Stream(ctx context.Context, r Request, m Mapper[T], size int) *Stream[T] {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Stream[T]{ch: make(chan T, size), cancel: cancel}
+	go func() {
+		defer cancel()
+		defer close(s.ch)
+		s.sum, s.err = t.stream(ctx, r, m, s.ch)
+	}()
+	return s
+}
+
+// QueryChan executes the given Request in a separate Session like Stream, but
+// sends each mapped Record to the returned channel of values, which is
+// unbuffered. Hence, Records are pulled from the server in batches of the
+// FetchSize of the Conn only as fast as they are received, and the values can
+// feed a pipeline of goroutines without collecting them in a slice:
+//
+//	vals, errc := t.QueryChan(ctx, r, m)
+//	for v := range vals {
+//		process(v)
+//	}
+//	if err := <-errc; err != nil {
+//		return err
+//	}
+//
+// The values channel is closed when all Records have been sent, an error
+// occurs, or the context is cancelled. Afterwards, the error channel receives
+// the error, if any, and is closed. Consumers, which stop receiving early,
+// must cancel the context to release the Session.
+func (t Template[T]) QueryChan(ctx context.Context, r Request, m Mapper[T]) (<-chan T, <-chan error) {
+	vals, errc := make(chan T), make(chan error, 1)
+	go func() {
+		defer close(errc)
+		_, err := t.stream(ctx, r, m, vals)
+		close(vals)
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return vals, errc
+}
+
+// stream runs the query in a new Transaction and sends the results to ch.
+func (t Template[T]) stream(ctx context.Context, r Request, m Mapper[T], ch chan<- T) (
+	sum neo4j.ResultSummary, err error) {
+
+	defer recoverMapping(&err)
+	if err = t.conn.checkReadOnly(r.Query); err != nil {
+		return nil, err
+	}
+	sess := t.conn.SessionMode(t.accessMode(r))
+	defer func() { _ = sess.Close() }()
+
+	id := newTxID()
+	cr := r.WithContext(ctx)
+	meta := mergeParams(map[string]any{TxIDKey: id}, cr.Metadata)
+	tx, err := sess.BeginTransaction(t.conn.txConfig(Request{Metadata: meta, Timeout: cr.Timeout})...)
+	if err != nil {
+		return nil, wrapErr(r.Query, err)
+	}
+	defer func(tx neo4j.Transaction) { _ = tx.Close() }(tx)
+	defer t.conn.watch(ctx, id)()
+
+	lr := r
+	lr.Metadata = meta
+	t.conn.logQuery(lr)
+	finish := t.conn.instrument(ctx, lr)
+	n := 0
+	defer func() { finish(n, sum, err) }()
+	rr := lr
+	rr.Query, rr.Params = t.conn.cypher(r.Query), t.params(r.Params)
+	res, err := t.conn.run(ctx, rr, tx.Run)
+	if err != nil {
+		return nil, wrapErr(r.Query, err)
+	}
+
+	for ; res.Next(); n++ {
+		select {
+		case ch <- m(res.Record()):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	sum, err = res.Consume()
+	if err != nil {
+		return nil, wrapErr(r.Query, err)
+	}
+	t.conn.logSlow(lr, sum)
+	if err = t.conn.checkNotifications(r.Query, sum); err != nil {
+		return nil, err
+	} else if err = tx.Commit(); err != nil {
+		return nil, wrapErr(r.Query, err)
+	}
+	t.conn.setBookmark(sess)
+	return correlated(sum, id), nil
+}
+
+// Chan returns the channel, from which the mapped Records can be received.
+func (s *Stream[T]) Chan() <-chan T {
+	return s.ch
+}
+
+// ForEach receives the Records with the given number of goroutines (at least
+// one) and calls fn for each of them concurrently. It returns after the Stream
+// is closed and all calls have returned. If fn returns an error, the Stream is
+// cancelled, the remaining Records are discarded and the first error is
+// returned. Otherwise, the error of the Stream is returned, if any.
+func (s *Stream[T]) ForEach(workers int, fn func(T) error) error {
+	var (
+		wg   sync.WaitGroup
+		once sync.Once
+		err  error
+	)
+	failed := make(chan struct{})
+	for i := 0; i < workers || i == 0; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range s.ch {
+				select {
+				case <-failed:
+					continue
+				default:
+				}
+				if e := fn(v); e != nil {
+					once.Do(func() {
+						err = e
+						close(failed)
+						s.cancel()
+					})
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	return s.err
+}
+
+// Cancel stops the Stream, as if the context was cancelled.
+func (s *Stream[T]) Cancel() {
+	s.cancel()
+}
+
+// Next receives the next mapped Record, which is returned by Value. It blocks
+// until a Record is available, and returns false after the last one.
+func (s *Stream[T]) Next() bool {
+	v, ok := <-s.ch
+	s.cur = v
+	return ok
+}
+
+// Value returns the Record received by the last call to Next.
+func (s *Stream[T]) Value() T {
+	return s.cur
+}
+
+// Err returns the error, which terminated the Stream prematurely.
+// It must only be called after the channel has been closed.
+func (s *Stream[T]) Err() error {
+	return s.err
+}
+
+// Summary returns the ResultSummary e.g., to log the Counters, once all
+// Records have been received. Like Err, it must only be called after the
+// channel has been closed i.e., Next returned false. It returns nil if the
+// Stream was terminated by an error.
+func (s *Stream[T]) Summary() neo4j.ResultSummary {
+	return s.sum
+}
@@ -0,0 +1,206 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"golang.org/x/exp/slices"
+)
+
+// Counters holds the number of changes made by one or more queries.
+type Counters struct {
+	NodesCreated         int `json:"nodesCreated" yaml:"nodesCreated" view:"Nodes Created"`
+	NodesDeleted         int `json:"nodesDeleted" yaml:"nodesDeleted" view:"Nodes Deleted"`
+	RelationshipsCreated int `json:"relationshipsCreated" yaml:"relationshipsCreated" view:"Relationships Created"`
+	RelationshipsDeleted int `json:"relationshipsDeleted" yaml:"relationshipsDeleted" view:"Relationships Deleted"`
+	PropertiesSet        int `json:"propertiesSet" yaml:"propertiesSet" view:"Properties Set"`
+	LabelsAdded          int `json:"labelsAdded" yaml:"labelsAdded" view:"Labels Added"`
+	LabelsRemoved        int `json:"labelsRemoved" yaml:"labelsRemoved" view:"Labels Removed"`
+	IndexesAdded         int `json:"indexesAdded" yaml:"indexesAdded" view:"Indexes Added"`
+	IndexesRemoved       int `json:"indexesRemoved" yaml:"indexesRemoved" view:"Indexes Removed"`
+	ConstraintsAdded     int `json:"constraintsAdded" yaml:"constraintsAdded" view:"Constraints Added"`
+	ConstraintsRemoved   int `json:"constraintsRemoved" yaml:"constraintsRemoved" view:"Constraints Removed"`
+}
+
+// Add accumulates the counters of a ResultSummary.
+func (c *Counters) Add(s neo4j.ResultSummary) {
+	if s == nil {
+		return
+	}
+	n := s.Counters()
+	c.NodesCreated += n.NodesCreated()
+	c.NodesDeleted += n.NodesDeleted()
+	c.RelationshipsCreated += n.RelationshipsCreated()
+	c.RelationshipsDeleted += n.RelationshipsDeleted()
+	c.PropertiesSet += n.PropertiesSet()
+	c.LabelsAdded += n.LabelsAdded()
+	c.LabelsRemoved += n.LabelsRemoved()
+	c.IndexesAdded += n.IndexesAdded()
+	c.IndexesRemoved += n.IndexesRemoved()
+	c.ConstraintsAdded += n.ConstraintsAdded()
+	c.ConstraintsRemoved += n.ConstraintsRemoved()
+}
+
+// NotificationCategory groups Notifications by their cause. The categories
+// are the ones of Neo4j 5, which are derived from the codes of Notifications
+// for older servers.
+type NotificationCategory string
+
+const (
+	// CategoryDeprecation denotes deprecated syntax, functions or procedures.
+	CategoryDeprecation NotificationCategory = "DEPRECATION"
+	// CategoryUnrecognized denotes unknown labels, relationship types or
+	// property keys, which are often typos.
+	CategoryUnrecognized NotificationCategory = "UNRECOGNIZED"
+	// CategoryPerformance denotes queries, which are likely slow e.g., due to
+	// a cartesian product or an unbounded variable length pattern.
+	CategoryPerformance NotificationCategory = "PERFORMANCE"
+	// CategoryHint denotes hints, which cannot be fulfilled.
+	CategoryHint NotificationCategory = "HINT"
+	// CategoryUnsupported denotes experimental features.
+	CategoryUnsupported NotificationCategory = "UNSUPPORTED"
+	// CategoryGeneric denotes all other Notifications.
+	CategoryGeneric NotificationCategory = "GENERIC"
+)
+
+// Notification is a warning or information about a query reported by the
+// server e.g., Neo.ClientNotification.Statement.UnknownLabelWarning.
+type Notification struct {
+	Code        string               `json:"code" yaml:"code" view:"Code"`
+	Title       string               `json:"title" yaml:"title" view:"Title"`
+	Description string               `json:"description" yaml:"description" view:"Description"`
+	Severity    string               `json:"severity" yaml:"severity" view:"Severity"`
+	Category    NotificationCategory `json:"category" yaml:"category" view:"Category"`
+	// Line and Column are the 1-based position in the query, or 0 if the
+	// Notification does not refer to a position.
+	Line   int `json:"line,omitempty" yaml:"line,omitempty" view:"Line"`
+	Column int `json:"column,omitempty" yaml:"column,omitempty" view:"Column"`
+}
+
+// String returns the title and the position of the Notification.
+func (n Notification) String() string {
+	if n.Line == 0 {
+		return n.Title
+	}
+	return fmt.Sprintf("%s (line %d, column %d)", n.Title, n.Line, n.Column)
+}
+
+// Insights is a typed view of a ResultSummary.
+type Insights struct {
+	Query         string         `json:"query" yaml:"query" view:"Query"`
+	Counters      Counters       `json:"counters" yaml:"counters" view:"Counters"`
+	Notifications []Notification `json:"notifications" yaml:"notifications" view:"Notifications"`
+}
+
+// InsightsOf returns the Counters and Notifications of the ResultSummary.
+func InsightsOf(s neo4j.ResultSummary) (in Insights) {
+	if s == nil {
+		return in
+	}
+	in.Query = s.Query().Text()
+	in.Counters.Add(s)
+	in.Notifications = notifications(s)
+	return in
+}
+
+// Warnings returns the Notifications with severity WARNING.
+func (in Insights) Warnings() []Notification {
+	var ws []Notification
+	for _, n := range in.Notifications {
+		if n.Severity == "WARNING" {
+			ws = append(ws, n)
+		}
+	}
+	return ws
+}
+
+// Has returns whether there is a Notification of one of the categories.
+func (in Insights) Has(cs ...NotificationCategory) bool {
+	return slices.IndexFunc(in.Notifications, func(n Notification) bool {
+		return slices.Contains(cs, n.Category)
+	}) >= 0
+}
+
+// NotificationError is returned by Templates, if the server reports a
+// Notification of a category listed in Conn.FailOn. The Transaction created
+// for the query is rolled back.
+type NotificationError struct {
+	Query         string
+	Notifications []Notification
+}
+
+// Error lists the Notifications.
+func (e *NotificationError) Error() string {
+	ns := make([]string, len(e.Notifications))
+	for i, n := range e.Notifications {
+		ns[i] = n.String()
+	}
+	return "query raised notifications: " + strings.Join(ns, "; ")
+}
+
+// checkNotifications returns a NotificationError, if the summary contains
+// Notifications of the categories in FailOn.
+func (c *Conn) checkNotifications(query string, s neo4j.ResultSummary) error {
+	if len(c.FailOn) == 0 || s == nil || len(s.Notifications()) == 0 {
+		return nil
+	}
+	var ns []Notification
+	for _, n := range notifications(s) {
+		if slices.Contains(c.FailOn, n.Category) {
+			ns = append(ns, n)
+		}
+	}
+	if len(ns) == 0 {
+		return nil
+	}
+	return &NotificationError{Query: query, Notifications: ns}
+}
+
+// notifications converts the Notifications of the driver.
+func notifications(s neo4j.ResultSummary) []Notification {
+	var ns []Notification
+	for _, dn := range s.Notifications() {
+		n := Notification{Code: dn.Code(), Title: dn.Title(), Description: dn.Description(),
+			Severity: dn.Severity(), Category: category(dn.Code())}
+		if p := dn.Position(); p != nil {
+			n.Line, n.Column = p.Line(), p.Column()
+		}
+		ns = append(ns, n)
+	}
+	return ns
+}
+
+// category derives the NotificationCategory from the code.
+func category(code string) NotificationCategory {
+	_, name, _ := strings.Cut(code, ".Statement.")
+	switch {
+	case strings.Contains(name, "Deprecat"):
+		return CategoryDeprecation
+	case strings.HasPrefix(name, "Unknown"):
+		return CategoryUnrecognized
+	case strings.Contains(name, "Hint"):
+		return CategoryHint
+	case strings.Contains(name, "Experimental") || strings.Contains(name, "Unsupported"):
+		return CategoryUnsupported
+	case strings.Contains(name, "Cartesian") || strings.Contains(name, "Unbounded") ||
+		strings.Contains(name, "Exhaustive") || strings.Contains(name, "Eager") ||
+		strings.Contains(name, "Index") || strings.Contains(name, "DynamicProperty"):
+		return CategoryPerformance
+	}
+	return CategoryGeneric
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Table holds the result of a query in tabular form e.g., for rendering
+// arbitrary results in a grid.
+type Table struct {
+	// Columns are the keys of the result in the order of the RETURN clause.
+	Columns []string
+	Rows    [][]any
+}
+
+// QueryTable executes the Request and returns its result as Table. Nodes and
+// Relationships are converted to maps like NewResultMapper, Paths to maps with
+// the keys "nodes" and "relationships", temporal values to time.Time and
+// durations and points to their string representation.
+func (c *Conn) QueryTable(r Request) (tab Table, err error) {
+	_, err = NewTemplate[any](c).execute(r, func(res neo4j.Result) error {
+		if tab.Columns, err = res.Keys(); err != nil {
+			return err
+		}
+		tab.Rows = tab.Rows[:0]
+		for res.Next() {
+			vs := res.Record().Values
+			row := make([]any, len(vs))
+			for i, v := range vs {
+				row[i] = tableValue(v)
+			}
+			tab.Rows = append(tab.Rows, row)
+		}
+		return nil
+	})
+	return tab, err
+}
+
+// tableValue converts a value returned by the driver to a Go-friendly value.
+func tableValue(val any) any {
+	switch v := val.(type) {
+	case neo4j.Node:
+		return mapNode(v)
+	case neo4j.Relationship:
+		return mapRel(v)
+	case neo4j.Path:
+		ns := make([]any, len(v.Nodes))
+		for i, n := range v.Nodes {
+			ns[i] = mapNode(n)
+		}
+		rs := make([]any, len(v.Relationships))
+		for i, r := range v.Relationships {
+			rs[i] = mapRel(r)
+		}
+		return map[string]any{"nodes": ns, "relationships": rs}
+	case neo4j.Date:
+		return time.Time(v)
+	case neo4j.LocalDateTime:
+		return time.Time(v)
+	case neo4j.LocalTime:
+		return time.Time(v)
+	case neo4j.Time:
+		return time.Time(v)
+	case neo4j.Duration:
+		return v.String()
+	case neo4j.Point2D:
+		return v.String()
+	case neo4j.Point3D:
+		return v.String()
+	case []any:
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = tableValue(e)
+		}
+		return l
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = tableValue(e)
+		}
+		return m
+	}
+	return val
+}
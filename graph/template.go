@@ -15,12 +15,14 @@
 package graph
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
+	"golang.org/x/exp/slices"
 )
 
 // ErrEmpty indicates that a query returned no result.
@@ -29,89 +31,410 @@ var ErrEmpty = errors.New("empty")
 // ErrMultiple indicates that a query returned more Records than expected.
 var ErrMultiple = errors.New("multiple")
 
+// ErrKeyMismatch indicates that the keys returned by a query differ from the
+// keys expected by the Mapper.
+var ErrKeyMismatch = errors.New("key mismatch")
+
 // Template simplifies the use of Neo4j and helps to avoid common errors.
 // It executes core Neo4j workflow, leaving application code to provide Cypher
 // and extract results. Template executes Cypher queries or updates, initiating
 // iteration over Results and catching errors. Callers need only to implement
 // callback functions, giving them a clearly defined contract.
+// Errors reported by the driver are wrapped in a QueryError.
 // All Neo4j operations performed are logged at debug level, using the Logger.
 type Template[T any] struct {
-	conn  *Conn
-	label string
+	conn    *Conn
+	label   string
+	labels  []string
+	mode    neo4j.AccessMode
+	nulls   NullPolicy
+	defs    func() map[string]any
+	dec     Decoder
+	max     int
+	scope   string
+	sps     map[string]any
+	multi   MultiplePolicy
+	deleted bool
+	retry   *RetryPolicy
+	ctx     context.Context
 }
 
+// MultiplePolicy controls how QuerySingle handles queries, which return more
+// than one Record.
+type MultiplePolicy int
+
+const (
+	// FailOnMultiple returns ErrMultiple. This is the default.
+	FailOnMultiple MultiplePolicy = iota
+	// TakeFirst returns the first Record and discards the others.
+	TakeFirst
+)
+
 // NewTemplate creates a new Template with the given connection.
+// By default, queries are executed in write mode. The labels of the nodes of
+// type T are derived from the type (see Labeler).
 func NewTemplate[T any](conn *Conn) *Template[T] {
-	return &Template[T]{conn, defLabel[T]()}
+	var naming NamingStrategy
+	if conn != nil {
+		naming = conn.LabelNaming
+	}
+	ls := typeLabels(reflect.TypeOf(make([]T, 0)).Elem(), naming)
+	return &Template[T]{conn: conn, label: ls[0], labels: ls, mode: neo4j.AccessModeWrite}
+}
+
+// WithAccessMode returns a copy of the Template, which creates Transactions
+// with the given access mode. Individual Requests can still force write mode.
+func (t Template[T]) WithAccessMode(mode neo4j.AccessMode) *Template[T] {
+	t.mode = mode
+	return &t
+}
+
+// WithLabels returns a copy of the Template, which uses the given labels for
+// the nodes of type T instead of the ones derived from the type e.g., for
+// labels, which are no valid Go identifiers. Nodes are matched by all labels
+// and created with all of them. The first one is the primary label e.g., for
+// invalidating cached results. Related entities keep their labels.
+func (t Template[T]) WithLabels(label string, more ...string) *Template[T] {
+	t.label, t.labels = label, append([]string{label}, more...)
+	return &t
+}
+
+// WithNullPolicy returns a copy of the Template, which applies the given
+// NullPolicy when writing entities.
+func (t Template[T]) WithNullPolicy(p NullPolicy) *Template[T] {
+	t.nulls = p
+	return &t
+}
+
+// WithDecoder returns a copy of the Template, which uses the given Decoder for
+// mapping Records and Nodes to structs of type T e.g., in QueryEach and Find.
+func (t Template[T]) WithDecoder(d Decoder) *Template[T] {
+	t.dec = d
+	return &t
+}
+
+// WithScope returns a copy of the Template, which restricts the nodes matched
+// by Find, GroupCount, Update and UpdateFields to the given predicate e.g.,
+// "n.active = $active", where n is the node. The parameters of the scope take
+// precedence over parameters of the same name passed to these methods.
+// Calling WithScope again combines both predicates with AND.
+func (t Template[T]) WithScope(whereFragment string, params map[string]any) *Template[T] {
+	if t.scope != "" {
+		whereFragment = t.scope + " AND (" + whereFragment + ")"
+	} else {
+		whereFragment = "(" + whereFragment + ")"
+	}
+	t.scope, t.sps = whereFragment, mergeParams(params, t.sps)
+	return &t
+}
+
+// where returns a WHERE clause combining the conditions and the scope with
+// AND, or an empty string if there is no condition.
+func (t Template[T]) where(conds ...string) string {
+	if t.scope != "" {
+		conds = append(conds, t.scope)
+	}
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// scoped adds the parameters of the scope to the given parameters.
+func (t Template[T]) scoped(params map[string]any) map[string]any {
+	if len(t.sps) == 0 {
+		return params
+	}
+	return mergeParams(t.sps, params)
+}
+
+// WithMultiplePolicy returns a copy of the Template, which applies the given
+// MultiplePolicy in QuerySingle.
+func (t Template[T]) WithMultiplePolicy(p MultiplePolicy) *Template[T] {
+	t.multi = p
+	return &t
+}
+
+// WithDefaultParams returns a copy of the Template, which adds the given
+// parameters to every query, unless the query provides a parameter with the
+// same name. Default parameters of the Template take precedence over the
+// Params of the Conn.
+func (t Template[T]) WithDefaultParams(params map[string]any) *Template[T] {
+	return t.WithParamsFunc(func() map[string]any { return params })
+}
+
+// WithParamsFunc is like WithDefaultParams, but the default parameters are
+// obtained for each query e.g., to provide the current time.
+func (t Template[T]) WithParamsFunc(fn func() map[string]any) *Template[T] {
+	t.defs = fn
+	return &t
+}
+
+// params merges the given parameters with the default parameters of the
+// Template and the Conn.
+func (t Template[T]) params(params map[string]any) map[string]any {
+	if t.defs != nil {
+		params = mergeParams(params, t.defs())
+	}
+	return t.conn.params(params)
+}
+
+// accessMode returns the access mode to use for the given Request.
+func (t Template[T]) accessMode(r Request) neo4j.AccessMode {
+	if r.Write {
+		return neo4j.AccessModeWrite
+	}
+	return t.mode
 }
 
 // Query executes the given Cypher with list of parameters to bind to the query,
 // mapping each record to a value via a RowMapper. If there is no Transaction
 // on this Session, then an explicit transaction is started and committed
-// afterwards.
+// afterwards. The Transaction uses the access mode of the Template, unless
+// the Request forces write mode.
+// If the Conn is in strict mode and the Request declares the expected Keys,
+// they are compared with the keys of the result before any Record is mapped.
 func (t Template[T]) Query(r Request, m Mapper[T]) (
 	list []T, summary neo4j.ResultSummary, err error) {
 
-	tx, created, err := t.conn.GetTransaction()
+	summary, err = t.execute(r, func(res neo4j.Result) error {
+		list = list[:0]
+		for res.Next() {
+			list = append(list, m(res.Record()))
+		}
+		return nil
+	})
+	return list, summary, err
+}
+
+// QueryStatement is like Query, but builds the Request from the Statement
+// e.g., a query created by the cypher package. If the Statement cannot be
+// built, its error is returned without executing anything.
+func (t Template[T]) QueryStatement(s Statement, m Mapper[T]) (
+	[]T, neo4j.ResultSummary, error) {
+
+	r, err := s.Build()
 	if err != nil {
-		return nil, summary, err
+		return nil, nil, err
+	}
+	return t.Query(r, m)
+}
+
+// Scan is like Query, but appends the mapped Records to the slice dest points
+// to. This allows callers to reuse a pre-allocated slice across queries e.g.,
+// by truncating it to zero length before each call.
+func (t Template[T]) Scan(r Request, dest *[]T, m Mapper[T]) error {
+	n := len(*dest)
+	_, err := t.execute(r, func(res neo4j.Result) error {
+		*dest = (*dest)[:n]
+		for res.Next() {
+			*dest = append(*dest, m(res.Record()))
+		}
+		return nil
+	})
+	return err
+}
+
+// QueryEach executes the given Request, maps each Record to a struct of type T
+// like NewStructMapper, and calls fn for each of them. If fn returns an error,
+// the iteration stops and the error is returned.
+//
+// To avoid an allocation per Record, the same struct is reset and reused for
+// all Records. Hence, fn must copy the struct if it retains it beyond the
+// call, and must not retain the pointer. If the query is retried according to
+// the RetryPolicy of the Conn, fn receives the Records again.
+func (t Template[T]) QueryEach(r Request, fn func(*T) error) error {
+	var dest T
+	v := reflect.ValueOf(&dest).Elem()
+	fs := fields(v.Type())
+	var zero T
+	_, err := t.execute(r, func(res neo4j.Result) error {
+		for res.Next() {
+			dest = zero
+			if err := t.dec.decode(res.Record(), v, fs); err != nil {
+				return err
+			}
+			if err := fn(&dest); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// QueryReduce executes the given Request, maps each Record to T and folds the
+// values into a single accumulator of type A, starting with initial e.g., a
+// sum or a histogram. Unlike Query, it does not collect the Records, which is
+// useful for aggregating large results client-side. Since methods cannot have
+// type parameters, the Template is an argument.
+func QueryReduce[A, T any](t *Template[T], r Request, m Mapper[T], initial A,
+	fn func(acc A, val T) A) (A, error) {
+
+	var acc A
+	_, err := t.execute(r, func(res neo4j.Result) error {
+		acc = initial
+		for res.Next() {
+			acc = fn(acc, m(res.Record()))
+		}
+		return nil
+	})
+	return acc, err
+}
+
+// execute runs the Request in the current Transaction or a new one, which is
+// committed afterwards, and passes the Result to fn before consuming it.
+// A new Transaction is retried according to the RetryPolicy of the Conn, so fn
+// must reset its state before processing the Result.
+func (t Template[T]) execute(r Request, fn func(res neo4j.Result) error) (
+	summary neo4j.ResultSummary, err error) {
+
+	if t.conn.Tx != nil {
+		return t.executeOnce(r, fn)
+	}
+	err = t.conn.retry(t.context(), r, func() error {
+		summary, err = t.executeOnce(r, fn)
+		return err
+	})
+	return summary, err
+}
+
+// context returns the context of the query being executed by QueryContext and
+// the like, or context.Background(). It is passed to the RetryPolicy, the
+// Interceptors and the Instrumentation of the Conn.
+func (t Template[T]) context() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
+// executeOnce is like execute, but without retries.
+func (t Template[T]) executeOnce(r Request, fn func(res neo4j.Result) error) (
+	summary neo4j.ResultSummary, err error) {
+
+	defer recoverMapping(&err)
+	if err = t.conn.checkReadOnly(r.Query); err != nil {
+		return nil, err
+	}
+	var id string
+	if t.conn.Tx == nil {
+		r.Metadata, id = correlate(r.Metadata)
+	}
+	tx, created, err := t.conn.GetTransactionMode(t.accessMode(r), t.conn.txConfig(r)...)
+	if err != nil {
+		return nil, wrapErr(r.Query, err)
 	} else if created {
 		defer func(tx neo4j.Transaction) {
 			_, _ = t.conn.Rollback()
 		}(tx)
 	}
 
-	res, err := tx.Run(r.Query, r.Params)
+	cyp := r.Query
+	if t.max > 0 {
+		cyp = limitQuery(cyp, t.max+1)
+	}
+	lr := r
+	lr.Name, lr.Query = r.QueryName(), cyp
+	t.conn.logQuery(lr)
+	params := t.params(r.Params)
+	t.conn.warnCartesian(tx, lr, params)
+	finish := t.conn.instrument(t.context(), lr)
+	cr := &countingResult{}
+	defer func() { finish(cr.n, summary, err) }()
+	rr := lr
+	rr.Query, rr.Params = t.conn.cypher(cyp), params
+	res, err := t.conn.run(t.context(), rr, tx.Run)
 	if err != nil {
-		return nil, nil, err
+		return nil, wrapErr(r.Query, err)
+	}
+	cr.Result = res
+	res = cr
+	if t.conn.Strict && len(r.Keys) > 0 {
+		if err = verifyKeys(res, r.Keys); err != nil {
+			return nil, err
+		}
 	}
 
-	for res.Next() {
-		list = append(list, m(res.Record()))
+	if t.max > 0 {
+		if res, err = limitResult(r.Query, res, t.max); err != nil {
+			return nil, err
+		}
+	}
+	if err = fn(res); err != nil {
+		return nil, err
 	}
 	summary, _ = res.Consume()
+	t.conn.logSlow(lr, summary)
+	if err = t.conn.checkNotifications(r.Query, summary); err != nil {
+		return nil, err
+	}
 
 	if created {
 		_, err = t.conn.Commit()
 	}
-	return list, summary, err
+	return correlated(summary, id), wrapErr(r.Query, err)
 }
 
 // QuerySingle is like Query, but maps exactly one result record to a value
-// via a Mapper. If the query does not return exactly one record, an error is
-// returned.
+// via a Mapper. If the query returns no record, ErrEmpty is returned. If it
+// returns more than one record, the MultiplePolicy of the Template decides
+// whether ErrMultiple or the first record is returned. In both cases, the
+// remaining records are discarded. If ErrEmpty or ErrMultiple is returned, a
+// Transaction created for the query is rolled back. In dry-run mode, the zero
+// value is returned instead. Otherwise, the query is executed like by Query
+// e.g., it is retried according to the RetryPolicy of the Conn.
 func (t Template[T]) QuerySingle(
 	cyp string, params map[string]any, m Mapper[T]) (val T, err error) {
 
-	tx, created, err := t.conn.GetTransaction()
-	if err != nil {
-		return val, err
-	} else if created {
-		defer func(conn *Conn) {
-			_, _ = conn.Rollback()
-		}(t.conn)
+	_, err = t.execute(Request{Query: cyp, Params: params}, t.single(m, &val))
+	return val, err
+}
+
+// single returns a function, which maps exactly one Record of the result to
+// val according to the MultiplePolicy of the Template. ErrEmpty and
+// ErrMultiple are returned from it, so that a Transaction created for the
+// query is rolled back. In dry-run mode, val is left unchanged.
+func (t Template[T]) single(m Mapper[T], val *T) func(res neo4j.Result) error {
+	return func(res neo4j.Result) error {
+		if t.conn.DryRun {
+			return nil
+		} else if !res.Next() {
+			return ErrEmpty
+		}
+		*val = m(res.Record())
+		if res.Next() && t.multi == FailOnMultiple {
+			return ErrMultiple
+		}
+		return nil
 	}
+}
 
-	res, err := tx.Run(cyp, params)
+// verifyKeys checks whether the result contains exactly the expected keys.
+func verifyKeys(res neo4j.Result, want []string) error {
+	have, err := res.Keys()
 	if err != nil {
-		return val, err
-	} else if !res.Next() {
-		return val, ErrEmpty
+		return err
 	}
 
-	val = m(res.Record())
-	if res.Next() {
-		return val, ErrMultiple
+	var missing, unexpected []string
+	for _, k := range want {
+		if !slices.Contains(have, k) {
+			missing = append(missing, k)
+		}
 	}
-
-	if created {
-		_, err = t.conn.Commit()
+	for _, k := range have {
+		if !slices.Contains(want, k) {
+			unexpected = append(unexpected, k)
+		}
 	}
-	return val, err
+	if len(missing) > 0 || len(unexpected) > 0 {
+		return fmt.Errorf("%w: missing %v, unexpected %v", ErrKeyMismatch, missing, unexpected)
+	}
+	return nil
 }
 
-// defLabel returns the default label for a certain entity type.
-func defLabel[T any]() string {
-	typ := reflect.TypeOf(make([]T, 0)).Elem().Name()
-	return cases.Title(language.Und, cases.NoLower).String(typ)
+// discard ignores all Records, which are consumed by execute afterwards.
+func discard(neo4j.Result) error {
+	return nil
 }
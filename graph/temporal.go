@@ -0,0 +1,139 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"golang.org/x/exp/slices"
+)
+
+// Spatial reference identifiers of the coordinate reference systems, which
+// are supported by Neo4j.
+const (
+	SRIDCartesian   uint32 = 7203
+	SRIDCartesian3D uint32 = 9157
+	SRIDWGS84       uint32 = 4326
+	SRIDWGS843D     uint32 = 4979
+)
+
+// Point is a location in a coordinate reference system identified by SRID.
+// In geographic systems, X is the longitude and Y is the latitude. Z is only
+// used by three-dimensional systems.
+//
+// Point fields are mapped from and to Point2D and Point3D values of the
+// driver, depending on the SRID.
+type Point struct {
+	X    float64 `json:"x" yaml:"x"`
+	Y    float64 `json:"y" yaml:"y"`
+	Z    float64 `json:"z,omitempty" yaml:"z,omitempty"`
+	SRID uint32  `json:"srid" yaml:"srid"`
+}
+
+// Is3D returns whether the coordinate reference system has three dimensions.
+func (p Point) Is3D() bool {
+	return p.SRID == SRIDCartesian3D || p.SRID == SRIDWGS843D
+}
+
+// String returns the Point in Cypher syntax e.g., point({x: 1, y: 2, srid: 7203}).
+func (p Point) String() string {
+	if p.Is3D() {
+		return fmt.Sprintf("point({x: %v, y: %v, z: %v, srid: %d})", p.X, p.Y, p.Z, p.SRID)
+	}
+	return fmt.Sprintf("point({x: %v, y: %v, srid: %d})", p.X, p.Y, p.SRID)
+}
+
+// driverValue returns the Point as Point2D or Point3D.
+func (p Point) driverValue() any {
+	if p.Is3D() {
+		return neo4j.Point3D{X: p.X, Y: p.Y, Z: p.Z, SpatialRefId: p.SRID}
+	}
+	return neo4j.Point2D{X: p.X, Y: p.Y, SpatialRefId: p.SRID}
+}
+
+var (
+	pointType    = reflect.TypeOf(Point{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// setTemporal assigns Point2D and Point3D values to Point fields, and
+// Durations to time.Duration fields. It returns false, if neither applies.
+// Durations, which contain months, cannot be converted, because months vary
+// in length; days are converted to 24 hours.
+func setTemporal(dst reflect.Value, val any) (bool, error) {
+	switch v := val.(type) {
+	case neo4j.Point2D:
+		if dst.Type() != pointType {
+			return false, nil
+		}
+		dst.Set(reflect.ValueOf(Point{X: v.X, Y: v.Y, SRID: v.SpatialRefId}))
+	case neo4j.Point3D:
+		if dst.Type() != pointType {
+			return false, nil
+		}
+		dst.Set(reflect.ValueOf(Point{X: v.X, Y: v.Y, Z: v.Z, SRID: v.SpatialRefId}))
+	case neo4j.Duration:
+		if dst.Type() != durationType {
+			return false, nil
+		} else if v.Months != 0 {
+			return true, &ConversionError{Value: val, Type: dst.Type()}
+		}
+		d := time.Duration(v.Days)*24*time.Hour + time.Duration(v.Seconds)*time.Second + time.Duration(v.Nanos)
+		dst.Set(reflect.ValueOf(d))
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// temporalValue converts a time.Time value according to the options of its
+// field: "date", "localdatetime", "localtime" and "time" store it as Date,
+// LocalDateTime, LocalTime and Time, respectively, instead of DateTime e.g.,
+// `neo4j:"birthday,date"`. A time.Duration is stored as Duration with the
+// option "duration" e.g., `neo4j:"timeout,duration"`, and as integer number
+// of nanoseconds otherwise. Other values are returned as is.
+func temporalValue(val any, opts []string) any {
+	if d, ok := val.(time.Duration); ok {
+		if slices.Contains(opts, "duration") {
+			return neo4j.DurationOf(0, 0, int64(d/time.Second), int(d%time.Second))
+		}
+		return val
+	} else if d, ok := val.(*time.Duration); ok {
+		if d != nil && slices.Contains(opts, "duration") {
+			return neo4j.DurationOf(0, 0, int64(*d/time.Second), int(*d%time.Second))
+		}
+		return val
+	}
+	t, ok := val.(time.Time)
+	if p, isPtr := val.(*time.Time); isPtr && p != nil {
+		t, ok = *p, true
+	}
+	switch {
+	case !ok:
+		return val
+	case slices.Contains(opts, "date"):
+		return neo4j.DateOf(t)
+	case slices.Contains(opts, "localdatetime"):
+		return neo4j.LocalDateTimeOf(t)
+	case slices.Contains(opts, "localtime"):
+		return neo4j.LocalTimeOf(t)
+	case slices.Contains(opts, "time"):
+		return neo4j.OffsetTimeOf(t)
+	}
+	return val
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"golang.org/x/exp/slices"
+)
+
+// ErrNoTenant indicates that a Repository refused to write, because the Conn
+// has a Tenancy, but the context of the Repository has no tenant.
+var ErrNoTenant = errors.New("no tenant in context")
+
+// Tenancy separates the data of tenants, which are identified by the tenant
+// in the context of a Repository (see WithTenant and Repository.WithContext).
+// Repositories without a tenant refuse to write, but their finders are not
+// restricted e.g., for administrative purposes. Templates are not affected;
+// use WithScope or WithDatabase instead.
+type Tenancy struct {
+	// Database returns the database of the tenant. If it is not nil, each
+	// tenant has a database of its own.
+	Database func(tenant string) string
+	// Property is the property, which holds the tenant of a node e.g.,
+	// "tenantId", if all tenants share a database. Finders and updates are
+	// restricted to the nodes of the tenant, and new nodes receive the
+	// property. Merge and Upsert include it in their keys.
+	Property string
+}
+
+// tenantKey is the context key of the tenant.
+type tenantKey struct{}
+
+// WithTenant returns a context, which holds the identifier of the tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// Tenant returns the tenant stored in the context, or an empty string.
+func Tenant(ctx context.Context) string {
+	t, _ := ctx.Value(tenantKey{}).(string)
+	return t
+}
+
+// applyTenant restricts the Repository to the tenant according to the
+// Tenancy of the Conn.
+func (r *Repository[T]) applyTenant(tn *Tenancy, tenant string) {
+	r.tenant = tenant
+	if tn.Database != nil {
+		t := *r.t
+		t.conn = r.t.conn.WithDatabase(tn.Database(tenant))
+		r.t = &t
+	} else if tn.Property != "" {
+		r.t = r.t.WithScope("n."+Quote(tn.Property)+" = $__tenant", map[string]any{"__tenant": tenant})
+	}
+}
+
+// guard returns ErrNoTenant, if the Conn has a Tenancy, but the Repository
+// has no tenant.
+func (r *Repository[T]) guard() error {
+	if r.t.conn.Tenancy != nil && r.tenant == "" {
+		return ErrNoTenant
+	}
+	return nil
+}
+
+// tenantConds returns the predicates restricting the given variables to the
+// nodes of the tenant and adds the parameter, if the tenants share a database.
+// Unlike the scope of the Template, it applies to nodes of any label e.g.,
+// related entities saved by cascade.
+func (r *Repository[T]) tenantConds(params map[string]any, vars ...string) []string {
+	tn := r.t.conn.Tenancy
+	if tn == nil || tn.Database != nil || tn.Property == "" || r.tenant == "" {
+		return nil
+	}
+	params["__tenant"] = r.tenant
+	conds := make([]string, len(vars))
+	for i, v := range vars {
+		conds[i] = v + "." + Quote(tn.Property) + " = $__tenant"
+	}
+	return conds
+}
+
+// tenantProps adds the tenant property to the properties of a node and returns
+// the keys extended by it, if the tenants share a database.
+func (r *Repository[T]) tenantProps(ps map[string]any, keys []string) []string {
+	tn := r.t.conn.Tenancy
+	if tn == nil || tn.Database != nil || tn.Property == "" || r.tenant == "" {
+		return keys
+	}
+	ps[tn.Property] = r.tenant
+	if len(keys) > 0 && !slices.Contains(keys, tn.Property) {
+		keys = append(keys[:len(keys):len(keys)], tn.Property)
+	}
+	return keys
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"golang.org/x/exp/slices"
+)
+
+// BuildTree builds a forest from the Paths e.g., returned by
+// "MATCH p = (root:Category {name: $name})<-[:PARENT*0..]-() RETURN p". Each
+// Path starts at a root and each hop adds the next node as child of the
+// previous one. Common prefixes of the Paths are merged, so that each child is
+// only added once to its parent. Nodes, which are reached on a cycle, are
+// skipped.
+//
+// The nodes are converted by mapNode and their children are assigned to the
+// field named childField, which must be an exported field of type []T or []*T.
+// T must be a struct type. The roots are returned in the order of their first
+// occurrence.
+func BuildTree[T any](paths []neo4j.Path, mapNode func(n neo4j.Node) T, childField string) ([]T, error) {
+	elem := reflect.TypeOf((*T)(nil)).Elem()
+	f, err := childrenField(elem, childField)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int64]neo4j.Node)
+	children := make(map[int64][]int64)
+	edges := make(map[[2]int64]bool)
+	hasParent := make(map[int64]bool)
+	var roots []int64
+	for _, p := range paths {
+		for i, n := range p.Nodes {
+			if _, ok := nodes[n.Id]; !ok {
+				nodes[n.Id] = n
+			}
+			if i == 0 {
+				if !hasParent[n.Id] && !slices.Contains(roots, n.Id) {
+					roots = append(roots, n.Id)
+				}
+				continue
+			}
+			e := [2]int64{p.Nodes[i-1].Id, n.Id}
+			if !edges[e] {
+				edges[e] = true
+				children[e[0]] = append(children[e[0]], n.Id)
+				hasParent[n.Id] = true
+			}
+		}
+	}
+
+	var build func(id int64, seen map[int64]bool) reflect.Value
+	build = func(id int64, seen map[int64]bool) reflect.Value {
+		v := reflect.New(elem)
+		v.Elem().Set(reflect.ValueOf(mapNode(nodes[id])))
+		seen[id] = true
+		cs := v.Elem().FieldByIndex(f.Index)
+		for _, c := range children[id] {
+			if seen[c] {
+				continue
+			}
+			ch := build(c, seen)
+			if f.Type.Elem() == elem {
+				ch = ch.Elem()
+			}
+			cs.Set(reflect.Append(cs, ch))
+		}
+		delete(seen, id)
+		return v
+	}
+
+	var forest []T
+	for _, id := range roots {
+		if !hasParent[id] {
+			forest = append(forest, build(id, map[int64]bool{}).Elem().Interface().(T))
+		}
+	}
+	return forest, nil
+}
+
+// childrenField returns the exported field of the struct type elem, which
+// holds the children of a node.
+func childrenField(elem reflect.Type, name string) (reflect.StructField, error) {
+	if elem.Kind() != reflect.Struct {
+		return reflect.StructField{}, fmt.Errorf("cannot build a tree of %s: not a struct", elem)
+	}
+	f, ok := elem.FieldByName(name)
+	if !ok || !f.IsExported() || f.Type.Kind() != reflect.Slice ||
+		f.Type.Elem() != elem && f.Type.Elem() != reflect.PointerTo(elem) {
+		return f, fmt.Errorf("%s has no exported field %s of type []%[1]s or []*%[1]s", elem, name)
+	}
+	// The field must not be promoted through an embedded pointer, which is nil
+	// in a new node.
+	t := elem
+	for _, i := range f.Index[:len(f.Index)-1] {
+		if t = t.Field(i).Type; t.Kind() == reflect.Pointer {
+			return f, fmt.Errorf("field %s of %s is promoted through an embedded pointer", name, elem)
+		}
+	}
+	return f, nil
+}
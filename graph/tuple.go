@@ -0,0 +1,132 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Pair holds the values of the first two columns of a Record e.g., a key and
+// its aggregate in RETURN n.name, count(*).
+type Pair[K, V any] struct {
+	Key   K
+	Value V
+}
+
+// Triple holds the values of the first three columns of a Record.
+type Triple[A, B, C any] struct {
+	First  A
+	Second B
+	Third  C
+}
+
+// tuple is implemented by pointers to Pair and Triple.
+type tuple interface {
+	decodeTuple(d Decoder, rec *neo4j.Record) error
+}
+
+func (p *Pair[K, V]) decodeTuple(d Decoder, rec *neo4j.Record) error {
+	return decodeColumns(d, rec, &p.Key, &p.Value)
+}
+
+func (t *Triple[A, B, C]) decodeTuple(d Decoder, rec *neo4j.Record) error {
+	return decodeColumns(d, rec, &t.First, &t.Second, &t.Third)
+}
+
+// decodeColumns assigns the values of the first columns of the Record to the
+// destinations in order, converting them like the fields of a struct.
+func decodeColumns(d Decoder, rec *neo4j.Record, dests ...any) error {
+	if len(rec.Values) < len(dests) {
+		return &MappingError{Err: fmt.Errorf("expected %d columns, got %d", len(dests), len(rec.Values))}
+	}
+	for i, dest := range dests {
+		if err := d.setValue(reflect.ValueOf(dest).Elem(), d.inLocation(rec.Values[i])); err != nil {
+			return &MappingError{Key: rec.Keys[i], Err: err}
+		}
+	}
+	return nil
+}
+
+// NewPairMapper creates a new Mapper that maps the first two columns of each
+// Record to a Pair. Numbers, lists and entities are converted like in
+// NewStructMapper e.g., an integer count to an int.
+func NewPairMapper[K, V any]() Mapper[Pair[K, V]] {
+	return DefaultMapper[Pair[K, V]]()
+}
+
+// NewTripleMapper creates a new Mapper that maps the first three columns of
+// each Record to a Triple like NewPairMapper.
+func NewTripleMapper[A, B, C any]() Mapper[Triple[A, B, C]] {
+	return DefaultMapper[Triple[A, B, C]]()
+}
+
+// DefaultMapper returns a Mapper for the type T using the default Decoder.
+// See DefaultMapperWith.
+func DefaultMapper[T any]() Mapper[T] {
+	return DefaultMapperWith[T](Decoder{})
+}
+
+// DefaultMapperWith returns a Mapper for the type T, which depends on its
+// kind:
+//
+//   - map[string]any receives all columns like NewRawResultMapper.
+//   - Pair and Triple receive the first columns in order.
+//   - Structs, except for time.Time, Point, Node, Relationship, Path and the
+//     types of the driver, are mapped like in NewStructMapper.
+//   - All other types, such as int64 for count queries, receive the first
+//     column, which is converted like a field of a struct.
+func DefaultMapperWith[T any](d Decoder) Mapper[T] {
+	var zero T
+	typ := reflect.TypeOf(&zero).Elem()
+	switch {
+	case typ == reflect.TypeOf(map[string]any(nil)):
+		return any(NewRawResultMapper()).(Mapper[T])
+	case isTuple[T]():
+		return func(rec *neo4j.Record) (t T) {
+			if err := any(&t).(tuple).decodeTuple(d, rec); err != nil {
+				panic(err)
+			}
+			return t
+		}
+	case typ.Kind() == reflect.Struct && !isDriverType(typ) && !isGraphType(typ) && typ != pointType &&
+		typ != reflect.TypeOf(time.Time{}):
+		return NewStructMapperWith[T](d)
+	}
+	return func(rec *neo4j.Record) (t T) {
+		if err := decodeColumns(d, rec, &t); err != nil {
+			panic(err)
+		}
+		return t
+	}
+}
+
+// isTuple returns whether T is a Pair or a Triple.
+func isTuple[T any]() bool {
+	_, ok := any(new(T)).(tuple)
+	return ok
+}
+
+// QueryDefault is like Query, but maps each Record with a DefaultMapper, which
+// uses the Decoder of the Template. It allows to query maps, primitive values
+// and tuples without a custom Mapper e.g.,
+//
+//	NewTemplate[Pair[string, int]](c).QueryDefault(Request{Query: "MATCH (n) RETURN labels(n)[0], count(*)"})
+func (t Template[T]) QueryDefault(r Request) ([]T, neo4j.ResultSummary, error) {
+	return t.Query(r, DefaultMapperWith[T](t.dec))
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// TxWork is a unit of work executed within a managed Transaction, which
+// returns a value of type T.
+type TxWork[T any] func(tx neo4j.Transaction) (T, error)
+
+// ReadTx executes the work in a managed read Transaction in a new Session.
+// The driver retries the work on transient errors, so it must be idempotent.
+// Unlike neo4j.Session.ReadTransaction, the result is returned as type T.
+// The current Transaction of the Conn, if any, is not used.
+func ReadTx[T any](c *Conn, work TxWork[T]) (T, error) {
+	return managedTx(c, neo4j.AccessModeRead, work)
+}
+
+// WriteTx is like ReadTx, but executes the work in a write Transaction.
+func WriteTx[T any](c *Conn, work TxWork[T]) (T, error) {
+	return managedTx(c, neo4j.AccessModeWrite, work)
+}
+
+// managedTx executes the work in a managed Transaction with the given mode.
+func managedTx[T any](c *Conn, mode neo4j.AccessMode, work TxWork[T]) (val T, err error) {
+	sess := c.SessionMode(mode)
+	defer func() { _ = sess.Close() }()
+
+	fn := func(tx neo4j.Transaction) (any, error) {
+		return work(tx)
+	}
+
+	var res any
+	if mode == neo4j.AccessModeRead {
+		res, err = sess.ReadTransaction(fn, c.txConfig(Request{})...)
+	} else {
+		res, err = sess.WriteTransaction(fn, c.txConfig(Request{})...)
+	}
+	if err != nil {
+		return val, err
+	}
+	c.setBookmark(sess)
+	val, _ = res.(T)
+	return val, nil
+}
+
+// WithRetryPolicy returns a copy of the Template, whose ReadTransaction and
+// WriteTransaction apply the given RetryPolicy instead of the one of the Conn.
+func (t Template[T]) WithRetryPolicy(p RetryPolicy) *Template[T] {
+	t.retry = &p
+	return &t
+}
+
+// ReadTransaction executes the work in a read Transaction in a new Session,
+// and commits it. Transient errors e.g., deadlocks and leader switches, are
+// retried according to the RetryPolicy of the Template or the Conn. Since the
+// whole Transaction is executed again, the work must be idempotent.
+// Unlike ReadTx, retries are subject to the backoff and the RetryBudget of the
+// RetryPolicy rather than to the retry logic of the driver.
+func (t Template[T]) ReadTransaction(work TxWork[T]) (T, error) {
+	return t.transaction(neo4j.AccessModeRead, work)
+}
+
+// WriteTransaction is like ReadTransaction, but executes the work in a write
+// Transaction.
+func (t Template[T]) WriteTransaction(work TxWork[T]) (T, error) {
+	return t.transaction(neo4j.AccessModeWrite, work)
+}
+
+// transaction executes the work in a Transaction with the given mode and
+// retries it according to the RetryPolicy.
+func (t Template[T]) transaction(mode neo4j.AccessMode, work TxWork[T]) (val T, err error) {
+	p := t.conn.Retry
+	if t.retry != nil {
+		p = *t.retry
+	}
+	err = p.do(context.Background(), Request{Idempotency: Idempotent}, func() error {
+		val, err = explicitTx(t.conn, mode, work)
+		return err
+	})
+	return val, err
+}
+
+// explicitTx executes the work in a Transaction with the given mode in a new
+// Session. The Transaction is committed, if the work succeeds, and rolled
+// back otherwise.
+func explicitTx[T any](c *Conn, mode neo4j.AccessMode, work TxWork[T]) (val T, err error) {
+	sess := c.SessionMode(mode)
+	defer func() { _ = sess.Close() }()
+
+	tx, err := sess.BeginTransaction(c.txConfig(Request{})...)
+	if err != nil {
+		return val, wrapErr("", err)
+	}
+	defer func() { _ = tx.Close() }()
+
+	if val, err = work(tx); err != nil {
+		_ = tx.Rollback()
+		return val, err
+	} else if err = tx.Commit(); err != nil {
+		return val, wrapErr("", err)
+	}
+	c.setBookmark(sess)
+	return val, nil
+}
+
+// inTx executes the work in the Transaction of the Conn. Unless the Conn has
+// an active Transaction, a new one is begun for the work, committed if the
+// work succeeds and rolled back otherwise, and the whole work is retried
+// according to the RetryPolicy of the Conn.
+func (c *Conn) inTx(r Request, mode neo4j.AccessMode, work func() error) error {
+	if c.Tx != nil {
+		return work()
+	}
+	return c.retry(context.Background(), r, func() error {
+		if _, _, err := c.GetTransactionMode(mode, c.txConfig(r)...); err != nil {
+			return wrapErr(r.Query, err)
+		}
+		defer func() { _, _ = c.Rollback() }()
+
+		if err := work(); err != nil {
+			return err
+		} else if _, err = c.Commit(); err != nil {
+			return wrapErr(r.Query, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"time"
+)
+
+// Keys of transaction metadata, which identify the application call
+// responsible for a Transaction in SHOW TRANSACTIONS, dbms.listTransactions
+// and the query log of the server.
+const (
+	MetaApp       = "app"
+	MetaRequestID = "requestId"
+	MetaUser      = "user"
+)
+
+// txMetaKey and txTimeoutKey are the context keys of the transaction metadata
+// and timeout.
+type (
+	txMetaKey    struct{}
+	txTimeoutKey struct{}
+)
+
+// WithTxMetadata returns a context, which attaches the metadata to the
+// Transactions created with it e.g., by QueryContext, Stream and WithinTx.
+// It is merged with the metadata of previous calls, and the metadata of a
+// Request takes precedence:
+//
+//	ctx = graph.WithTxMetadata(ctx, map[string]any{graph.MetaRequestID: reqID})
+func WithTxMetadata(ctx context.Context, meta map[string]any) context.Context {
+	return context.WithValue(ctx, txMetaKey{}, mergeParams(meta, txMeta(ctx)))
+}
+
+// WithTxTimeout returns a context, which limits the Transactions created with
+// it to the given duration. Unlike a deadline of the context, it applies to
+// each Transaction separately, and it is enforced by the server only.
+func WithTxTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, txTimeoutKey{}, d)
+}
+
+// TxMetadata returns the transaction metadata of the context. It includes the
+// Principal under MetaUser, unless the metadata contains the key already.
+func TxMetadata(ctx context.Context) map[string]any {
+	meta := txMeta(ctx)
+	if p := Principal(ctx); p != "" {
+		meta = mergeParams(meta, map[string]any{MetaUser: p})
+	}
+	return meta
+}
+
+// txMeta returns the transaction metadata stored in the context.
+func txMeta(ctx context.Context) map[string]any {
+	meta, _ := ctx.Value(txMetaKey{}).(map[string]any)
+	return meta
+}
+
+// WithContext returns a copy of the Request, whose Metadata includes the
+// TxMetadata of the context, and whose Timeout is limited by the timeout and
+// the deadline of the context.
+func (r Request) WithContext(ctx context.Context) Request {
+	r.Metadata = mergeParams(r.Metadata, TxMetadata(ctx))
+	if d, ok := ctx.Value(txTimeoutKey{}).(time.Duration); ok && d > 0 && (r.Timeout <= 0 || d < r.Timeout) {
+		r.Timeout = d
+	}
+	r.Timeout = ctxTimeout(ctx, r.Timeout)
+	return r
+}
@@ -0,0 +1,132 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// ErrVersionConflict indicates that a node was not updated, because its
+// version differs from the expected one i.e., it was modified concurrently.
+var ErrVersionConflict = errors.New("version conflict")
+
+// OptimisticLockError indicates that a node was not updated, because its
+// version differs from the expected one i.e., another writer modified it
+// concurrently, or because it does not exist anymore. It wraps
+// ErrVersionConflict.
+type OptimisticLockError struct {
+	ID       any
+	Label    string
+	Expected int64
+	Actual   int64
+	Exists   bool
+}
+
+// Error describes the expected and the actual version of the node.
+func (e *OptimisticLockError) Error() string {
+	if !e.Exists {
+		return fmt.Sprintf("%s: node %v (%s) does not exist", ErrVersionConflict, e.ID, e.Label)
+	}
+	return fmt.Sprintf("%s: node %v (%s) has version %d instead of %d",
+		ErrVersionConflict, e.ID, e.Label, e.Actual, e.Expected)
+}
+
+// Unwrap returns ErrVersionConflict.
+func (e *OptimisticLockError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+// lockError returns an OptimisticLockError for the node with the given ID,
+// which includes its current version. The node is matched by the WHERE
+// clause, which may apply the scope of a Template.
+func lockError(c *Conn, label, key string, id any, expected int64, where string, params map[string]any) error {
+	cyp := fmt.Sprintf("MATCH (n:%s)%s RETURN n.%s", Quote(label), where, Quote(key))
+	vers, _, err := NewTemplate[any](c).Query(Request{Query: cyp, Params: params}, NewSingleValueMapper[any](0))
+	if err != nil {
+		return err
+	}
+	e := &OptimisticLockError{ID: id, Label: label, Expected: expected}
+	if len(vers) > 0 {
+		e.Actual, _ = vers[0].(int64)
+		e.Exists = true
+	}
+	return e
+}
+
+// Update sets the properties of the node with the given ID to the fields of
+// the entity. The NullPolicy of the Template decides, which fields are written
+// and whether properties, which are not mapped to a field, are left intact
+// (OmitNil and OmitZero) or removed (WriteAll).
+//
+// If the entity has a version field i.e., an integer field tagged
+// `neo4j:"version"` or with the "version" option, optimistic locking is
+// applied: the node is only updated if its version equals the version of the
+// entity. Then, the version is incremented both in the database and in the
+// entity, regardless of the NullPolicy. Otherwise, an OptimisticLockError is
+// returned, which means that the node was modified concurrently or does not
+// exist anymore.
+func (t Template[T]) Update(id any, entity *T) error {
+	fs := fields(reflect.TypeOf(entity))
+	ps := props(reflect.ValueOf(entity), fs, t.nulls)
+	params := map[string]any{"id": id, "props": ps}
+
+	vf, ok := versionField(fs)
+	if !ok {
+		cyp := fmt.Sprintf("MATCH (n:%s)%s SET n %s $props", labelExpr(t.labels), t.where("id(n) = $id"), t.nulls.setOp())
+		_, err := t.execute(Request{Query: cyp, Params: t.scoped(params), Write: true}, discard)
+		return err
+	}
+
+	fv := reflect.ValueOf(entity).Elem().FieldByIndex(vf.index)
+	params["expectedVersion"] = fv.Int()
+	ps[vf.name] = fv.Int() + 1
+	v := Quote(vf.name)
+	cyp := fmt.Sprintf("MATCH (n:%s)%s SET n %s $props RETURN n.%s", labelExpr(t.labels),
+		t.where("id(n) = $id", "n."+v+" = $expectedVersion"), t.nulls.setOp(), v)
+
+	ver := fv.Int()
+	_, err := t.execute(Request{Query: cyp, Params: t.scoped(params), Write: true}, func(res neo4j.Result) error {
+		if t.conn.DryRun {
+			return nil
+		} else if !res.Next() {
+			return ErrEmpty
+		}
+		ver, _ = res.Record().Values[0].(int64)
+		return nil
+	})
+	if errors.Is(err, ErrEmpty) {
+		return lockError(t.conn, t.label, vf.name, id, fv.Int(), t.where("id(n) = $id"), t.scoped(params))
+	} else if err != nil {
+		return err
+	}
+	fv.SetInt(ver)
+	return nil
+}
+
+// UpdateFields sets only the given properties of the node with the given ID,
+// leaving all other properties intact. Unlike Update, it does not require the
+// whole entity, which makes it suitable for partial (PATCH-style) updates.
+// Setting a property to nil removes it. The NullPolicy and the version field
+// are not taken into account.
+func (t Template[T]) UpdateFields(id any, values map[string]any) error {
+	cyp := fmt.Sprintf("MATCH (n:%s)%s SET n += $values", labelExpr(t.labels), t.where("id(n) = $id"))
+	params := map[string]any{"id": id, "values": values}
+	_, err := t.execute(Request{Query: cyp, Params: t.scoped(params), Write: true}, discard)
+	return err
+}
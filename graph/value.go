@@ -0,0 +1,215 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Properties are the properties of a Node or Relationship. The getters return
+// the given default, if the property is missing or has a different type.
+type Properties map[string]any
+
+// GetString returns the string property with the given key.
+func (p Properties) GetString(key, def string) string {
+	if v, ok := p[key].(string); ok {
+		return v
+	}
+	return def
+}
+
+// GetInt returns the integer property with the given key.
+func (p Properties) GetInt(key string, def int64) int64 {
+	if v, ok := p[key].(int64); ok {
+		return v
+	}
+	return def
+}
+
+// GetFloat returns the float property with the given key. Integers are
+// converted to float64.
+func (p Properties) GetFloat(key string, def float64) float64 {
+	switch v := p[key].(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	}
+	return def
+}
+
+// GetBool returns the boolean property with the given key.
+func (p Properties) GetBool(key string, def bool) bool {
+	if v, ok := p[key].(bool); ok {
+		return v
+	}
+	return def
+}
+
+// GetTime returns the temporal property with the given key. Besides
+// DateTime, it accepts Date and LocalDateTime, which are interpreted in UTC.
+func (p Properties) GetTime(key string, def time.Time) time.Time {
+	switch v := p[key].(type) {
+	case time.Time:
+		return v
+	case neo4j.Date:
+		return v.Time()
+	case neo4j.LocalDateTime:
+		return v.Time()
+	}
+	return def
+}
+
+// Node is a node returned by a query. ElementID is only set by drivers, which
+// support element IDs (see graph5.NodeOf).
+type Node struct {
+	ID        int64
+	ElementID string
+	Labels    []string
+	Properties
+}
+
+// NodeOf converts a node of the driver to a Node.
+func NodeOf(n neo4j.Node) Node {
+	return Node{ID: n.Id, Labels: n.Labels, Properties: n.Props}
+}
+
+// HasLabel returns whether the Node has the given label.
+func (n Node) HasLabel(label string) bool {
+	for _, l := range n.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// Relationship is a relationship returned by a query. Like for Node, the
+// element IDs are only set by drivers, which support them.
+type Relationship struct {
+	ID             int64
+	StartID        int64
+	EndID          int64
+	ElementID      string
+	StartElementID string
+	EndElementID   string
+	Type           string
+	Properties
+}
+
+// RelationshipOf converts a relationship of the driver to a Relationship.
+func RelationshipOf(r neo4j.Relationship) Relationship {
+	return Relationship{ID: r.Id, StartID: r.StartId, EndID: r.EndId, Type: r.Type, Properties: r.Props}
+}
+
+// Path is an alternating sequence of Nodes and Relationships, which starts and
+// ends with a Node. Hence, it has one Node more than Relationships.
+type Path struct {
+	Nodes         []Node
+	Relationships []Relationship
+}
+
+// PathOf converts a path of the driver to a Path.
+func PathOf(p neo4j.Path) Path {
+	gp := Path{Nodes: make([]Node, len(p.Nodes)), Relationships: make([]Relationship, len(p.Relationships))}
+	for i, n := range p.Nodes {
+		gp.Nodes[i] = NodeOf(n)
+	}
+	for i, r := range p.Relationships {
+		gp.Relationships[i] = RelationshipOf(r)
+	}
+	return gp
+}
+
+// Len returns the number of Relationships of the Path.
+func (p Path) Len() int {
+	return len(p.Relationships)
+}
+
+// Start returns the first Node of the Path.
+func (p Path) Start() Node {
+	return p.Nodes[0]
+}
+
+// End returns the last Node of the Path.
+func (p Path) End() Node {
+	return p.Nodes[len(p.Nodes)-1]
+}
+
+// NewNodeMapper creates a new Mapper that converts the Node in the column with
+// the given key. If the column is missing or does not contain a Node, a
+// MappingError is raised.
+func NewNodeMapper(key string) Mapper[Node] {
+	return newValueMapper(key, "node", NodeOf)
+}
+
+// NewRelationshipMapper is like NewNodeMapper, but converts a Relationship.
+func NewRelationshipMapper(key string) Mapper[Relationship] {
+	return newValueMapper(key, "relationship", RelationshipOf)
+}
+
+// NewPathValueMapper is like NewNodeMapper, but converts a Path. Unlike
+// NewPathMapper, the Path is kept as a whole.
+func NewPathValueMapper(key string) Mapper[Path] {
+	return newValueMapper(key, "path", PathOf)
+}
+
+// newValueMapper creates a new Mapper that converts the driver value of type
+// S in the column with the given key to T.
+func newValueMapper[S, T any](key, kind string, conv func(S) T) Mapper[T] {
+	return func(rec *neo4j.Record) T {
+		v, ok := rec.Get(key)
+		if !ok {
+			panic(&MappingError{Key: key, Err: errNoColumn})
+		}
+		s, ok := v.(S)
+		if !ok {
+			panic(&MappingError{Key: key, Err: fmt.Errorf("expected a %s, got %T", kind, v)})
+		}
+		return conv(s)
+	}
+}
+
+// setGraphValue assigns Nodes, Relationships and Paths of the driver to fields
+// of type Node, Relationship and Path, respectively. It returns false, if
+// neither applies.
+func setGraphValue(dst reflect.Value, val any) bool {
+	var v any
+	switch src := val.(type) {
+	case neo4j.Node:
+		v = NodeOf(src)
+	case neo4j.Relationship:
+		v = RelationshipOf(src)
+	case neo4j.Path:
+		v = PathOf(src)
+	default:
+		return false
+	}
+	if dst.Type() != reflect.TypeOf(v) {
+		return false
+	}
+	dst.Set(reflect.ValueOf(v))
+	return true
+}
+
+// isGraphType returns whether the type is Node, Relationship or Path, which
+// are mapped from a single column rather than field by field.
+func isGraphType(typ reflect.Type) bool {
+	return typ == reflect.TypeOf(Node{}) || typ == reflect.TypeOf(Relationship{}) || typ == reflect.TypeOf(Path{})
+}
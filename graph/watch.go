@@ -0,0 +1,454 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// ChangeOp is the kind of change of a node.
+type ChangeOp string
+
+// Kinds of changes delivered by Watch.
+const (
+	NodeCreated ChangeOp = "created"
+	NodeUpdated ChangeOp = "updated"
+	NodeDeleted ChangeOp = "deleted"
+)
+
+// WatchMode selects how Watch tails the changes.
+type WatchMode int
+
+const (
+	// WatchAuto uses change data capture, if it is available, and polling
+	// otherwise. A persisted Checkpoint keeps the mode it was created with.
+	WatchAuto WatchMode = iota
+	// WatchCDC queries the change data capture procedures db.cdc.*, which
+	// require Neo4j 5.13 or later and a database with transaction log
+	// enrichment enabled.
+	WatchCDC
+	// WatchPolling queries the nodes, whose timestamp properties changed since
+	// the last poll. Nodes, which are deleted instead of soft-deleted, are not
+	// noticed.
+	WatchPolling
+)
+
+// Change is a change of a node delivered by Watch. Before is only populated
+// by change data capture. Value is decoded from After or, if the node was
+// deleted, from Before.
+type Change[T any] struct {
+	Op         ChangeOp
+	ID         int64
+	ElementID  string
+	Labels     []string
+	Before     Properties
+	After      Properties
+	Value      T
+	Checkpoint Checkpoint
+}
+
+// Checkpoint is the position in the changes, after which Watch resumes.
+// ChangeID is the change identifier of change data capture. Since and ID are
+// the timestamp and internal ID of the last node returned by polling.
+type Checkpoint struct {
+	ChangeID string    `json:"changeId,omitempty"`
+	Since    time.Time `json:"since"`
+	ID       int64     `json:"id,omitempty"`
+}
+
+// CheckpointStore persists the Checkpoints of watchers by name.
+type CheckpointStore interface {
+	// LoadCheckpoint returns the Checkpoint with the given name and whether it
+	// exists.
+	LoadCheckpoint(name string) (Checkpoint, bool, error)
+	// SaveCheckpoint creates or replaces the Checkpoint with the given name.
+	SaveCheckpoint(name string, cp Checkpoint) error
+}
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	// Name identifies the Checkpoint in the Store. It defaults to the labels.
+	Name string
+	// Mode selects change data capture or polling.
+	Mode WatchMode
+	// Store persists the Checkpoint after each batch of changes has been
+	// received, so that a restarted watcher resumes afterwards. If it is nil,
+	// consumers may persist Change.Checkpoint themselves and pass the last
+	// one as Start.
+	Store CheckpointStore
+	// Start is used, if there is no persisted Checkpoint. If it is nil, only
+	// changes after the start of Watch are delivered, unless FromStart is set.
+	Start *Checkpoint
+	// FromStart delivers all changes, which are still available i.e., the
+	// earliest changes retained by change data capture, or all nodes having
+	// a timestamp when polling.
+	FromStart bool
+	// Interval is the pause between polls, after all changes were delivered.
+	// It defaults to one second.
+	Interval time.Duration
+	// BatchSize limits the number of nodes per poll. It defaults to 1000.
+	BatchSize int
+	// CreatedKey, UpdatedKey and DeletedKey are the properties holding the
+	// time of the creation, the last update and the soft deletion, which are
+	// used for polling. They default to "createdAt", "updatedAt" and
+	// the soft-delete property of T, respectively e.g., audit fields and
+	// SoftDeleteByID.
+	CreatedKey, UpdatedKey, DeletedKey string
+}
+
+// withDefaults returns a copy of the options with the defaults applied.
+func (o WatchOptions) withDefaults(labels []string, deleted string) WatchOptions {
+	if o.Name == "" {
+		o.Name = strings.Join(labels, ":")
+	}
+	if o.Interval <= 0 {
+		o.Interval = time.Second
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 1000
+	}
+	if o.CreatedKey == "" {
+		o.CreatedKey = "createdAt"
+	}
+	if o.UpdatedKey == "" {
+		o.UpdatedKey = "updatedAt"
+	}
+	if o.DeletedKey == "" {
+		o.DeletedKey = deleted
+	}
+	return o
+}
+
+// Watch tails the changes of the nodes with the labels of the Template, and
+// sends them to the returned channel in the order they
+// happened, until the context is cancelled or an error occurs, e.g., for
+// downstream synchronization:
+//
+//	changes, errc := graph.NewTemplate[Person](c).Watch(ctx, graph.WatchOptions{
+//		Name:  "search-index",
+//		Store: graph.NewCheckpointStore(c),
+//	})
+//	for ch := range changes {
+//		index(ch.Op, ch.Value)
+//	}
+//	if err := <-errc; err != nil {
+//		return err
+//	}
+//
+// Changes are delivered at least once: the Checkpoint is persisted after all
+// changes of a batch were received, hence, changes received before a crash
+// may be delivered again. Afterwards, the error channel receives the error,
+// if any, and is closed. Cancellation is not reported as error.
+//
+// Polling relies on the timestamps stored by the application, so it requires
+// synchronized clocks, if they are set by different processes, or by both
+// the client (e.g., audit fields) and the server (e.g., SoftDeleteByID).
+// A node is reported as created, if its creation and update time are equal,
+// or if it has no update time.
+// Only polling considers the scope of the Template.
+func (t Template[T]) Watch(ctx context.Context, o WatchOptions) (<-chan Change[T], <-chan error) {
+	chs, errc := make(chan Change[T]), make(chan error, 1)
+	go func() {
+		defer close(errc)
+		err := t.watch(ctx, o.withDefaults(t.labels, deletedKey(reflect.TypeOf(new(T)).Elem())), chs)
+		close(chs)
+		if err != nil && ctx.Err() == nil {
+			errc <- err
+		}
+	}()
+	return chs, errc
+}
+
+// watch polls the changes and sends them to ch until the context is done.
+func (t Template[T]) watch(ctx context.Context, o WatchOptions, ch chan<- Change[T]) error {
+	cp, ok, err := Checkpoint{}, false, error(nil)
+	if o.Store != nil {
+		if cp, ok, err = o.Store.LoadCheckpoint(o.Name); err != nil {
+			return err
+		}
+	}
+	if !ok && o.Start != nil {
+		cp, ok = *o.Start, true
+	}
+
+	cdc := o.Mode == WatchCDC
+	if o.Mode == WatchAuto {
+		cdc = ok && cp.ChangeID != "" || !ok && t.conn.hasCDC(ctx)
+	}
+	if !ok {
+		if cp, err = t.startCheckpoint(ctx, cdc, o.FromStart); err != nil {
+			return err
+		}
+	}
+
+	poll := t.pollNodes
+	if cdc {
+		poll = t.pollCDC
+	}
+	tick := time.NewTicker(o.Interval)
+	defer tick.Stop()
+	for {
+		cs, more, err := poll(ctx, cp, o)
+		if err != nil {
+			return err
+		}
+		for _, c := range cs {
+			select {
+			case ch <- c:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if len(cs) > 0 {
+			cp = cs[len(cs)-1].Checkpoint
+			if o.Store != nil {
+				if err = o.Store.SaveCheckpoint(o.Name, cp); err != nil {
+					return err
+				}
+			}
+		}
+		if more {
+			continue
+		}
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// hasCDC returns whether change data capture is available for the database.
+func (c *Conn) hasCDC(ctx context.Context) bool {
+	if major, minor, err := c.ServerVersion(); err != nil || major < 5 || major == 5 && minor < 13 {
+		return false
+	}
+	id, err := c.cdcID(ctx, "db.cdc.current")
+	if err != nil {
+		return false
+	}
+	r := Request{Query: "CALL db.cdc.query($from, []) YIELD id RETURN id LIMIT 0", Params: map[string]any{"from": id}}
+	_, _, err = NewTemplate[string](c).QueryContext(ctx, r, NewSingleValueMapper[string](0))
+	return err == nil
+}
+
+// cdcID returns the change identifier returned by the procedure.
+func (c *Conn) cdcID(ctx context.Context, proc string) (string, error) {
+	r := Request{Query: "CALL " + proc + "() YIELD id RETURN id"}
+	ids, _, err := NewTemplate[string](c).QueryContext(ctx, r, NewSingleValueMapper[string](0))
+	if err != nil || len(ids) == 0 {
+		return "", err
+	}
+	return ids[0], nil
+}
+
+// startCheckpoint returns the Checkpoint for the start of the changes or the
+// current time.
+func (t Template[T]) startCheckpoint(ctx context.Context, cdc, fromStart bool) (cp Checkpoint, err error) {
+	switch {
+	case cdc && fromStart:
+		cp.ChangeID, err = t.conn.cdcID(ctx, "db.cdc.earliest")
+	case cdc:
+		cp.ChangeID, err = t.conn.cdcID(ctx, "db.cdc.current")
+	case !fromStart:
+		var ts []time.Time
+		r := Request{Query: "RETURN datetime()"}
+		ts, _, err = NewTemplate[time.Time](t.conn).QueryContext(ctx, r, NewSingleValueMapper[time.Time](0))
+		if err == nil && len(ts) > 0 {
+			cp.Since, cp.ID = ts[0], -1
+		}
+	}
+	return cp, err
+}
+
+// pollCDC queries the changes of change data capture after the Checkpoint.
+func (t Template[T]) pollCDC(ctx context.Context, cp Checkpoint, o WatchOptions) (cs []Change[T], more bool, err error) {
+	cyp := "CALL db.cdc.query($from, $selectors) YIELD id, event " +
+		"WHERE event.eventType = 'n' RETURN id, event"
+	r := Request{
+		Query:  cyp,
+		Params: map[string]any{"from": cp.ChangeID, "selectors": []any{map[string]any{"select": "n", "labels": t.labels}}},
+	}
+	_, err = NewTemplate[any](t.conn).executeContext(ctx, r, func(res neo4j.Result) error {
+		for res.Next() {
+			rec := res.Record()
+			id, _ := rec.Values[0].(string)
+			ev, _ := rec.Values[1].(map[string]any)
+			c, err := t.cdcChange(ev)
+			if err != nil {
+				return err
+			}
+			c.Checkpoint = Checkpoint{ChangeID: id}
+			cs = append(cs, c)
+		}
+		return nil
+	})
+	return cs, false, err
+}
+
+// cdcChange converts an event of change data capture to a Change.
+func (t Template[T]) cdcChange(ev map[string]any) (c Change[T], err error) {
+	c.ElementID, _ = ev["elementId"].(string)
+	c.ID = legacyID(c.ElementID)
+	c.Labels = strs(ev["labels"])
+	state, _ := ev["state"].(map[string]any)
+	c.Before, c.After = stateProps(state["before"]), stateProps(state["after"])
+
+	props := c.After
+	switch ev["operation"] {
+	case "c":
+		c.Op = NodeCreated
+	case "d":
+		c.Op, props = NodeDeleted, c.Before
+	default:
+		c.Op = NodeUpdated
+	}
+	err = t.decodeChange(&c, props)
+	return c, err
+}
+
+// pollNodes queries up to BatchSize nodes, whose soft deletion, update or
+// creation time, whichever is present first, is after the Checkpoint, and
+// reports whether there may be more.
+func (t Template[T]) pollNodes(ctx context.Context, cp Checkpoint, o WatchOptions) (cs []Change[T], more bool, err error) {
+	cyp := "MATCH (n:" + labelExpr(t.labels) + ")" + t.where() +
+		" WITH n, coalesce(n." + Quote(o.DeletedKey) + ", n." + Quote(o.UpdatedKey) + ", n." + Quote(o.CreatedKey) + ") AS ts" +
+		" WHERE ts IS NOT NULL AND ($since IS NULL OR ts > $since OR ts = $since AND id(n) > $id)" +
+		" RETURN n, ts ORDER BY ts, id(n) LIMIT $limit"
+	params := map[string]any{"since": nil, "id": cp.ID, "limit": o.BatchSize}
+	if !cp.Since.IsZero() {
+		params["since"] = cp.Since
+	}
+
+	r := Request{Query: cyp, Params: t.scoped(params)}
+	_, err = NewTemplate[any](t.conn).executeContext(ctx, r, func(res neo4j.Result) error {
+		for res.Next() {
+			rec := res.Record()
+			n := rec.Values[0].(neo4j.Node)
+			ts, _ := rec.Values[1].(time.Time)
+			c := Change[T]{Op: NodeUpdated, ID: n.Id, Labels: n.Labels, After: n.Props}
+			if p := Properties(n.Props); n.Props[o.DeletedKey] != nil {
+				c.Op = NodeDeleted
+			} else if cr, up := p.GetTime(o.CreatedKey, time.Time{}), p.GetTime(o.UpdatedKey, time.Time{}); !cr.IsZero() &&
+				(up.IsZero() || cr.Equal(up)) {
+				c.Op = NodeCreated
+			}
+			if err := t.decodeChange(&c, n.Props); err != nil {
+				return err
+			}
+			c.Checkpoint = Checkpoint{Since: ts, ID: n.Id}
+			cs = append(cs, c)
+		}
+		return nil
+	})
+	return cs, len(cs) == o.BatchSize, err
+}
+
+// decodeChange decodes the properties into the Value of the Change.
+func (t Template[T]) decodeChange(c *Change[T], props map[string]any) error {
+	if props == nil {
+		return nil
+	}
+	n := neo4j.Node{Id: c.ID, Labels: c.Labels, Props: props}
+	return t.dec.decodeEntity(n, reflect.ValueOf(&c.Value).Elem(), fields(reflect.TypeOf(c.Value)))
+}
+
+// stateProps returns the properties of the state of a node before or after a
+// change, or nil, if there is none.
+func stateProps(v any) Properties {
+	s, _ := v.(map[string]any)
+	if s == nil {
+		return nil
+	}
+	ps, _ := s["properties"].(map[string]any)
+	return ps
+}
+
+// legacyID returns the internal ID contained in an element ID of the form
+// "4:<database>:<id>", or -1.
+func legacyID(elementID string) int64 {
+	id, err := strconv.ParseInt(elementID[strings.LastIndexByte(elementID, ':')+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return id
+}
+
+// checkpointStore stores Checkpoints as nodes labeled "WatchCheckpoint".
+type checkpointStore struct {
+	conn *Conn
+}
+
+// NewCheckpointStore returns a CheckpointStore, which stores each Checkpoint
+// as a node labeled "WatchCheckpoint" with the properties name, changeId,
+// since and lastId.
+func NewCheckpointStore(c *Conn) CheckpointStore {
+	return checkpointStore{conn: c}
+}
+
+// LoadCheckpoint returns the Checkpoint with the given name.
+func (s checkpointStore) LoadCheckpoint(name string) (Checkpoint, bool, error) {
+	r := Request{
+		Query:  "MATCH (c:WatchCheckpoint {name: $name}) RETURN c.changeId, c.since, c.lastId",
+		Params: map[string]any{"name": name},
+	}
+	cps, _, err := NewTemplate[Checkpoint](s.conn).Query(r, func(rec *neo4j.Record) Checkpoint {
+		var cp Checkpoint
+		cp.ChangeID, _ = rec.Values[0].(string)
+		cp.Since, _ = rec.Values[1].(time.Time)
+		cp.ID, _ = rec.Values[2].(int64)
+		return cp
+	})
+	if err != nil || len(cps) == 0 {
+		return Checkpoint{}, false, err
+	}
+	return cps[0], true, nil
+}
+
+// SaveCheckpoint creates or replaces the Checkpoint with the given name.
+func (s checkpointStore) SaveCheckpoint(name string, cp Checkpoint) error {
+	params := map[string]any{"name": name, "changeId": nil, "since": nil, "lastId": cp.ID}
+	if cp.ChangeID != "" {
+		params["changeId"] = cp.ChangeID
+	}
+	if !cp.Since.IsZero() {
+		params["since"] = cp.Since
+	}
+	r := Request{
+		Query: "MERGE (c:WatchCheckpoint {name: $name}) " +
+			"SET c.changeId = $changeId, c.since = $since, c.lastId = $lastId",
+		Params: params,
+		Write:  true,
+	}
+	_, err := NewTemplate[any](s.conn).execute(r, discard)
+	return err
+}
+
+// strs converts a list of strings returned by the driver.
+func strs(v any) []string {
+	l, _ := v.([]any)
+	ss := make([]string, 0, len(l))
+	for _, e := range l {
+		s, _ := e.(string)
+		ss = append(ss, s)
+	}
+	return ss
+}
@@ -0,0 +1,163 @@
+// Copyright 2022 The Roland authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// BufferedWriter accumulates entities and creates them in batches using a
+// single UNWIND statement per flush. A flush happens when the buffer reaches
+// its size, the interval elapses, or Flush or Close is called.
+//
+// Each flush runs in its own managed write Transaction, independent of the
+// current Transaction of the Conn. Entities of a failed flush are discarded
+// and the error is reported by the next call to Write, Flush or Close.
+// The BatchMode of the Conn applies to each flush.
+// A BufferedWriter is safe for concurrent use.
+type BufferedWriter[T any] struct {
+	t    Template[T]
+	size int
+	mu   sync.Mutex
+	buf  []T
+	cnt  Counters
+	errs []error
+	done chan struct{}
+	once sync.Once
+}
+
+// NewBufferedWriter creates a new BufferedWriter, which creates nodes with the
+// label of the Template. If size is not positive, the BatchSize of the Conn is
+// used. If interval is positive, the buffer is also flushed periodically.
+func NewBufferedWriter[T any](t *Template[T], size int, interval time.Duration) *BufferedWriter[T] {
+	if size <= 0 {
+		size = t.conn.batchSize()
+	}
+	w := &BufferedWriter[T]{t: *t, size: size, done: make(chan struct{})}
+	if interval > 0 {
+		go w.tick(interval)
+	}
+	return w
+}
+
+// tick flushes the buffer periodically until the BufferedWriter is closed.
+func (w *BufferedWriter[T]) tick(interval time.Duration) {
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-tk.C:
+			w.mu.Lock()
+			w.flush()
+			w.mu.Unlock()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Write adds the entity to the buffer and flushes it, if it is full.
+func (w *BufferedWriter[T]) Write(entity T) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, entity)
+	if len(w.buf) >= w.size {
+		w.flush()
+	}
+	return w.takeErrs()
+}
+
+// Flush writes all buffered entities and returns the errors of all flushes,
+// which failed since the last report.
+func (w *BufferedWriter[T]) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flush()
+	return w.takeErrs()
+}
+
+// Close stops the periodic flush and writes the remaining entities.
+func (w *BufferedWriter[T]) Close() error {
+	w.once.Do(func() { close(w.done) })
+	return w.Flush()
+}
+
+// Counters returns the aggregated Counters of all successful flushes.
+func (w *BufferedWriter[T]) Counters() Counters {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cnt
+}
+
+// flush writes the buffered entities. The caller must hold the lock.
+// In CollectErrors mode, only the entities, which cannot be written, are
+// discarded and reported in a BatchError with their index in the buffer.
+func (w *BufferedWriter[T]) flush() {
+	if len(w.buf) == 0 {
+		return
+	}
+
+	fs := fields(reflect.TypeOf(w.buf[0]))
+	rows := make([]any, len(w.buf))
+	idxs := make([]int, len(w.buf))
+	for i, e := range w.buf {
+		rows[i] = props(reflect.ValueOf(e), fs, w.t.nulls)
+		idxs[i] = i
+	}
+	n := len(w.buf)
+	w.buf = w.buf[:0]
+
+	cyp := fmt.Sprintf("UNWIND $rows AS row CREATE (n:%s) SET n = row", labelExpr(w.t.labels))
+	err := runBatch(idxs, n, w.t.conn.BatchMode, func(chunk []int) error {
+		rs := make([]any, len(chunk))
+		for j, i := range chunk {
+			rs[j] = rows[i]
+		}
+		sum, err := WriteTx(w.t.conn, func(tx neo4j.Transaction) (neo4j.ResultSummary, error) {
+			r := Request{Query: cyp, Params: map[string]any{"rows": rs}, Write: true}
+			w.t.conn.logQuery(r)
+			finish := w.t.conn.instrument(w.t.context(), r)
+			res, err := w.t.conn.run(w.t.context(), r, tx.Run)
+			if err != nil {
+				finish(0, nil, err)
+				return nil, err
+			}
+			sum, err := res.Consume()
+			finish(0, sum, err)
+			return sum, err
+		})
+		if err != nil {
+			return wrapErr(cyp, err)
+		}
+		w.cnt.Add(sum)
+		return nil
+	})
+	if err != nil {
+		w.errs = append(w.errs, fmt.Errorf("flushing %d entities: %w", n, err))
+	}
+}
+
+// takeErrs returns and clears the errors of failed flushes.
+func (w *BufferedWriter[T]) takeErrs() error {
+	err := joinErrs(w.errs)
+	w.errs = nil
+	return err
+}
@@ -16,6 +16,7 @@ package plan
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
 )
@@ -59,16 +60,111 @@ func (p Stats) String() string {
 
 // Op is a single operation in an execution plan.
 type Op struct {
-	Op          string `json:"operatorType" yaml:"operatorType" view:"Operator"`
-	Details     string `json:"details,omitempty" yaml:"details,omitempty" view:"Details,omitempty"`
-	RowsEst     int64  `json:"estimatedRows" yaml:"estimatedRows" view:"Estimated Rows"`
-	Rows        int64  `json:"rows" yaml:"rows" view:"Rows"`
-	DBHits      int64  `json:"dbHits" yaml:"dbHits" view:"DB Hits"`
-	Memory      int64  `json:"memory" yaml:"memory" view:"Memory (Bytes)"`
-	CacheHits   int64  `json:"pageCacheHits" yaml:"pageCacheHits" view:"Cache Hits"`
-	CacheMisses int64  `json:"pageCacheMisses" yaml:"pageCacheMisses" view:"Cache Misses"`
-	Order       string `json:"order,omitempty" yaml:"order,omitempty" view:"Ordered by,omitempty"`
-	Children    []*Op  `json:"children,omitempty" yaml:"children,omitempty" view:"-"`
+	Op          string   `json:"operatorType" yaml:"operatorType" view:"Operator"`
+	Details     string   `json:"details,omitempty" yaml:"details,omitempty" view:"Details,omitempty"`
+	RowsEst     int64    `json:"estimatedRows" yaml:"estimatedRows" view:"Estimated Rows"`
+	Rows        int64    `json:"rows" yaml:"rows" view:"Rows"`
+	DBHits      int64    `json:"dbHits" yaml:"dbHits" view:"DB Hits"`
+	Memory      int64    `json:"memory" yaml:"memory" view:"Memory (Bytes)"`
+	CacheHits   int64    `json:"pageCacheHits" yaml:"pageCacheHits" view:"Cache Hits"`
+	CacheMisses int64    `json:"pageCacheMisses" yaml:"pageCacheMisses" view:"Cache Misses"`
+	Order       string   `json:"order,omitempty" yaml:"order,omitempty" view:"Ordered by,omitempty"`
+	Identifiers []string `json:"identifiers,omitempty" yaml:"identifiers,omitempty" view:"Identifiers,omitempty"`
+	Children    []*Op    `json:"children,omitempty" yaml:"children,omitempty" view:"-"`
+}
+
+// FromPlan converts the plan of an EXPLAIN query, which has no statistics
+// except for the estimated rows.
+func FromPlan(p neo4j.Plan) *Op {
+	if p == nil {
+		return nil
+	}
+	op := newOp(p.Operator(), p.Arguments(), p.Identifiers())
+	for _, ch := range p.Children() {
+		op.Children = append(op.Children, FromPlan(ch))
+	}
+	return op
+}
+
+// FromProfile converts the plan of a PROFILE query including its statistics.
+func FromProfile(p neo4j.ProfiledPlan) *Op {
+	if p == nil {
+		return nil
+	}
+	op := newOp(p.Operator(), p.Arguments(), p.Identifiers())
+	op.Rows, op.DBHits = p.Records(), p.DbHits()
+	op.CacheHits, op.CacheMisses = p.PageCacheHits(), p.PageCacheMisses()
+	for _, ch := range p.Children() {
+		op.Children = append(op.Children, FromProfile(ch))
+	}
+	return op
+}
+
+// newOp creates an Op from the arguments reported by the server. The suffix
+// denoting the runtime e.g., "@neo4j", is removed from the operator.
+func newOp(operator string, args map[string]any, ids []string) *Op {
+	name, _, _ := strings.Cut(operator, "@")
+	op := &Op{Op: name, Identifiers: ids}
+	op.Details, _ = args["Details"].(string)
+	op.Order, _ = args["Order"].(string)
+	op.RowsEst = toInt(args["EstimatedRows"])
+	op.Memory = toInt(args["Memory"])
+	return op
+}
+
+// toInt converts a numeric argument to an integer. Estimates are rounded.
+func toInt(v any) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case float64:
+		return int64(n + 0.5)
+	}
+	return 0
+}
+
+// Find returns all operations of the plan, including the Op itself, whose
+// operator is one of the given ones e.g., "AllNodesScan".
+func (p *Op) Find(ops ...string) (found []*Op) {
+	for _, o := range ops {
+		if p.Op == o {
+			found = append(found, p)
+			break
+		}
+	}
+	for _, ch := range p.Children {
+		found = append(found, ch.Find(ops...)...)
+	}
+	return found
+}
+
+// Tree renders the plan as indented tree, one operation per line, starting
+// with the root e.g., ProduceResults.
+func (p *Op) Tree() string {
+	sb := strings.Builder{}
+	p.render(&sb, "", "")
+	return sb.String()
+}
+
+// render writes the operation and its children with the given prefixes.
+func (p *Op) render(sb *strings.Builder, first, rest string) {
+	sb.WriteString(first + p.Op)
+	if p.Details != "" {
+		sb.WriteString(" " + p.Details)
+	}
+	_, _ = fmt.Fprintf(sb, " (est. %d %s", p.RowsEst, plural(p.RowsEst, "row", "rows"))
+	if p.Rows > 0 || p.DBHits > 0 {
+		_, _ = fmt.Fprintf(sb, ", %d %s, %d DB %s",
+			p.Rows, plural(p.Rows, "row", "rows"), p.DBHits, plural(p.DBHits, "hit", "hits"))
+	}
+	sb.WriteString(")\n")
+	for i, ch := range p.Children {
+		if i == len(p.Children)-1 {
+			ch.render(sb, rest+"└─ ", rest+"   ")
+		} else {
+			ch.render(sb, rest+"├─ ", rest+"│  ")
+		}
+	}
 }
 
 // String returns a string representation of the operation.